@@ -6,3 +6,10 @@ var RequiredScopes = []string{
 	"chat:read",
 	"chat:edit",
 }
+
+// OptionalScopes is the list of Twitch API scopes that the chat bot requests when a
+// user logs in, but which aren't required: features that depend on these scopes fail
+// if the bot's access token wasn't granted them
+var OptionalScopes = []string{
+	"moderator:manage:announcements",
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/golden-vcr/auth"
+	"github.com/golden-vcr/chatbot/internal/chatlog"
+	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+)
+
+// replay plays back an IRC session that was recorded by the chatbot server (with
+// IRC_SESSION_RECORD_PATH set), running each received message through the bot and
+// printing the resulting chatlog events, bot replies, and twitch-events messages to
+// stdout as JSON lines. No messages are sent to Twitch or to any backend service. The
+// replay ends as soon as the last recorded line has been received, so any replies that
+// are still queued at that point are not printed.
+func main() {
+	sessionPath := flag.String("session", "", "path to a recorded IRC session (JSONL)")
+	channelName := flag.String("channel", "goldenvcr", "name of the channel joined in the session")
+	botUsername := flag.String("username", "tapeboy", "username of the bot in the session")
+	speed := flag.Float64("speed", 0, "playback speed relative to the recording; 0 to replay as quickly as possible")
+	cheermotesPath := flag.String("cheermotes", "", "path to a JSON file listing the cheermotes to render in chatlog events")
+	flag.Parse()
+	if *sessionPath == "" {
+		fmt.Fprintf(os.Stderr, "-session is required\n")
+		os.Exit(1)
+	}
+	if err := run(*sessionPath, *channelName, *botUsername, *speed, *cheermotesPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(sessionPath, channelName, botUsername string, speed float64, cheermotesPath string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var cheermotes []chatlog.Cheermote
+	if cheermotesPath != "" {
+		var err error
+		cheermotes, err = chatlog.NewFileCheermoteProvider(cheermotesPath).GetCheermotes(ctx, channelName)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(sessionPath)
+	if err != nil {
+		return err
+	}
+	entries, err := irc.LoadSession(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	conn, err := irc.NewConn(ctx, irc.ConnOpts{
+		Dial:   irc.NewReplayDialFunc(entries, irc.ReplayOpts{Speed: speed, CloseWhenDone: true}),
+		Logger: irc.NewStreamLogger(os.Stderr),
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Nobody will answer our keepalive PINGs, so don't bother sending any; and nobody
+	// will confirm delivery of our replies either, so don't wait long for that. Any
+	// logs go to stderr, so that stdout only has JSON lines.
+	opts := irc.BotOpts{
+		PingInterval:    24 * time.Hour,
+		DeliveryTimeout: time.Millisecond,
+		Logger:          irc.NewStreamLogger(os.Stderr),
+	}
+	enc := &syncEncoder{enc: json.NewEncoder(os.Stdout)}
+	messagesChan := make(chan *irc.Message)
+	emitBotMessage := func(channel string, m outbound.Message) {
+		enc.Encode(map[string]outbound.Message{"bot": m})
+	}
+	channels := []irc.Channel{{Name: channelName, Commands: []string{irc.AllCommands}}}
+	b, err := irc.NewBot(ctx, conn, opts, channels, botUsername, "replay", messagesChan, emitBotMessage, &replayServiceClient{}, &replayProducer{enc: enc})
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.Done():
+			if err := b.GetLastError(); !errors.Is(err, irc.ErrConnectionClosed) {
+				return err
+			}
+			return nil
+		case message := <-messagesChan:
+			event, err := chatlog.EventFromMessage(message, cheermotes)
+			if errors.Is(err, chatlog.ErrIgnored) {
+				continue
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to parse chatlog event from '%s': %v\n", message.Raw, err)
+				continue
+			}
+			enc.Encode(map[string]*chatlog.Event{"chatlog": event})
+		}
+	}
+}
+
+// syncEncoder writes JSON lines to stdout on behalf of the bot's goroutines as well as
+// the main loop, without interleaving them
+type syncEncoder struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+func (e *syncEncoder) Encode(v any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(v)
+}
+
+// replayServiceClient stands in for the auth service during replay: commands that
+// require a service token will fail
+type replayServiceClient struct{}
+
+func (c *replayServiceClient) RequestServiceToken(ctx context.Context, payload auth.ServiceTokenRequest) (string, error) {
+	return "", fmt.Errorf("auth service is not available during replay")
+}
+
+// replayProducer prints messages that would have been sent to the twitch-events queue
+type replayProducer struct {
+	enc *syncEncoder
+}
+
+func (p *replayProducer) Send(ctx context.Context, jsonData []byte) error {
+	return p.enc.Encode(map[string]json.RawMessage{"twitchEvent": jsonData})
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codingconcepts/env"
 	"github.com/golden-vcr/auth"
 	"github.com/golden-vcr/chatbot/internal/chatlog"
+	"github.com/golden-vcr/chatbot/internal/commands"
 	"github.com/golden-vcr/chatbot/internal/connection"
 	"github.com/golden-vcr/chatbot/internal/irc"
 	"github.com/golden-vcr/chatbot/internal/state"
@@ -17,18 +23,42 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// commandsReloadInterval is how often we check whether the file at COMMANDS_PATH has
+// been modified
+const commandsReloadInterval = 5 * time.Second
+
 type Config struct {
 	BindAddr   string `env:"BIND_ADDR"`
 	ListenPort uint16 `env:"LISTEN_PORT" default:"5006"`
 	PublicUrl  string `env:"PUBLIC_URL" default:"https://goldenvcr.com/api/chatbot"`
 
-	TwitchChannelName  string `env:"TWITCH_CHANNEL_NAME" required:"true"`
-	TwitchBotUsername  string `env:"TWITCH_BOT_USERNAME" required:"true"`
-	TwitchClientId     string `env:"TWITCH_BOT_CLIENT_ID" required:"true"`
-	TwitchClientSecret string `env:"TWITCH_BOT_CLIENT_SECRET" required:"true"`
+	TwitchChannelName   string   `env:"TWITCH_CHANNEL_NAME" required:"true"`
+	TwitchExtraChannels []string `env:"TWITCH_EXTRA_CHANNELS"`
+	TwitchBotUsername   string   `env:"TWITCH_BOT_USERNAME" required:"true"`
+	TwitchClientId      string   `env:"TWITCH_BOT_CLIENT_ID" required:"true"`
+	TwitchClientSecret  string   `env:"TWITCH_BOT_CLIENT_SECRET" required:"true"`
 
 	TokenStoragePath string `env:"TOKEN_STORAGE_PATH" default:"twitch-tokens"`
 
+	IrcTransport         string        `env:"IRC_TRANSPORT" default:"tcp"`
+	IrcSessionRecordPath string        `env:"IRC_SESSION_RECORD_PATH"`
+	IrcShutdownTimeout   time.Duration `env:"IRC_SHUTDOWN_TIMEOUT" default:"10s"`
+	CheermotesPath       string        `env:"CHEERMOTES_PATH"`
+
+	CommandsPath           string   `env:"COMMANDS_PATH"`
+	CommandCooldowns       []string `env:"COMMAND_COOLDOWNS"`
+	CommandCooldownNotices bool     `env:"COMMAND_COOLDOWN_NOTICES"`
+	CommandAllow           []string `env:"COMMAND_ALLOW"`
+	CommandDeny            []string `env:"COMMAND_DENY"`
+	CustomCommandsPath     string   `env:"CUSTOM_COMMANDS_PATH" default:"custom-commands.json"`
+
+	IrcLogLevels       []string `env:"IRC_LOG_LEVELS"`
+	IrcLogSampling     []string `env:"IRC_LOG_SAMPLING"`
+	IrcLogRedactTags   []string `env:"IRC_LOG_REDACT_TAGS"`
+	IrcLogRedactBodies []string `env:"IRC_LOG_REDACT_BODIES"`
+	IrcLogHashUsers    bool     `env:"IRC_LOG_HASH_USERS"`
+	IrcLogHashSalt     string   `env:"IRC_LOG_HASH_SALT"`
+
 	AuthURL          string `env:"AUTH_URL" default:"http://localhost:5002"`
 	AuthSharedSecret string `env:"AUTH_SHARED_SECRET" required:"true"`
 
@@ -83,20 +113,169 @@ func main() {
 	// Start setting up our HTTP handlers, using gorilla/mux for routing
 	r := mux.NewRouter()
 
+	// The bot joins our own channel, where it responds to all commands, along with any
+	// additional channels (e.g. a co-streaming partner's channel) in which it may only
+	// respond to a configured subset of commands
+	channels := []irc.Channel{{Name: strings.ToLower(config.TwitchChannelName), Commands: []string{irc.AllCommands}}}
+	for _, spec := range config.TwitchExtraChannels {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		channel, err := irc.ParseChannel(spec)
+		if err != nil {
+			app.Fail("Failed to parse TWITCH_EXTRA_CHANNELS", err)
+		}
+		channels = append(channels, channel)
+	}
+	channelNames := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		channelNames = append(channelNames, channel.Name)
+	}
+
 	// Establish a channel into which new IRC messages will be written as they're
 	// received by the current bot
 	messagesChan := make(chan *irc.Message)
 
+	// Cheermotes are rendered in the chatlog using the catalog provided by the Twitch
+	// API, unless a local file has been supplied in its place
+	var cheermoteProvider chatlog.CheermoteProvider
+	if config.CheermotesPath != "" {
+		cheermoteProvider = chatlog.NewFileCheermoteProvider(config.CheermotesPath)
+	} else {
+		cheermoteProvider, err = chatlog.NewTwitchCheermoteProvider(config.TwitchClientId, config.TwitchClientSecret)
+		if err != nil {
+			app.Fail("Failed to initialize cheermote provider", err)
+		}
+	}
+
 	// The chatlog server buffers a subset of messages that have appeared recently in
-	// the channel, and it serves that stream of messages to clients for rendering
-	chatlogServer := chatlog.NewServer(ctx, app.Log(), messagesChan)
+	// each channel, and it serves those streams of messages to clients for rendering
+	chatlogServer := chatlog.NewServer(ctx, app.Log(), channelNames, messagesChan, cheermoteProvider)
 	chatlogServer.RegisterRoutes(ctx, r)
 
+	// We need a Twitch API client in order to exchange OAuth codes for User Access
+	// Tokens and to refresh those tokens, and we persist the bot's credentials on disk so
+	// that they can be reused across restarts and reconnects
+	redirectUri := config.PublicUrl + "/auth"
+	twitchClient, err := connection.NewTwitchClient(ctx, config.TwitchClientId, config.TwitchClientSecret, redirectUri)
+	if err != nil {
+		app.Fail("Failed to initialize Twitch client for connection server", err)
+	}
+	tokenStore := tokens.NewStore(config.TokenStoragePath, config.TwitchBotUsername)
+
+	// Raw IRC traffic is logged according to a configurable policy, which may reduce
+	// the volume of logs and strip the details of users' messages; if configured to do
+	// so, we also record every line, unmodified, to a session file that can later be
+	// replayed for debugging and regression tests
+	ircLogLevels, err := irc.ParseLogLevels(config.IrcLogLevels)
+	if err != nil {
+		app.Fail("Failed to parse IRC_LOG_LEVELS", err)
+	}
+	ircLogSampling, err := irc.ParseLogSampling(config.IrcLogSampling)
+	if err != nil {
+		app.Fail("Failed to parse IRC_LOG_SAMPLING", err)
+	}
+	ircLogger := irc.NewStructuredLogger(app.Log(), irc.LogPolicy{
+		Levels:       ircLogLevels,
+		SampleEvery:  ircLogSampling,
+		RedactTags:   nonEmpty(config.IrcLogRedactTags),
+		RedactBodies: upper(nonEmpty(config.IrcLogRedactBodies)),
+		HashUsers:    config.IrcLogHashUsers,
+		HashSalt:     config.IrcLogHashSalt,
+	})
+	if config.IrcSessionRecordPath != "" {
+		sessionFile, err := os.OpenFile(config.IrcSessionRecordPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			app.Fail("Failed to open IRC session recording file", err)
+		}
+		defer sessionFile.Close()
+		ircLogger = irc.NewMultiLogger(ircLogger, irc.NewSessionRecorder(sessionFile))
+	}
+
+	// We connect to Twitch IRC over TLS by default, but we can use Twitch's WebSocket
+	// endpoint instead in environments that only permit outbound HTTPS traffic
+	ircTransport, err := irc.ParseTransport(config.IrcTransport)
+	if err != nil {
+		app.Fail("Failed to parse IRC_TRANSPORT", err)
+	}
+	connOpts := irc.ConnOpts{
+		Transport: ircTransport,
+		Logger:    ircLogger,
+	}
+
+	// Each command has a default cooldown, which can be overridden in order to limit
+	// how often users may invoke the command
+	cooldownPolicies, err := commands.ParseCooldownPolicies(config.CommandCooldowns)
+	if err != nil {
+		app.Fail("Failed to parse COMMAND_COOLDOWNS", err)
+	}
+	cooldowns := commands.NewCooldowns(commands.CooldownConfig{
+		Policies: cooldownPolicies,
+		Notify:   config.CommandCooldownNotices,
+	})
+
+	// Commands may require users to hold a minimum role in the channel, but specific
+	// users can be granted or denied access to commands regardless of their roles
+	commandAllow, err := commands.ParsePermissionOverrides(config.CommandAllow)
+	if err != nil {
+		app.Fail("Failed to parse COMMAND_ALLOW", err)
+	}
+	commandDeny, err := commands.ParsePermissionOverrides(config.CommandDeny)
+	if err != nil {
+		app.Fail("Failed to parse COMMAND_DENY", err)
+	}
+	// Commands that reply with static text are defined in a config file, which is
+	// reloaded whenever it changes (or on SIGHUP) without interrupting the bot
+	staticCommands, err := commands.LoadStaticCommands(config.CommandsPath)
+	if err != nil {
+		app.Fail("Failed to load commands from COMMANDS_PATH", err)
+	}
+	onCommandsReload := func(err error) {
+		if err != nil {
+			app.Log().Error("Failed to reload commands; keeping previous commands", "path", config.CommandsPath, "error", err)
+		} else {
+			app.Log().Info("Reloaded commands", "path", config.CommandsPath)
+		}
+	}
+	go staticCommands.Watch(ctx, commandsReloadInterval, onCommandsReload)
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				onCommandsReload(staticCommands.Reload())
+			}
+		}
+	}()
+
+	// Moderators can create custom commands from chat, which are saved to disk so that
+	// they persist across restarts
+	customCommands, err := commands.NewCustomCommands(commands.NewCustomStore(config.CustomCommandsPath))
+	if err != nil {
+		app.Fail("Failed to load custom commands from CUSTOM_COMMANDS_PATH", err)
+	}
+
+	commandOpts := commands.HandlerOpts{
+		Cooldowns: cooldowns,
+		Static:    staticCommands,
+		Custom:    customCommands,
+		Permissions: commands.PermissionConfig{
+			Allow: commandAllow,
+			Deny:  commandDeny,
+		},
+	}
+
 	// Initialize an "agent", which is essentially a wrapper for the IRC bot that
 	// maintains exactly one connection at a time, and which can respond to successful
 	// logins by tearing down any existing connection and then initializing a new one
-	// and reconnecting the bot
-	agent := state.NewAgent(ctx, app.Log(), config.TwitchChannelName, config.TwitchBotUsername, messagesChan, chatlogServer.EmitBotMessage, authServiceClient, twitchEventsProducer)
+	// and reconnecting the bot. If the bot fails after connecting, the agent will use
+	// our stored credentials to reconnect it automatically. The agent also uses the
+	// Twitch API to send announcements, which IRC doesn't support.
+	agent := state.NewAgent(ctx, app.Log(), connOpts, channels, config.TwitchBotUsername, messagesChan, chatlogServer.EmitBotMessage, authServiceClient, twitchEventsProducer, tokenStore, twitchClient, twitchClient, commandOpts)
 
 	// The connection server exposes HTTP endpoints related to login and connection
 	// management: we can use GET /status to see whether the chat bot is successfully
@@ -104,18 +283,41 @@ func main() {
 	// Twitch in order to issue a User Access Token, and we can use GET /auth to handle
 	// the redirect at the end of that flow, providing the server with the access token
 	// so that it can connect to IRC as our chat bot user
-	{
-		redirectUri := config.PublicUrl + "/auth"
-		client, err := connection.NewTwitchClient(ctx, config.TwitchClientId, config.TwitchClientSecret, redirectUri)
-		if err != nil {
-			app.Fail("Failed to initialize Twitch client for connection server", err)
-		}
-		tokenStore := tokens.NewStore(config.TokenStoragePath, config.TwitchBotUsername)
-		connectionServer := connection.NewServer(ctx, app.Log(), agent, client, config.TwitchClientId, redirectUri, config.TwitchBotUsername, tokenStore)
-		connectionServer.RegisterRoutes(authClient, r)
-	}
+	connectionServer := connection.NewServer(ctx, app.Log(), agent, twitchClient, config.TwitchClientId, redirectUri, config.TwitchBotUsername, tokenStore)
+	connectionServer.RegisterRoutes(authClient, r)
 
 	// Handle incoming HTTP connections until our top-level context is canceled, at
 	// which point shut down cleanly
 	entry.RunServer(ctx, app.Log(), r, config.BindAddr, config.ListenPort)
+
+	// Once the HTTP server has stopped, take the bot offline gracefully, giving it a
+	// chance to finish responding to any commands it's handling before it leaves chat
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.IrcShutdownTimeout)
+	defer cancelShutdown()
+	if err := agent.Shutdown(shutdownCtx); err != nil {
+		app.Log().Warn("IRC bot did not shut down cleanly", "error", err)
+	} else {
+		app.Log().Info("IRC bot shut down")
+	}
+}
+
+// nonEmpty returns the given list of values, trimmed of whitespace, with any empty
+// values removed
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// upper returns the given list of values converted to uppercase
+func upper(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, strings.ToUpper(value))
+	}
+	return result
 }
@@ -0,0 +1,299 @@
+package chatlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+	"golang.org/x/exp/slog"
+)
+
+// Cheermote describes a family of animated images that Twitch renders in place of
+// tokens like 'Cheer100' in messages that carry bits: the prefix identifies the
+// cheermote, and the amount of bits determines which tier's image is used
+type Cheermote struct {
+	Prefix string          `json:"prefix"`
+	Tiers  []CheermoteTier `json:"tiers"`
+}
+
+// CheermoteTier is the image used for a cheermote when cheering at least MinBits
+type CheermoteTier struct {
+	MinBits int    `json:"minBits"`
+	Url     string `json:"url"`
+}
+
+// CheermoteProvider supplies the catalog of cheermotes that may be used in a channel
+type CheermoteProvider interface {
+	GetCheermotes(ctx context.Context, channelName string) ([]Cheermote, error)
+}
+
+// NewFileCheermoteProvider returns a CheermoteProvider that reads a JSON-serialized
+// array of Cheermote objects from the given file, using the same catalog for every
+// channel
+func NewFileCheermoteProvider(path string) CheermoteProvider {
+	return &fileCheermoteProvider{path: path}
+}
+
+type fileCheermoteProvider struct {
+	path string
+}
+
+func (p *fileCheermoteProvider) GetCheermotes(ctx context.Context, channelName string) ([]Cheermote, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	var cheermotes []Cheermote
+	if err := json.Unmarshal(data, &cheermotes); err != nil {
+		return nil, fmt.Errorf("failed to parse cheermotes from %s: %w", p.path, err)
+	}
+	return cheermotes, nil
+}
+
+// NewTwitchCheermoteProvider returns a CheermoteProvider that queries the Twitch API
+// for the global cheermotes along with any custom cheermotes defined for each
+// channel, authenticating with an app access token for the given client application
+func NewTwitchCheermoteProvider(clientId, clientSecret string) (CheermoteProvider, error) {
+	if clientId == "" {
+		return nil, errors.New("client ID is required")
+	}
+	return &twitchCheermoteProvider{
+		clientId:       clientId,
+		clientSecret:   clientSecret,
+		broadcasterIds: make(map[string]string),
+	}, nil
+}
+
+type twitchCheermoteProvider struct {
+	clientId       string
+	clientSecret   string
+	appAccessToken string
+	broadcasterIds map[string]string
+	mu             sync.Mutex
+}
+
+func (p *twitchCheermoteProvider) GetCheermotes(ctx context.Context, channelName string) ([]Cheermote, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Requests are made with a client bound to ctx, so that they're abandoned if ctx
+	// is canceled
+	c, err := helix.NewClientWithContext(ctx, &helix.Options{
+		ClientID:       p.clientId,
+		ClientSecret:   p.clientSecret,
+		AppAccessToken: p.appAccessToken,
+		HTTPClient:     &http.Client{Timeout: cheermoteRequestTimeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Obtain an app access token if we don't already have a valid one
+	if p.appAccessToken == "" {
+		res, err := c.RequestAppAccessToken([]string{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to request app access token: %w", err)
+		}
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return nil, fmt.Errorf("request for app access token failed with status %d: %s", res.StatusCode, res.ErrorMessage)
+		}
+		p.appAccessToken = res.Data.AccessToken
+		c.SetAppAccessToken(p.appAccessToken)
+	}
+
+	// Resolve the user ID of the channel's broadcaster so that we can include their
+	// custom cheermotes
+	broadcasterId, ok := p.broadcasterIds[channelName]
+	if !ok {
+		res, err := c.GetUsers(&helix.UsersParams{Logins: []string{channelName}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user ID for channel %s: %w", channelName, err)
+		}
+		if res.StatusCode == 401 {
+			p.appAccessToken = ""
+		}
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return nil, fmt.Errorf("request for user ID of channel %s failed with status %d: %s", channelName, res.StatusCode, res.ErrorMessage)
+		}
+		if len(res.Data.Users) != 1 {
+			return nil, fmt.Errorf("request for user ID of channel %s got %d user results; expected exactly 1", channelName, len(res.Data.Users))
+		}
+		broadcasterId = res.Data.Users[0].ID
+		p.broadcasterIds[channelName] = broadcasterId
+	}
+
+	res, err := c.GetCheermotes(&helix.CheermotesParams{BroadcasterID: broadcasterId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cheermotes: %w", err)
+	}
+	if res.StatusCode == 401 {
+		p.appAccessToken = ""
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("request for cheermotes failed with status %d: %s", res.StatusCode, res.ErrorMessage)
+	}
+
+	cheermotes := make([]Cheermote, 0, len(res.Data.Cheermotes))
+	for _, c := range res.Data.Cheermotes {
+		tiers := make([]CheermoteTier, 0, len(c.Tiers))
+		for _, tier := range c.Tiers {
+			tiers = append(tiers, CheermoteTier{
+				MinBits: int(tier.MinBits),
+				Url:     tier.Images.Dark.Animated.Image1,
+			})
+		}
+		cheermotes = append(cheermotes, Cheermote{
+			Prefix: c.Prefix,
+			Tiers:  tiers,
+		})
+	}
+	return cheermotes, nil
+}
+
+// cheermoteCache holds the most recent cheermote catalog obtained for a channel from
+// a CheermoteProvider, refreshing it periodically in the background so that chat
+// messages are never held up by requests to the provider. Refreshes stop once ctx is
+// canceled.
+type cheermoteCache struct {
+	ctx         context.Context
+	provider    CheermoteProvider
+	channelName string
+	logger      *slog.Logger
+	cheermotes  []Cheermote
+	nextRefresh time.Time
+	refreshing  bool
+	mu          sync.Mutex
+}
+
+const (
+	cheermoteRefreshInterval = time.Hour
+	cheermoteRetryInterval   = time.Minute
+	cheermoteRequestTimeout  = 10 * time.Second
+)
+
+// newCheermoteCache initializes a cheermoteCache and immediately begins fetching the
+// channel's catalog from the given provider, if any
+func newCheermoteCache(ctx context.Context, provider CheermoteProvider, channelName string, logger *slog.Logger) *cheermoteCache {
+	c := &cheermoteCache{ctx: ctx, provider: provider, channelName: channelName, logger: logger}
+	c.get()
+	return c
+}
+
+// get returns the last cheermote catalog successfully obtained from the provider,
+// without blocking: if the catalog is due for a refresh, a new one is fetched in the
+// background, and the last-known catalog is retained if that fails
+func (c *cheermoteCache) get() []Cheermote {
+	if c.provider == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.refreshing && !time.Now().Before(c.nextRefresh) && c.ctx.Err() == nil {
+		c.refreshing = true
+		go c.refresh()
+	}
+	return c.cheermotes
+}
+
+// refresh fetches a new catalog from the provider, then schedules the next refresh
+func (c *cheermoteCache) refresh() {
+	cheermotes, err := c.provider.GetCheermotes(c.ctx, c.channelName)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	if c.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		c.logger.Error("Failed to get cheermotes", "channel", c.channelName, "error", err)
+		c.nextRefresh = time.Now().Add(cheermoteRetryInterval)
+		return
+	}
+	c.cheermotes = cheermotes
+	c.nextRefresh = time.Now().Add(cheermoteRefreshInterval)
+}
+
+// substituteCheermotes takes the body of a PRIVMSG, already formatted by
+// substituteEmotes, and replaces each cheermote token (e.g. 'Cheer100') with a '$N'
+// reference to a new EmoteDetails entry, using the image for the tier that
+// corresponds to the number of bits in that token
+func substituteCheermotes(text string, emotes []EmoteDetails, cheermotes []Cheermote) (string, []EmoteDetails) {
+	if len(cheermotes) == 0 {
+		return text, emotes
+	}
+
+	tokens := strings.Split(text, " ")
+	indicesByName := make(map[string]int)
+	for tokenIndex, token := range tokens {
+		// Identical cheermote tokens share a single entry in the emotes array
+		if emoteIndex, ok := indicesByName[token]; ok {
+			tokens[tokenIndex] = fmt.Sprintf("$%d", emoteIndex)
+			continue
+		}
+
+		cheermote, bits, ok := matchCheermote(token, cheermotes)
+		if !ok {
+			continue
+		}
+		url, ok := resolveCheermoteUrl(cheermote, bits)
+		if !ok {
+			continue
+		}
+		emoteIndex := len(emotes)
+		emotes = append(emotes, EmoteDetails{
+			Name: token,
+			Url:  url,
+			Bits: bits,
+		})
+		indicesByName[token] = emoteIndex
+		tokens[tokenIndex] = fmt.Sprintf("$%d", emoteIndex)
+	}
+	return strings.Join(tokens, " "), emotes
+}
+
+// matchCheermote checks whether the given token consists of a known cheermote prefix
+// (matched case-insensitively) followed by a positive number of bits
+func matchCheermote(token string, cheermotes []Cheermote) (*Cheermote, int, bool) {
+	for i := range cheermotes {
+		prefix := cheermotes[i].Prefix
+		if prefix == "" || len(token) <= len(prefix) || !strings.EqualFold(token[:len(prefix)], prefix) {
+			continue
+		}
+		amount := token[len(prefix):]
+		if strings.TrimLeft(amount, "0123456789") != "" {
+			continue
+		}
+		bits, err := strconv.Atoi(amount)
+		if err != nil || bits <= 0 {
+			continue
+		}
+		return &cheermotes[i], bits, true
+	}
+	return nil, 0, false
+}
+
+// resolveCheermoteUrl returns the image URL for the highest tier of the given
+// cheermote whose minimum is satisfied by the given number of bits
+func resolveCheermoteUrl(cheermote *Cheermote, bits int) (string, bool) {
+	tiers := make([]CheermoteTier, len(cheermote.Tiers))
+	copy(tiers, cheermote.Tiers)
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].MinBits > tiers[j].MinBits
+	})
+	for _, tier := range tiers {
+		if bits >= tier.MinBits && tier.Url != "" {
+			return tier.Url, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,186 @@
+package chatlog
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+)
+
+func Test_substituteCheermotes(t *testing.T) {
+	cheermotes, err := NewFileCheermoteProvider("testdata/cheermotes.json").GetCheermotes(context.Background(), "goldenvcr")
+	assert.NoError(t, err)
+
+	cheerUrl := func(bits string) string {
+		return "https://d3aqoihi2n8ty8.cloudfront.net/actions/cheer/dark/animated/" + bits + "/1.gif"
+	}
+	emote := EmoteDetails{
+		Name: "wasabi22Denton",
+		Url:  "https://static-cdn.jtvnw.net/emoticons/v2/emotesv2_9d94d65bbef64763b7c09401156ea0bc/default/dark/1.0",
+	}
+
+	tests := []struct {
+		name       string
+		text       string
+		emotes     []EmoteDetails
+		cheermotes []Cheermote
+		wantText   string
+		wantEmotes []EmoteDetails
+	}{
+		{
+			"no cheermotes in catalog",
+			"Cheer100 hello",
+			[]EmoteDetails{},
+			nil,
+			"Cheer100 hello",
+			[]EmoteDetails{},
+		},
+		{
+			"single cheermote",
+			"Cheer100 hello",
+			[]EmoteDetails{},
+			cheermotes,
+			"$0 hello",
+			[]EmoteDetails{
+				{Name: "Cheer100", Url: cheerUrl("100"), Bits: 100},
+			},
+		},
+		{
+			"tier is selected by amount",
+			"Cheer1 Cheer99 Cheer1500 Cheer20000",
+			[]EmoteDetails{},
+			cheermotes,
+			"$0 $1 $2 $3",
+			[]EmoteDetails{
+				{Name: "Cheer1", Url: cheerUrl("1"), Bits: 1},
+				{Name: "Cheer99", Url: cheerUrl("1"), Bits: 99},
+				{Name: "Cheer1500", Url: cheerUrl("1000"), Bits: 1500},
+				{Name: "Cheer20000", Url: cheerUrl("10000"), Bits: 20000},
+			},
+		},
+		{
+			"prefix is matched case-insensitively",
+			"cheer100 biblethump100",
+			[]EmoteDetails{},
+			cheermotes,
+			"$0 $1",
+			[]EmoteDetails{
+				{Name: "cheer100", Url: cheerUrl("100"), Bits: 100},
+				{Name: "biblethump100", Url: "https://d3aqoihi2n8ty8.cloudfront.net/actions/biblethump/dark/animated/100/1.gif", Bits: 100},
+			},
+		},
+		{
+			"tokens that are not cheermotes are left as-is",
+			"Cheerful Cheer Cheer0 Cheer10x Kappa100 $$5",
+			[]EmoteDetails{},
+			cheermotes,
+			"Cheerful Cheer Cheer0 Cheer10x Kappa100 $$5",
+			[]EmoteDetails{},
+		},
+		{
+			"cheermotes are indexed after existing emotes",
+			"$0 Cheer50 $0",
+			[]EmoteDetails{emote},
+			cheermotes,
+			"$0 $1 $0",
+			[]EmoteDetails{
+				emote,
+				{Name: "Cheer50", Url: cheerUrl("1"), Bits: 50},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotText, gotEmotes := substituteCheermotes(tt.text, tt.emotes, tt.cheermotes)
+			assert.Equal(t, tt.wantText, gotText)
+			assert.Equal(t, tt.wantEmotes, gotEmotes)
+		})
+	}
+}
+
+func Test_cheermoteCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider := &blockingCheermoteProvider{
+		cheermotes: []Cheermote{{Prefix: "Cheer", Tiers: []CheermoteTier{{MinBits: 1, Url: "https://example.com/1.gif"}}}},
+		release:    make(chan struct{}),
+	}
+	c := newCheermoteCache(ctx, provider, "goldenvcr", slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// While the provider is blocked, the cache should return immediately with the
+	// last-known catalog (i.e. nothing yet), without starting another request
+	assert.Eventually(t, func() bool {
+		return provider.calls.Load() == 1
+	}, time.Second, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, c.get())
+	}
+	assert.Equal(t, int32(1), provider.calls.Load())
+
+	// Once the provider responds, the new catalog should be used
+	close(provider.release)
+	assert.Eventually(t, func() bool {
+		return len(c.get()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), provider.calls.Load())
+	assert.Equal(t, []string{"goldenvcr"}, provider.getChannelNames())
+}
+
+func Test_cheermoteCache_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &blockingCheermoteProvider{release: make(chan struct{})}
+	c := newCheermoteCache(ctx, provider, "goldenvcr", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.Eventually(t, func() bool {
+		return provider.calls.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	// Once ctx is canceled, the request in flight should be abandoned, and no further
+	// requests should be made
+	cancel()
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return !c.refreshing
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, c.get())
+	assert.Equal(t, int32(1), provider.calls.Load())
+}
+
+// blockingCheermoteProvider returns a fixed catalog, but only once release is closed,
+// and records the channels for which catalogs were requested
+type blockingCheermoteProvider struct {
+	cheermotes   []Cheermote
+	release      chan struct{}
+	calls        atomic.Int32
+	channelNames []string
+	mu           sync.Mutex
+}
+
+func (p *blockingCheermoteProvider) GetCheermotes(ctx context.Context, channelName string) ([]Cheermote, error) {
+	p.calls.Add(1)
+	p.mu.Lock()
+	p.channelNames = append(p.channelNames, channelName)
+	p.mu.Unlock()
+	select {
+	case <-p.release:
+		return p.cheermotes, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// getChannelNames returns the channels for which catalogs have been requested, sorted
+// by name
+func (p *blockingCheermoteProvider) getChannelNames() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	channelNames := append([]string{}, p.channelNames...)
+	sort.Strings(channelNames)
+	return channelNames
+}
@@ -3,17 +3,20 @@ package chatlog
 import (
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/golden-vcr/chatbot/internal/irc"
 )
 
 var ErrIgnored = errors.New("message ignored")
 
-func EventFromMessage(message *irc.Message) (*Event, error) {
+// EventFromMessage converts an IRC message to the chatlog event that it represents,
+// using the given catalog of cheermotes to render any cheers in chat messages
+func EventFromMessage(message *irc.Message, cheermotes []Cheermote) (*Event, error) {
 	switch message.Type {
 	case "PRIVMSG":
 		// PRIVMSG indicates that a user has sent a message in chat
-		return eventFromPrivmsg(message)
+		return eventFromPrivmsg(message, cheermotes)
 	case "CLEARMSG":
 		// CLEARMSG indicates that a mod has deleted a single message by ID
 		return eventFromClearmsg(message)
@@ -21,78 +24,100 @@ func EventFromMessage(message *irc.Message) (*Event, error) {
 		// CLEARCHAT either clears the entire log or deletes all messages for a single
 		// user, depending on whether the 'target-user-id' attribute is set
 		return eventFromClearchat(message)
+	case "USERNOTICE":
+		// USERNOTICE indicates that a user has subscribed, gifted subs, raided, etc.
+		return eventFromUsernotice(message)
 	}
 	return nil, ErrIgnored
 }
 
-func eventFromPrivmsg(message *irc.Message) (*Event, error) {
-	messageId := message.Extra["id"]
-	if messageId == "" {
-		return nil, fmt.Errorf("missing extra attribute 'id'")
-	}
-
-	userId := message.Extra["user-id"]
-	if userId == "" {
-		return nil, fmt.Errorf("missing extra attribute 'user-id'")
-	}
-
-	username := message.Extra["display-name"]
-	if username == "" {
-		return nil, fmt.Errorf("missing extra attribute 'display-name'")
+func eventFromPrivmsg(message *irc.Message, cheermotes []Cheermote) (*Event, error) {
+	pm, err := irc.ParsePrivmsg(message)
+	if err != nil {
+		return nil, err
 	}
 
-	color := message.Extra["color"]
+	color := pm.Color
 	if color == "" {
 		color = "#FFFFFF"
 	}
 
-	emoteInfos, err := parseEmotes(message.Extra["emotes"])
+	emoteInfos, err := parseEmotes(pm.Emotes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse extra attribute 'emotes': %w", err)
 	}
-	text, emotes, err := substituteEmotes(message.Body, emoteInfos)
+	text, emotes, err := substituteEmotes(pm.Text, emoteInfos)
 	if err != nil {
 		return nil, fmt.Errorf("failed to substitute emotes: %w", err)
 	}
 
+	// If the user cheered with the message, render any cheermotes in the same manner
+	// as emotes
+	if pm.Bits > 0 {
+		text, emotes = substituteCheermotes(text, emotes, cheermotes)
+	}
+
+	// If the message was sent as a reply to another message, include the details of
+	// the parent message
+	var reply *ReplyDetails
+	if pm.Reply != nil {
+		reply = &ReplyDetails{
+			MessageId: pm.Reply.MessageId,
+			UserId:    pm.Reply.UserId,
+			Username:  pm.Reply.DisplayName,
+			Text:      pm.Reply.Text,
+		}
+	}
+
+	// Include the user's badges and roles so that they can be displayed alongside the
+	// message
+	userRoles := pm.Roles()
+
 	return &Event{
 		Type: EventTypeAppend,
 		Payload: &Payload{
 			Append: &PayloadAppend{
-				MessageId: messageId,
-				UserId:    userId,
-				Username:  username,
+				MessageId: pm.MessageId,
+				UserId:    pm.UserId,
+				Username:  pm.DisplayName,
 				Color:     color,
 				Text:      text,
 				Emotes:    emotes,
+				Bits:      pm.Bits,
+				Reply:     reply,
+				Badges:    pm.Badges,
+				Roles:     &userRoles,
 			},
 		},
 	}, nil
 }
 
 func eventFromClearmsg(msg *irc.Message) (*Event, error) {
-	messageId := msg.Extra["target-msg-id"]
-	if messageId == "" {
-		return nil, fmt.Errorf("missing extra attribute 'target-msg-id'")
+	clearmsg, err := irc.ParseClearmsg(msg)
+	if err != nil {
+		return nil, err
 	}
 	return &Event{
 		Type: EventTypeDelete,
 		Payload: &Payload{
 			Delete: &PayloadDelete{
-				MessageId: messageId,
+				MessageId: clearmsg.TargetMessageId,
 			},
 		},
 	}, nil
 }
 
 func eventFromClearchat(msg *irc.Message) (*Event, error) {
-	userId := msg.Extra["target-user-id"]
-	if userId != "" {
+	clearchat, err := irc.ParseClearchat(msg)
+	if err != nil {
+		return nil, err
+	}
+	if clearchat.TargetUserId != "" {
 		return &Event{
 			Type: EventTypeBan,
 			Payload: &Payload{
 				Ban: &PayloadBan{
-					UserId: userId,
+					UserId: clearchat.TargetUserId,
 				},
 			},
 		}, nil
@@ -101,3 +126,84 @@ func eventFromClearchat(msg *irc.Message) (*Event, error) {
 		Type: EventTypeClear,
 	}, nil
 }
+
+func eventFromUsernotice(msg *irc.Message) (*Event, error) {
+	un, err := irc.ParseUsernotice(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine which type of event to display based on the msg-id, ignoring any
+	// USERNOTICE that we don't display in the chatlog
+	var eventType EventType
+	switch un.Kind {
+	case "sub", "resub":
+		eventType = EventTypeSubscription
+	case "subgift", "submysterygift":
+		// When a user gifts subs to several random viewers at once, we get a single
+		// 'submysterygift' followed by a 'subgift' for each recipient: we display only
+		// the former
+		if un.Kind == "subgift" && un.Params["community-gift-id"] != "" {
+			return nil, ErrIgnored
+		}
+		eventType = EventTypeGiftSub
+	case "raid":
+		eventType = EventTypeRaid
+	case "announcement":
+		eventType = EventTypeAnnouncement
+	default:
+		return nil, ErrIgnored
+	}
+
+	color := un.Color
+	if color == "" {
+		color = "#FFFFFF"
+	}
+
+	emoteInfos, err := parseEmotes(un.Emotes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse extra attribute 'emotes': %w", err)
+	}
+	text, emotes, err := substituteEmotes(un.Text, emoteInfos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to substitute emotes: %w", err)
+	}
+
+	payload := &PayloadNotice{
+		MessageId:     un.MessageId,
+		UserId:        un.UserId,
+		Username:      un.DisplayName,
+		Color:         color,
+		SystemMessage: un.SystemMessage,
+		Text:          text,
+		Emotes:        emotes,
+	}
+	switch un.Kind {
+	case "sub", "resub":
+		payload.Months = parseIntParam(un.Params, "cumulative-months")
+	case "subgift":
+		payload.NumGifts = 1
+		payload.Recipient = un.Params["recipient-display-name"]
+	case "submysterygift":
+		payload.NumGifts = parseIntParam(un.Params, "mass-gift-count")
+	case "raid":
+		payload.NumRaiders = parseIntParam(un.Params, "viewerCount")
+	}
+
+	return &Event{
+		Type: eventType,
+		Payload: &Payload{
+			Notice: payload,
+		},
+	}, nil
+}
+
+// parseIntParam returns the integer value of a USERNOTICE msg-param, or 0 if the param
+// is absent or invalid
+func parseIntParam(params map[string]string, key string) int {
+	n, err := strconv.Atoi(params[key])
+	if err != nil {
+		return 0
+	}
+	return n
+}
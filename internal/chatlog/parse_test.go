@@ -1,13 +1,18 @@
 package chatlog
 
 import (
+	"context"
 	"testing"
 
 	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/roles"
 	"github.com/stretchr/testify/assert"
 )
 
 func Test_EventFromMessage(t *testing.T) {
+	cheermotes, err := NewFileCheermoteProvider("testdata/cheermotes.json").GetCheermotes(context.Background(), "goldenvcr")
+	assert.NoError(t, err)
+
 	tests := []struct {
 		name    string
 		message *irc.Message
@@ -74,6 +79,58 @@ func Test_EventFromMessage(t *testing.T) {
 						Color:     "#00FF7F",
 						Text:      "hello world, this is a test",
 						Emotes:    []EmoteDetails{},
+						Badges:    []roles.Badge{{Name: "bits", Version: "100"}},
+						Roles:     &roles.Set{},
+					},
+				},
+			},
+		},
+		{
+			"PRIVMSG in reply to another message",
+			&irc.Message{
+				Extra: map[string]string{
+					"badge-info":                "",
+					"badges":                    "",
+					"color":                     "#00FF7F",
+					"display-name":              "wasabimilkshake",
+					"emotes":                    "",
+					"id":                        "c1e3cdd4-5e1f-4a51-8b2b-3d8a4a8d28b6",
+					"reply-parent-display-name": "TapeBoy",
+					"reply-parent-msg-body":     "You have 400 fun points available.",
+					"reply-parent-msg-id":       "ad6d1481-1471-4538-900a-493704fc60c5",
+					"reply-parent-user-id":      "1001686376",
+					"reply-parent-user-login":   "tapeboy",
+					"room-id":                   "953753877",
+					"tmi-sent-ts":               "1707193714879",
+					"user-id":                   "90790024",
+					"user-type":                 "",
+				},
+				Prefix: "wasabimilkshake!wasabimilkshake@wasabimilkshake.tmi.twitch.tv",
+				Type:   "PRIVMSG",
+				Params: []string{
+					"#goldenvcr",
+				},
+				Body: "@TapeBoy thanks",
+			},
+			nil,
+			&Event{
+				Type: EventTypeAppend,
+				Payload: &Payload{
+					Append: &PayloadAppend{
+						MessageId: "c1e3cdd4-5e1f-4a51-8b2b-3d8a4a8d28b6",
+						UserId:    "90790024",
+						Username:  "wasabimilkshake",
+						Color:     "#00FF7F",
+						Text:      "@TapeBoy thanks",
+						Emotes:    []EmoteDetails{},
+						Reply: &ReplyDetails{
+							MessageId: "ad6d1481-1471-4538-900a-493704fc60c5",
+							UserId:    "1001686376",
+							Username:  "TapeBoy",
+							Text:      "You have 400 fun points available.",
+						},
+						Badges: []roles.Badge{},
+						Roles:  &roles.Set{},
 					},
 				},
 			},
@@ -126,12 +183,14 @@ func Test_EventFromMessage(t *testing.T) {
 								Url:  "https://static-cdn.jtvnw.net/emoticons/v2/emotesv2_9fa2491b63344c15a7e1e2fea713a6e2/default/dark/1.0",
 							},
 						},
+						Badges: []roles.Badge{{Name: "bits", Version: "100"}},
+						Roles:  &roles.Set{},
 					},
 				},
 			},
 		},
 		{
-			"PRIVMSG with cheer", // cheermote handling NYI
+			"PRIVMSG with cheer",
 			&irc.Message{
 				Extra: map[string]string{
 					"badge-info":        "subscriber/2",
@@ -168,8 +227,21 @@ func Test_EventFromMessage(t *testing.T) {
 						UserId:    "230460108",
 						Username:  "TheBellaBunny",
 						Color:     "#D2691E",
-						Text:      "Cheer100 Cheer100 ghost of a tiny man wearing a large bowler hat drinking from a penguin shaped glass",
-						Emotes:    []EmoteDetails{},
+						Text:      "$0 $0 ghost of a tiny man wearing a large bowler hat drinking from a penguin shaped glass",
+						Emotes: []EmoteDetails{
+							{
+								Name: "Cheer100",
+								Url:  "https://d3aqoihi2n8ty8.cloudfront.net/actions/cheer/dark/animated/100/1.gif",
+								Bits: 100,
+							},
+						},
+						Bits: 200,
+						Badges: []roles.Badge{
+							{Name: "moderator", Version: "1"},
+							{Name: "subscriber", Version: "0"},
+							{Name: "bits", Version: "100"},
+						},
+						Roles: &roles.Set{Moderator: true, Subscriber: true, SubscriberMonths: 2},
 					},
 				},
 			},
@@ -243,10 +315,181 @@ func Test_EventFromMessage(t *testing.T) {
 				Type: EventTypeClear,
 			},
 		},
+		{
+			"USERNOTICE for resub with message",
+			&irc.Message{
+				Extra: map[string]string{
+					"badge-info":                    "subscriber/7",
+					"badges":                        "subscriber/6",
+					"color":                         "#00FF7F",
+					"display-name":                  "wasabimilkshake",
+					"emotes":                        "emotesv2_9d94d65bbef64763b7c09401156ea0bc:6-19",
+					"id":                            "9a7ef3f2-3f66-4b46-8ec7-0f4a1c4e0d5e",
+					"login":                         "wasabimilkshake",
+					"msg-id":                        "resub",
+					"msg-param-cumulative-months":   "7",
+					"msg-param-months":              "0",
+					"msg-param-should-share-streak": "0",
+					"msg-param-sub-plan":            "1000",
+					"msg-param-sub-plan-name":       "Channel Subscription (goldenvcr)",
+					"room-id":                       "953753877",
+					"system-msg":                    "wasabimilkshake subscribed at Tier 1. They've subscribed for 7 months!",
+					"tmi-sent-ts":                   "1707193714879",
+					"user-id":                       "90790024",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "USERNOTICE",
+				Params: []string{
+					"#goldenvcr",
+				},
+				Body: "still wasabi22Denton",
+			},
+			nil,
+			&Event{
+				Type: EventTypeSubscription,
+				Payload: &Payload{
+					Notice: &PayloadNotice{
+						MessageId:     "9a7ef3f2-3f66-4b46-8ec7-0f4a1c4e0d5e",
+						UserId:        "90790024",
+						Username:      "wasabimilkshake",
+						Color:         "#00FF7F",
+						SystemMessage: "wasabimilkshake subscribed at Tier 1. They've subscribed for 7 months!",
+						Text:          "still $0",
+						Emotes: []EmoteDetails{
+							{
+								Name: "wasabi22Denton",
+								Url:  "https://static-cdn.jtvnw.net/emoticons/v2/emotesv2_9d94d65bbef64763b7c09401156ea0bc/default/dark/1.0",
+							},
+						},
+						Months: 7,
+					},
+				},
+			},
+		},
+		{
+			"USERNOTICE for gift bomb",
+			&irc.Message{
+				Extra: map[string]string{
+					"color":                       "",
+					"display-name":                "wasabimilkshake",
+					"emotes":                      "",
+					"id":                          "5a1c04f0-7e7c-4c8f-93a4-1f7c7b9e1b1d",
+					"login":                       "wasabimilkshake",
+					"msg-id":                      "submysterygift",
+					"msg-param-community-gift-id": "4306186931405538738",
+					"msg-param-mass-gift-count":   "5",
+					"msg-param-sub-plan":          "1000",
+					"room-id":                     "953753877",
+					"system-msg":                  "wasabimilkshake is gifting 5 Tier 1 Subs to goldenvcr's community!",
+					"user-id":                     "90790024",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "USERNOTICE",
+				Params: []string{
+					"#goldenvcr",
+				},
+			},
+			nil,
+			&Event{
+				Type: EventTypeGiftSub,
+				Payload: &Payload{
+					Notice: &PayloadNotice{
+						MessageId:     "5a1c04f0-7e7c-4c8f-93a4-1f7c7b9e1b1d",
+						UserId:        "90790024",
+						Username:      "wasabimilkshake",
+						Color:         "#FFFFFF",
+						SystemMessage: "wasabimilkshake is gifting 5 Tier 1 Subs to goldenvcr's community!",
+						Emotes:        []EmoteDetails{},
+						NumGifts:      5,
+					},
+				},
+			},
+		},
+		{
+			"USERNOTICE for individual gift sub within a gift bomb is ignored",
+			&irc.Message{
+				Extra: map[string]string{
+					"display-name":                     "wasabimilkshake",
+					"id":                               "d1e2f3a4-0000-4000-8000-000000000001",
+					"login":                            "wasabimilkshake",
+					"msg-id":                           "subgift",
+					"msg-param-community-gift-id":      "4306186931405538738",
+					"msg-param-recipient-display-name": "Someone",
+					"msg-param-recipient-id":           "42",
+					"msg-param-sub-plan":               "1000",
+					"user-id":                          "90790024",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "USERNOTICE",
+				Params: []string{
+					"#goldenvcr",
+				},
+			},
+			ErrIgnored,
+			nil,
+		},
+		{
+			"USERNOTICE for raid",
+			&irc.Message{
+				Extra: map[string]string{
+					"color":                 "#9ACD32",
+					"display-name":          "SomeStreamer",
+					"emotes":                "",
+					"id":                    "3d830f12-795c-447d-af3c-ea05e40fbddb",
+					"login":                 "somestreamer",
+					"msg-id":                "raid",
+					"msg-param-displayName": "SomeStreamer",
+					"msg-param-login":       "somestreamer",
+					"msg-param-viewerCount": "15",
+					"room-id":               "953753877",
+					"system-msg":            "15 raiders from SomeStreamer have joined!",
+					"user-id":               "123456",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "USERNOTICE",
+				Params: []string{
+					"#goldenvcr",
+				},
+			},
+			nil,
+			&Event{
+				Type: EventTypeRaid,
+				Payload: &Payload{
+					Notice: &PayloadNotice{
+						MessageId:     "3d830f12-795c-447d-af3c-ea05e40fbddb",
+						UserId:        "123456",
+						Username:      "SomeStreamer",
+						Color:         "#9ACD32",
+						SystemMessage: "15 raiders from SomeStreamer have joined!",
+						Emotes:        []EmoteDetails{},
+						NumRaiders:    15,
+					},
+				},
+			},
+		},
+		{
+			"USERNOTICE of an unsupported type is ignored",
+			&irc.Message{
+				Extra: map[string]string{
+					"display-name": "wasabimilkshake",
+					"id":           "0b7a1f53-7a41-4a53-9a49-9e2d0d2b6f3c",
+					"login":        "wasabimilkshake",
+					"msg-id":       "bitsbadgetier",
+					"user-id":      "90790024",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "USERNOTICE",
+				Params: []string{
+					"#goldenvcr",
+				},
+			},
+			ErrIgnored,
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := EventFromMessage(tt.message)
+			got, err := EventFromMessage(tt.message, cheermotes)
 			if tt.wantErr != nil {
 				assert.ErrorIs(t, err, tt.wantErr)
 				assert.Nil(t, got)
@@ -3,8 +3,10 @@ package chatlog
 import (
 	"context"
 	"errors"
+	"strings"
 
 	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/outbound"
 	"github.com/golden-vcr/server-common/sse"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -12,41 +14,92 @@ import (
 )
 
 type Server struct {
+	channels     map[string]*channelLog
+	channelOrder []string
+}
+
+// channelLog holds the recent events for a single channel, along with the channel
+// into which new events are written for delivery to SSE clients
+type channelLog struct {
 	mb         *eventBuffer
 	eventsChan chan *Event
+	cheermotes *cheermoteCache
 }
 
-func NewServer(ctx context.Context, logger *slog.Logger, messagesChan <-chan *irc.Message) *Server {
-	mb := newEventBuffer(128)
-	eventsChan := make(chan *Event, 32)
+// NewServer initializes a chatlog server that serves a separate stream of events for
+// each of the given channels, the first of which is also served as the default stream
+func NewServer(ctx context.Context, logger *slog.Logger, channelNames []string, messagesChan <-chan *irc.Message, cheermotes CheermoteProvider) *Server {
+	s := &Server{
+		channels:     make(map[string]*channelLog, len(channelNames)),
+		channelOrder: channelNames,
+	}
+	for _, name := range channelNames {
+		s.channels[name] = &channelLog{
+			mb:         newEventBuffer(128),
+			eventsChan: make(chan *Event, 32),
+			cheermotes: newCheermoteCache(ctx, cheermotes, name, logger),
+		}
+	}
 
 	go func() {
 		for message := range messagesChan {
-			ev, err := EventFromMessage(message)
+			cl := s.channels[channelFromMessage(message)]
+			if cl == nil {
+				continue
+			}
+			// Cheermotes are only needed to render messages that carry bits
+			var cheermotes []Cheermote
+			if message.Extra["bits"] != "" {
+				cheermotes = cl.cheermotes.get()
+			}
+			ev, err := EventFromMessage(message, cheermotes)
 			if err != nil {
 				if !errors.Is(err, ErrIgnored) {
 					logger.Error("Failed to generate chatlog event from IRC message",
-						"message", message,
+						"messageType", message.Type,
 						"error", err,
 					)
 				}
 			} else {
 				ev.eventStreamId = uuid.NewString()
-				logger.Info("Propagating chatlog event", "chatlogEvent", ev)
-				mb.push(ev)
-				eventsChan <- ev
+				// The event itself isn't logged, since IRC traffic is logged subject to
+				// the configured LogPolicy, which may redact user details
+				logger.Debug("Propagating chatlog event", "type", ev.Type)
+				cl.push(ev)
 			}
 		}
 	}()
 
-	return &Server{
-		mb:         mb,
-		eventsChan: eventsChan,
-	}
+	return s
 }
 
+// RegisterRoutes serves the chatlog for each channel at /chatlog/{channel}, and the
+// chatlog for the first channel at /chatlog
 func (s *Server) RegisterRoutes(ctx context.Context, r *mux.Router) {
-	h := sse.NewHandler[*Event](ctx, s.eventsChan)
+	for i, name := range s.channelOrder {
+		h := s.channels[name].handler(ctx)
+		r.Path("/chatlog/" + name).Methods("GET").Handler(h)
+		if i == 0 {
+			r.Path("/chatlog").Methods("GET").Handler(h)
+		}
+	}
+}
+
+// push records a new event and sends it to all connected clients. It never blocks: if
+// clients aren't keeping up (or we're shutting down and no longer serving them), the
+// event is only buffered, and clients can catch up on reconnecting with Last-Event-ID.
+// Otherwise, a stalled client would stall the bot, which sends us every IRC message.
+func (cl *channelLog) push(ev *Event) {
+	cl.mb.push(ev)
+	select {
+	case cl.eventsChan <- ev:
+	default:
+	}
+}
+
+// handler returns an SSE handler that streams the channel's events
+func (cl *channelLog) handler(ctx context.Context) *sse.Handler[*Event] {
+	h := sse.NewHandler[*Event](ctx, cl.eventsChan)
 	h.ResolveEventId = func(ev *Event) string {
 		return ev.eventStreamId
 	}
@@ -54,11 +107,11 @@ func (s *Server) RegisterRoutes(ctx context.Context, r *mux.Router) {
 		// If no Last-Event-ID is specified, just send an initial burst of the N most
 		// recent events, up to a reasonable limit
 		if lastEventId == "" {
-			return s.mb.take(64)
+			return cl.mb.take(64)
 		}
 
 		// Otherwise, take all events from the buffer so we can scan for event ID
-		events := s.mb.take(s.mb.size)
+		events := cl.mb.take(cl.mb.size)
 
 		// Find the index where our last-received event appears
 		lastEventIndex := -1
@@ -74,11 +127,25 @@ func (s *Server) RegisterRoutes(ctx context.Context, r *mux.Router) {
 		// last event must be so old that we don't remember it
 		return events[lastEventIndex+1:]
 	}
-
-	r.Path("/chatlog").Methods("GET").Handler(h)
+	return h
 }
 
-func (s *Server) EmitBotMessage(text string) {
+// EmitBotMessage records a message that the bot has sent to the given channel
+func (s *Server) EmitBotMessage(channel string, m outbound.Message) {
+	cl := s.channels[channel]
+	if cl == nil {
+		return
+	}
+
+	var reply *ReplyDetails
+	if m.ReplyParent != nil {
+		reply = &ReplyDetails{
+			MessageId: m.ReplyParent.MessageId,
+			UserId:    m.ReplyParent.UserId,
+			Username:  m.ReplyParent.Username,
+			Text:      m.ReplyParent.Text,
+		}
+	}
 	ev := &Event{
 		Type: EventTypeAppend,
 		Payload: &Payload{
@@ -87,12 +154,21 @@ func (s *Server) EmitBotMessage(text string) {
 				UserId:    "_BOT_",
 				Username:  "_BOT_",
 				Color:     "#FFFFFF",
-				Text:      text,
+				Text:      m.Text,
 				Emotes:    []EmoteDetails{},
+				Reply:     reply,
 			},
 		},
 		eventStreamId: uuid.NewString(),
 	}
-	s.mb.push(ev)
-	s.eventsChan <- ev
+	cl.push(ev)
+}
+
+// channelFromMessage returns the name of the channel (without the leading '#') that
+// an IRC message pertains to, or an empty string if it isn't specific to a channel
+func channelFromMessage(message *irc.Message) string {
+	if len(message.Params) > 0 && strings.HasPrefix(message.Params[0], "#") {
+		return message.Params[0][1:]
+	}
+	return ""
 }
@@ -0,0 +1,103 @@
+package chatlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+)
+
+func Test_Server_separatesChannels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	messagesChan := make(chan *irc.Message)
+	defer close(messagesChan)
+	s := NewServer(ctx, logger, []string{"goldenvcr", "wasabimilkshake"}, messagesChan, nil)
+
+	// Messages should be logged only for the channel in which they were sent, and
+	// messages from unknown channels should be dropped
+	for _, channel := range []string{"goldenvcr", "wasabimilkshake", "somewhereelse"} {
+		messagesChan <- &irc.Message{
+			Extra: map[string]string{
+				"display-name": "wasabimilkshake",
+				"emotes":       "",
+				"id":           "message-in-" + channel,
+				"user-id":      "90790024",
+			},
+			Prefix: "wasabimilkshake!wasabimilkshake@wasabimilkshake.tmi.twitch.tv",
+			Type:   "PRIVMSG",
+			Params: []string{"#" + channel},
+			Body:   "hello",
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return len(s.channels["wasabimilkshake"].mb.take(8)) == 1
+	}, time.Second, time.Millisecond)
+
+	// Messages sent by the bot should likewise be logged for the appropriate channel
+	s.EmitBotMessage("wasabimilkshake", outbound.Message{Text: "hi"})
+	s.EmitBotMessage("somewhereelse", outbound.Message{Text: "hi"})
+
+	events := s.channels["goldenvcr"].mb.take(8)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "message-in-goldenvcr", events[0].Payload.Append.MessageId)
+	events = s.channels["wasabimilkshake"].mb.take(8)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "message-in-wasabimilkshake", events[0].Payload.Append.MessageId)
+	assert.Equal(t, "_BOT_", events[1].Payload.Append.UserId)
+}
+
+func Test_Server_doesNotWaitForCheermotes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	messagesChan := make(chan *irc.Message)
+	defer close(messagesChan)
+	provider := &blockingCheermoteProvider{release: make(chan struct{})}
+	defer close(provider.release)
+	s := NewServer(ctx, logger, []string{"goldenvcr", "wasabimilkshake"}, messagesChan, provider)
+
+	// Each channel's catalog should be requested separately, since each channel may
+	// have its own custom cheermotes
+	assert.Eventually(t, func() bool {
+		return provider.calls.Load() == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"goldenvcr", "wasabimilkshake"}, provider.getChannelNames())
+
+	// Messages should be logged even while the cheermote catalog can't be fetched,
+	// whether or not they carry bits
+	for i, bits := range []string{"", "100"} {
+		extra := map[string]string{
+			"display-name": "wasabimilkshake",
+			"emotes":       "",
+			"id":           fmt.Sprintf("message-%d", i),
+			"user-id":      "90790024",
+		}
+		if bits != "" {
+			extra["bits"] = bits
+		}
+		select {
+		case messagesChan <- &irc.Message{
+			Extra:  extra,
+			Prefix: "wasabimilkshake!wasabimilkshake@wasabimilkshake.tmi.twitch.tv",
+			Type:   "PRIVMSG",
+			Params: []string{"#goldenvcr"},
+			Body:   "Cheer" + bits + " hello",
+		}:
+		case <-time.After(time.Second):
+			t.Fatalf("chatlog server blocked on message %d", i)
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return len(s.channels["goldenvcr"].mb.take(8)) == 2
+	}, time.Second, time.Millisecond)
+}
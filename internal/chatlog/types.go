@@ -1,6 +1,10 @@
 package chatlog
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/golden-vcr/chatbot/internal/roles"
+)
 
 type EventType string
 
@@ -9,6 +13,12 @@ const (
 	EventTypeDelete EventType = "delete"
 	EventTypeBan    EventType = "ban"
 	EventTypeClear  EventType = "clear"
+
+	// Events derived from USERNOTICE messages, all of which carry a PayloadNotice
+	EventTypeSubscription EventType = "subscription"
+	EventTypeGiftSub      EventType = "gift-sub"
+	EventTypeRaid         EventType = "raid"
+	EventTypeAnnouncement EventType = "announcement"
 )
 
 type Event struct {
@@ -22,6 +32,7 @@ type Payload struct {
 	Append *PayloadAppend
 	Delete *PayloadDelete
 	Ban    *PayloadBan
+	Notice *PayloadNotice
 }
 
 func (e *Event) UnmarshalJSON(data []byte) error {
@@ -45,6 +56,9 @@ func (e *Event) UnmarshalJSON(data []byte) error {
 	case EventTypeBan:
 		e.Payload = &Payload{}
 		return json.Unmarshal(f.Payload, &e.Payload.Ban)
+	case EventTypeSubscription, EventTypeGiftSub, EventTypeRaid, EventTypeAnnouncement:
+		e.Payload = &Payload{}
+		return json.Unmarshal(f.Payload, &e.Payload.Notice)
 	}
 	return nil
 }
@@ -59,6 +73,9 @@ func (p Payload) MarshalJSON() ([]byte, error) {
 	if p.Ban != nil {
 		return json.Marshal(p.Ban)
 	}
+	if p.Notice != nil {
+		return json.Marshal(p.Notice)
+	}
 	return json.Marshal(nil)
 }
 
@@ -69,11 +86,25 @@ type PayloadAppend struct {
 	Color     string         `json:"color"`
 	Text      string         `json:"text"`
 	Emotes    []EmoteDetails `json:"emotes"`
+	Bits      int            `json:"bits,omitempty"`
+	Reply     *ReplyDetails  `json:"reply,omitempty"`
+	Badges    []roles.Badge  `json:"badges,omitempty"`
+	Roles     *roles.Set     `json:"roles,omitempty"`
+}
+
+// ReplyDetails identifies the message that a chat message was sent in reply to, so
+// that the reply can be rendered in context
+type ReplyDetails struct {
+	MessageId string `json:"messageId"`
+	UserId    string `json:"userId"`
+	Username  string `json:"username"`
+	Text      string `json:"text"`
 }
 
 type EmoteDetails struct {
 	Name string `json:"name"`
 	Url  string `json:"url"`
+	Bits int    `json:"bits,omitempty"`
 }
 
 type PayloadDelete struct {
@@ -83,3 +114,28 @@ type PayloadDelete struct {
 type PayloadBan struct {
 	UserId string `json:"userId"`
 }
+
+// PayloadNotice describes an event that Twitch announces in chat on a user's behalf,
+// such as a subscription or a raid. SystemMessage is Twitch's own description of the
+// event, and Text is the message that the user attached to it (if any), with emotes
+// encoded in the same manner as PayloadAppend.
+type PayloadNotice struct {
+	MessageId     string         `json:"messageId"`
+	UserId        string         `json:"userId"`
+	Username      string         `json:"username"`
+	Color         string         `json:"color"`
+	SystemMessage string         `json:"systemMessage"`
+	Text          string         `json:"text"`
+	Emotes        []EmoteDetails `json:"emotes"`
+
+	// Months is the cumulative number of months the user has been subscribed, for
+	// subscription events
+	Months int `json:"months,omitempty"`
+	// NumGifts is the number of subscriptions gifted, for gift-sub events
+	NumGifts int `json:"numGifts,omitempty"`
+	// Recipient is the display name of the user who received a gifted subscription,
+	// for gift-sub events that target a single user
+	Recipient string `json:"recipient,omitempty"`
+	// NumRaiders is the number of viewers who joined in a raid, for raid events
+	NumRaiders int `json:"numRaiders,omitempty"`
+}
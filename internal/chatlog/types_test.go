@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/golden-vcr/chatbot/internal/roles"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -57,6 +58,55 @@ func Test_Event(t *testing.T) {
 			},
 			`{"type":"append","payload":{"messageId":"f5e05a31-57c8-4f34-bfd5-bc1ae222c279","userId":"90790024","username":"wasabimilkshake","color":"#00ff7f","text":"I have $$52 $0 $0 $1","emotes":[{"name":"someEmote","url":"https://my-cool-emotes.biz/some-emote.png"},{"name":"anotherEmote","url":"https://my-cool-emotes.biz/another-emote.gif"}]}}`,
 		},
+		{
+			"append message in reply to another message",
+			Event{
+				Type: EventTypeAppend,
+				Payload: &Payload{
+					Append: &PayloadAppend{
+						MessageId: "f5e05a31-57c8-4f34-bfd5-bc1ae222c279",
+						UserId:    "_BOT_",
+						Username:  "_BOT_",
+						Color:     "#FFFFFF",
+						Text:      "You have 400 fun points available.",
+						Emotes:    []EmoteDetails{},
+						Reply: &ReplyDetails{
+							MessageId: "ad6d1481-1471-4538-900a-493704fc60c5",
+							UserId:    "90790024",
+							Username:  "wasabimilkshake",
+							Text:      "!balance",
+						},
+					},
+				},
+			},
+			`{"type":"append","payload":{"messageId":"f5e05a31-57c8-4f34-bfd5-bc1ae222c279","userId":"_BOT_","username":"_BOT_","color":"#FFFFFF","text":"You have 400 fun points available.","emotes":[],"reply":{"messageId":"ad6d1481-1471-4538-900a-493704fc60c5","userId":"90790024","username":"wasabimilkshake","text":"!balance"}}}`,
+		},
+		{
+			"append message with badges and roles",
+			Event{
+				Type: EventTypeAppend,
+				Payload: &Payload{
+					Append: &PayloadAppend{
+						MessageId: "f5e05a31-57c8-4f34-bfd5-bc1ae222c279",
+						UserId:    "90790024",
+						Username:  "wasabimilkshake",
+						Color:     "#00ff7f",
+						Text:      "Hello world",
+						Emotes:    []EmoteDetails{},
+						Badges: []roles.Badge{
+							{Name: "moderator", Version: "1"},
+							{Name: "subscriber", Version: "12"},
+						},
+						Roles: &roles.Set{
+							Moderator:        true,
+							Subscriber:       true,
+							SubscriberMonths: 14,
+						},
+					},
+				},
+			},
+			`{"type":"append","payload":{"messageId":"f5e05a31-57c8-4f34-bfd5-bc1ae222c279","userId":"90790024","username":"wasabimilkshake","color":"#00ff7f","text":"Hello world","emotes":[],"badges":[{"name":"moderator","version":"1"},{"name":"subscriber","version":"12"}],"roles":{"moderator":true,"subscriber":true,"subscriberMonths":14}}}`,
+		},
 		{
 			"delete a single message",
 			Event{
@@ -88,6 +138,24 @@ func Test_Event(t *testing.T) {
 			},
 			`{"type":"clear"}`,
 		},
+		{
+			"raid notice",
+			Event{
+				Type: EventTypeRaid,
+				Payload: &Payload{
+					Notice: &PayloadNotice{
+						MessageId:     "3d830f12-795c-447d-af3c-ea05e40fbddb",
+						UserId:        "123456",
+						Username:      "SomeStreamer",
+						Color:         "#9ACD32",
+						SystemMessage: "15 raiders from SomeStreamer have joined!",
+						Emotes:        []EmoteDetails{},
+						NumRaiders:    15,
+					},
+				},
+			},
+			`{"type":"raid","payload":{"messageId":"3d830f12-795c-447d-af3c-ea05e40fbddb","userId":"123456","username":"SomeStreamer","color":"#9ACD32","systemMessage":"15 raiders from SomeStreamer have joined!","text":"","emotes":[],"numRaiders":15}}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("marshal %s to JSON", tt.name), func(t *testing.T) {
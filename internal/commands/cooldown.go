@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCooldownEntries is the number of cooldowns that may be tracked before expired
+// entries are pruned, so that cooldowns for one-off users don't accumulate forever
+const maxCooldownEntries = 1024
+
+// CooldownPolicy determines how often a command may be invoked
+type CooldownPolicy struct {
+	// Global is the minimum interval between invocations of the command by anyone in
+	// the channel
+	Global time.Duration
+	// PerUser is the minimum interval between invocations of the command by the same
+	// user
+	PerUser time.Duration
+	// ExemptModerators, if true, allows moderators and the broadcaster to invoke the
+	// command regardless of its cooldown
+	ExemptModerators bool
+}
+
+// CooldownConfig configures the cooldowns enforced by a Cooldowns tracker
+type CooldownConfig struct {
+	// Policies maps command names to cooldown policies that replace the defaults
+	// declared for those commands
+	Policies map[string]CooldownPolicy
+	// Notify, if true, causes the bot to reply to a user who invokes a command that's
+	// on cooldown, telling them how long they need to wait: each user is told at most
+	// once per cooldown, and further invocations are silently ignored. If false, all
+	// invocations of commands on cooldown are silently ignored.
+	Notify bool
+}
+
+// ParseCooldownPolicies parses a list of cooldown specs into a map suitable for
+// CooldownConfig.Policies. Each spec takes the form '<command>=<global>', optionally
+// followed by '/<per-user>' and '/exempt' (e.g. 'bc=10s/1m/exempt'), where exempt
+// indicates that moderators and the broadcaster are not subject to the cooldown.
+func ParseCooldownPolicies(specs []string) (map[string]CooldownPolicy, error) {
+	policies := make(map[string]CooldownPolicy)
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(spec, "=")
+		name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "!"))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid cooldown spec '%s'", spec)
+		}
+
+		var policy CooldownPolicy
+		fields := strings.Split(value, "/")
+		if len(fields) > 1 && strings.TrimSpace(fields[len(fields)-1]) == "exempt" {
+			policy.ExemptModerators = true
+			fields = fields[:len(fields)-1]
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid cooldown spec '%s'", spec)
+		}
+		durations := []*time.Duration{&policy.Global, &policy.PerUser}
+		for i, field := range fields {
+			d, err := time.ParseDuration(strings.TrimSpace(field))
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid cooldown duration in spec '%s'", spec)
+			}
+			*durations[i] = d
+		}
+		policies[name] = policy
+	}
+	return policies, nil
+}
+
+// cooldownKey identifies a single cooldown: userId is empty for global cooldowns
+type cooldownKey struct {
+	channel string
+	command string
+	userId  string
+}
+
+// Cooldowns tracks when each command may next be invoked, in each channel. Cooldowns
+// are kept separately from any single Handler, so that a single Cooldowns can be
+// shared by all the handlers created over the lifetime of the server: that way,
+// cooldowns still apply after the bot reconnects.
+type Cooldowns struct {
+	config   CooldownConfig
+	until    map[cooldownKey]time.Time
+	notified map[cooldownKey]time.Time
+	mu       sync.Mutex
+}
+
+func NewCooldowns(config CooldownConfig) *Cooldowns {
+	return &Cooldowns{
+		config:   config,
+		until:    make(map[cooldownKey]time.Time),
+		notified: make(map[cooldownKey]time.Time),
+	}
+}
+
+// policy returns the cooldown policy that applies to the given command
+func (cd *Cooldowns) policy(c *command) CooldownPolicy {
+	if policy, ok := cd.config.Policies[c.name]; ok {
+		return policy
+	}
+	return c.cooldown
+}
+
+// acquire checks whether the given invocation of a command is permitted by the
+// command's cooldown policy. If so, it starts the cooldown and returns true.
+// Otherwise, it returns false along with the time remaining until the user may invoke
+// the command again, and whether the user should be notified of that fact.
+func (cd *Cooldowns) acquire(c *command, inv *Invocation, now time.Time) (bool, time.Duration, bool) {
+	policy := cd.policy(c)
+	if policy.Global <= 0 && policy.PerUser <= 0 {
+		return true, 0, false
+	}
+	globalKey := cooldownKey{channel: inv.Channel, command: c.name}
+	userKey := cooldownKey{channel: inv.Channel, command: c.name, userId: inv.UserId}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	// Users who are exempt from the cooldown may invoke the command regardless, but
+	// their invocations still start the cooldown for everyone else
+	exempt := policy.ExemptModerators && inv.UserRoles.CanModerate()
+	if !exempt {
+		remaining := max(cd.until[globalKey].Sub(now), cd.until[userKey].Sub(now))
+		if remaining > 0 {
+			notify := cd.config.Notify && !now.Before(cd.notified[userKey])
+			if notify {
+				cd.notified[userKey] = now.Add(remaining)
+			}
+			return false, remaining, notify
+		}
+	}
+
+	if len(cd.until) >= maxCooldownEntries {
+		cd.prune(now)
+	}
+	if policy.Global > 0 {
+		cd.until[globalKey] = now.Add(policy.Global)
+	}
+	if policy.PerUser > 0 {
+		cd.until[userKey] = now.Add(policy.PerUser)
+	}
+	return true, 0, false
+}
+
+// prune discards all cooldowns that have already elapsed
+func (cd *Cooldowns) prune(now time.Time) {
+	for key, until := range cd.until {
+		if !now.Before(until) {
+			delete(cd.until, key)
+		}
+	}
+	for key, until := range cd.notified {
+		if !now.Before(until) {
+			delete(cd.notified, key)
+		}
+	}
+}
+
+// formatCooldown returns the remaining duration of a cooldown as a whole number of
+// seconds, rounded up, e.g. '12s'
+func formatCooldown(remaining time.Duration) string {
+	return fmt.Sprintf("%ds", int(math.Ceil(remaining.Seconds())))
+}
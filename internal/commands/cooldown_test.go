@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/roles"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseCooldownPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    map[string]CooldownPolicy
+		wantErr string
+	}{
+		{
+			"empty specs yield an empty map",
+			[]string{""},
+			map[string]CooldownPolicy{},
+			"",
+		},
+		{
+			"global, per-user and exempt settings are parsed",
+			[]string{"bc=10s", "!Camera=1m/exempt", "balance=0/30s", "help=5s/1m/exempt"},
+			map[string]CooldownPolicy{
+				"bc":      {Global: 10 * time.Second},
+				"camera":  {Global: time.Minute, ExemptModerators: true},
+				"balance": {PerUser: 30 * time.Second},
+				"help":    {Global: 5 * time.Second, PerUser: time.Minute, ExemptModerators: true},
+			},
+			"",
+		},
+		{
+			"command name is required",
+			[]string{"=10s"},
+			nil,
+			"invalid cooldown spec '=10s'",
+		},
+		{
+			"too many durations are rejected",
+			[]string{"bc=1s/2s/3s"},
+			nil,
+			"invalid cooldown spec 'bc=1s/2s/3s'",
+		},
+		{
+			"invalid durations are rejected",
+			[]string{"bc=forever"},
+			nil,
+			"invalid cooldown duration in spec 'bc=forever'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCooldownPolicies(tt.specs)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Cooldowns_acquire(t *testing.T) {
+	bc := &command{name: "bc", cooldown: CooldownPolicy{Global: 10 * time.Second, PerUser: time.Minute, ExemptModerators: true}}
+	alice := &Invocation{Channel: "goldenvcr", UserId: "1"}
+	bob := &Invocation{Channel: "goldenvcr", UserId: "2"}
+	mod := &Invocation{Channel: "goldenvcr", UserId: "3", UserRoles: roles.Set{Moderator: true}}
+	elsewhere := &Invocation{Channel: "wasabimilkshake", UserId: "1"}
+	now := time.Now()
+
+	cd := NewCooldowns(CooldownConfig{Notify: true})
+	ok, _, _ := cd.acquire(bc, alice, now)
+	assert.True(t, ok)
+
+	// The global cooldown applies to everyone in the channel, and the first rejection
+	// for each user is accompanied by a notification
+	ok, remaining, notify := cd.acquire(bc, bob, now.Add(4*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 6*time.Second, remaining)
+	assert.True(t, notify)
+	ok, _, notify = cd.acquire(bc, bob, now.Add(5*time.Second))
+	assert.False(t, ok)
+	assert.False(t, notify)
+
+	// Moderators are exempt, and cooldowns are tracked separately per channel
+	ok, _, _ = cd.acquire(bc, mod, now.Add(5*time.Second))
+	assert.True(t, ok)
+	ok, _, _ = cd.acquire(bc, elsewhere, now.Add(5*time.Second))
+	assert.True(t, ok)
+
+	// Once the global cooldown has elapsed, other users may invoke the command, but the
+	// per-user cooldown still applies to the user who invoked it
+	ok, _, _ = cd.acquire(bc, bob, now.Add(16*time.Second))
+	assert.True(t, ok)
+	ok, remaining, notify = cd.acquire(bc, alice, now.Add(30*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, remaining)
+	assert.True(t, notify)
+	ok, _, _ = cd.acquire(bc, alice, now.Add(time.Minute))
+	assert.True(t, ok)
+
+	// Configured policies replace a command's defaults, and commands without a
+	// cooldown may always be invoked
+	cd = NewCooldowns(CooldownConfig{Policies: map[string]CooldownPolicy{"bc": {}}})
+	for i := 0; i < 3; i++ {
+		ok, _, _ = cd.acquire(bc, alice, now)
+		assert.True(t, ok)
+	}
+	cd = NewCooldowns(CooldownConfig{Policies: map[string]CooldownPolicy{"bc": {Global: time.Second}}})
+	cd.acquire(bc, alice, now)
+	ok, _, notify = cd.acquire(bc, mod, now)
+	assert.False(t, ok)
+	assert.False(t, notify)
+}
+
+func Test_formatCooldown(t *testing.T) {
+	assert.Equal(t, "1s", formatCooldown(200*time.Millisecond))
+	assert.Equal(t, "30s", formatCooldown(30*time.Second))
+	assert.Equal(t, "31s", formatCooldown(30*time.Second+time.Millisecond))
+}
@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+)
+
+// Errors returned when a moderator attempts to modify custom commands
+var (
+	ErrCustomCommandExists   = errors.New("custom command already exists")
+	ErrCustomCommandNotFound = errors.New("custom command does not exist")
+)
+
+// CustomCommand is a simple text command that a moderator created from chat
+type CustomCommand struct {
+	// Name is the name of the command, without the leading '!'
+	Name string `json:"name"`
+	// Response is the text that the bot replies with when the command is invoked
+	Response string `json:"response"`
+	// UpdatedBy is the login of the user who last created or edited the command
+	UpdatedBy string `json:"updatedBy"`
+	// UpdatedAt is the time at which the command was last created or edited
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CustomStore persists the custom commands for every channel, so that they outlive
+// the process
+type CustomStore interface {
+	Save(commands map[string][]CustomCommand) error
+	Load() (map[string][]CustomCommand, error)
+}
+
+// NewCustomStore returns a CustomStore that saves custom commands to a JSON file at
+// the given path
+func NewCustomStore(path string) CustomStore {
+	return &diskCustomStore{path: path}
+}
+
+type diskCustomStore struct {
+	path string
+}
+
+func (s *diskCustomStore) Save(commands map[string][]CustomCommand) error {
+	// Ensure that the parent directory exists
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write our commands, JSON-serialized, to a temporary file, then replace the
+	// existing file so that it's never left half-written
+	tmpPath := s.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(commands); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *diskCustomStore) Load() (map[string][]CustomCommand, error) {
+	// If no commands have been saved yet, there are no custom commands
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]CustomCommand{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var commands map[string][]CustomCommand
+	if err := json.NewDecoder(f).Decode(&commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+// CustomCommands holds the custom commands for every channel. It may be shared by any
+// number of handlers, and it persists every change to its store.
+type CustomCommands struct {
+	store    CustomStore
+	commands map[string][]CustomCommand
+	registry map[string]*registry
+	mu       sync.RWMutex
+}
+
+// NewCustomCommands loads all custom commands from the given store; if store is nil,
+// custom commands are kept in memory only
+func NewCustomCommands(store CustomStore) (*CustomCommands, error) {
+	commands := map[string][]CustomCommand{}
+	if store != nil {
+		loaded, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		commands = loaded
+	}
+	cc := &CustomCommands{
+		store:    store,
+		commands: commands,
+		registry: make(map[string]*registry),
+	}
+	for channel := range commands {
+		if err := cc.index(channel); err != nil {
+			return nil, err
+		}
+	}
+	return cc, nil
+}
+
+// List returns the custom commands in the given channel, sorted by name
+func (cc *CustomCommands) List(channel string) []CustomCommand {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return append([]CustomCommand{}, cc.commands[channel]...)
+}
+
+// add creates a new custom command in the given channel
+func (cc *CustomCommands) add(channel string, c CustomCommand) error {
+	return cc.update(channel, func(commands []CustomCommand) ([]CustomCommand, error) {
+		if findCustomCommand(commands, c.Name) >= 0 {
+			return nil, ErrCustomCommandExists
+		}
+		return append(commands, c), nil
+	})
+}
+
+// edit replaces an existing custom command in the given channel
+func (cc *CustomCommands) edit(channel string, c CustomCommand) error {
+	return cc.update(channel, func(commands []CustomCommand) ([]CustomCommand, error) {
+		i := findCustomCommand(commands, c.Name)
+		if i < 0 {
+			return nil, ErrCustomCommandNotFound
+		}
+		commands[i] = c
+		return commands, nil
+	})
+}
+
+// delete removes a custom command from the given channel
+func (cc *CustomCommands) delete(channel, name string) error {
+	return cc.update(channel, func(commands []CustomCommand) ([]CustomCommand, error) {
+		i := findCustomCommand(commands, name)
+		if i < 0 {
+			return nil, ErrCustomCommandNotFound
+		}
+		return append(commands[:i], commands[i+1:]...), nil
+	})
+}
+
+// update applies a change to the custom commands in a channel and persists the
+// result; if the change can't be persisted, it's discarded
+func (cc *CustomCommands) update(channel string, f func(commands []CustomCommand) ([]CustomCommand, error)) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	previous := cc.commands[channel]
+	updated, err := f(append([]CustomCommand{}, previous...))
+	if err != nil {
+		return err
+	}
+	sort.Slice(updated, func(i, j int) bool {
+		return updated[i].Name < updated[j].Name
+	})
+
+	cc.commands[channel] = updated
+	if cc.store != nil {
+		if err := cc.store.Save(cc.commands); err != nil {
+			cc.commands[channel] = previous
+			return err
+		}
+	}
+	return cc.index(channel)
+}
+
+// index rebuilds the registry of custom commands for the given channel
+func (cc *CustomCommands) index(channel string) error {
+	commands := make([]command, 0, len(cc.commands[channel]))
+	for _, custom := range cc.commands[channel] {
+		response := custom.Response
+		commands = append(commands, command{
+			name:        custom.Name,
+			description: "Custom command.",
+			cooldown:    infoCooldown,
+			duplicates:  outbound.DuplicatesCoalesce,
+			run: func(h *handler, inv *Invocation) error {
+				return h.say(outbound.PriorityLow, inv.Reply(response))
+			},
+		})
+	}
+	r, err := newRegistry(commands)
+	if err != nil {
+		return err
+	}
+	cc.registry[channel] = r
+	return nil
+}
+
+// current returns the registry of custom commands in the given channel
+func (cc *CustomCommands) current(channel string) *registry {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	if r, ok := cc.registry[channel]; ok {
+		return r
+	}
+	return emptyRegistry
+}
+
+// emptyRegistry contains no commands
+var emptyRegistry = &registry{byName: map[string]*command{}}
+
+func findCustomCommand(commands []CustomCommand, name string) int {
+	for i := range commands {
+		if commands[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeCustomCommandName returns the canonical form of a custom command name given
+// in chat, e.g. '!Discord' -> 'discord'
+func normalizeCustomCommandName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "!"))
+}
@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_diskCustomStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "custom-commands.json")
+	store := NewCustomStore(path)
+
+	// If nothing has been saved, there are no custom commands
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+
+	// Saved commands are loaded again intact, and no temporary file is left behind
+	updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commands := map[string][]CustomCommand{
+		"wasabimilkshake": {{Name: "discord", Response: "Join us!", UpdatedBy: "somemod", UpdatedAt: updatedAt}},
+	}
+	assert.NoError(t, store.Save(commands))
+	loaded, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, commands, loaded)
+	_, err = os.Stat(path + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// A corrupt file is an error
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = store.Load()
+	assert.Error(t, err)
+}
+
+type failingCustomStore struct {
+	err error
+}
+
+func (s *failingCustomStore) Save(commands map[string][]CustomCommand) error {
+	return s.err
+}
+
+func (s *failingCustomStore) Load() (map[string][]CustomCommand, error) {
+	return map[string][]CustomCommand{}, nil
+}
+
+func Test_CustomCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom-commands.json")
+	cc, err := NewCustomCommands(NewCustomStore(path))
+	assert.NoError(t, err)
+
+	// Commands are kept separately for each channel, sorted by name
+	assert.NoError(t, cc.add("foo", CustomCommand{Name: "zebra", Response: "Z"}))
+	assert.NoError(t, cc.add("foo", CustomCommand{Name: "apple", Response: "A"}))
+	assert.NoError(t, cc.add("bar", CustomCommand{Name: "apple", Response: "B"}))
+	assert.ErrorIs(t, cc.add("foo", CustomCommand{Name: "apple", Response: "A2"}), ErrCustomCommandExists)
+	assert.Equal(t, []CustomCommand{{Name: "apple", Response: "A"}, {Name: "zebra", Response: "Z"}}, cc.List("foo"))
+	assert.Equal(t, []CustomCommand{{Name: "apple", Response: "B"}}, cc.List("bar"))
+	assert.Empty(t, cc.List("baz"))
+	_, ok := cc.current("foo").lookup("ZEBRA")
+	assert.True(t, ok)
+	_, ok = cc.current("baz").lookup("zebra")
+	assert.False(t, ok)
+
+	// Commands can be edited and deleted only if they exist
+	assert.NoError(t, cc.edit("foo", CustomCommand{Name: "apple", Response: "A2"}))
+	assert.ErrorIs(t, cc.edit("foo", CustomCommand{Name: "mango", Response: "M"}), ErrCustomCommandNotFound)
+	assert.NoError(t, cc.delete("foo", "zebra"))
+	assert.ErrorIs(t, cc.delete("foo", "zebra"), ErrCustomCommandNotFound)
+	_, ok = cc.current("foo").lookup("zebra")
+	assert.False(t, ok)
+
+	// Every change is persisted, so the commands are loaded again on startup
+	reloaded, err := NewCustomCommands(NewCustomStore(path))
+	assert.NoError(t, err)
+	assert.Equal(t, []CustomCommand{{Name: "apple", Response: "A2"}}, reloaded.List("foo"))
+	assert.Equal(t, []CustomCommand{{Name: "apple", Response: "B"}}, reloaded.List("bar"))
+	_, ok = reloaded.current("bar").lookup("apple")
+	assert.True(t, ok)
+}
+
+func Test_CustomCommands_saveFailure(t *testing.T) {
+	store := &failingCustomStore{}
+	cc, err := NewCustomCommands(store)
+	assert.NoError(t, err)
+	assert.NoError(t, cc.add("foo", CustomCommand{Name: "discord", Response: "Join us!"}))
+
+	// If a change can't be persisted, it's discarded
+	store.err = errors.New("disk full")
+	assert.EqualError(t, cc.edit("foo", CustomCommand{Name: "discord", Response: "Leave us!"}), "disk full")
+	assert.EqualError(t, cc.add("foo", CustomCommand{Name: "camera", Response: "Canon"}), "disk full")
+	assert.Equal(t, []CustomCommand{{Name: "discord", Response: "Join us!"}}, cc.List("foo"))
+	_, ok := cc.current("foo").lookup("camera")
+	assert.False(t, ok)
+}
+
+func Test_handler_Handle_customCommands(t *testing.T) {
+	replies := []string{}
+	say := func(priority outbound.Priority, m outbound.Message) error {
+		replies = append(replies, m.Text)
+		return nil
+	}
+	h := NewHandler(context.Background(), nil, say, nil, HandlerOpts{}).(*handler)
+	mod := roles.Set{Moderator: true}
+
+	// Only moderators may manage custom commands
+	err := h.Handle(&Invocation{Channel: "foo", Command: "addcom", Args: "!discord Join us!"})
+	assert.EqualError(t, err, "!addcom is only available to moderators.")
+
+	// Custom commands can't shadow commands defined in code or in the static config
+	tests := []struct {
+		args    string
+		wantErr string
+	}{
+		{"!balance You're broke.", "!balance is a built-in command, so it can't be changed."},
+		{"!500 Nope.", "!500 is a built-in command, so it can't be changed."},
+		{"!Camera Nope.", "!camera is a built-in command, so it can't be changed."},
+		{"!discord", "Usage: !addcom !<name> <response>"},
+		{"", "Usage: !addcom !<name> <response>"},
+		{"!dis.cord Join us!", "'!dis.cord' is not a valid command name."},
+	}
+	for _, tt := range tests {
+		err := h.Handle(&Invocation{Channel: "foo", Command: "addcom", Args: tt.args, UserRoles: mod})
+		assert.EqualError(t, err, tt.wantErr, tt.args)
+	}
+
+	// Moderators can add, edit and delete custom commands, which anyone can then use
+	replies = nil
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "addcom", Args: "!Discord Join us!", UserRoles: mod}))
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "discord", UserId: "1"}))
+	err = h.Handle(&Invocation{Channel: "foo", Command: "addcom", Args: "!discord Again!", UserRoles: mod})
+	assert.EqualError(t, err, "!discord already exists; use !editcom to change it.")
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "editcom", Args: "!discord Join us now!", UserRoles: mod}))
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "listcom", UserRoles: mod}))
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "delcom", Args: "!discord", UserRoles: mod}))
+	err = h.Handle(&Invocation{Channel: "foo", Command: "delcom", Args: "!discord", UserRoles: mod})
+	assert.EqualError(t, err, "!discord is not a custom command.")
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "listcom", UserRoles: mod}))
+	assert.Equal(t, []string{
+		"Added !discord.",
+		"Join us!",
+		"Updated !discord.",
+		"Custom commands: !discord.",
+		"Deleted !discord.",
+		"There are no custom commands in this channel.",
+	}, replies)
+
+	// If a built-in command is later added with the same name as a custom command, the
+	// built-in command takes precedence, but the custom command can still be edited and
+	// deleted
+	replies = nil
+	assert.NoError(t, h.custom.add("foo", CustomCommand{Name: "camera", Response: "Say cheese!"}))
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "camera", UserId: "1"}))
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "editcom", Args: "!camera Smile!", UserRoles: mod}))
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "delcom", Args: "!camera", UserRoles: mod}))
+	assert.Len(t, replies, 3)
+	assert.True(t, strings.HasPrefix(replies[0], "A camera is a device"))
+	assert.Equal(t, []string{"Updated !camera.", "Deleted !camera."}, replies[1:])
+	assert.Empty(t, h.custom.List("foo"))
+
+	// Custom commands only exist in the channel where they were created
+	replies = nil
+	assert.NoError(t, h.Handle(&Invocation{Channel: "foo", Command: "addcom", Args: "!discord Join us!", UserRoles: mod}))
+	err = h.Handle(&Invocation{Channel: "bar", Command: "discord", UserId: "1"})
+	assert.EqualError(t, err, "unrecognized command: discord")
+	assert.Equal(t, []string{"Added !discord."}, replies)
+}
@@ -3,81 +3,301 @@ package commands
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golden-vcr/auth"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
 	"github.com/golden-vcr/server-common/rmq"
 )
 
-type SayFunc func(s string) error
+// SayFunc sends a message to the channel as the bot, with the given priority
+// determining how urgently it should be sent relative to other queued messages
+type SayFunc func(priority outbound.Priority, m outbound.Message) error
+
+// Invocation describes a single chat message in which a user invoked a command
+type Invocation struct {
+	// Channel is the name of the channel in which the command was invoked, without
+	// the leading '#'
+	Channel string
+	// Command is the name of the command, without the leading '!', e.g. 'balance'
+	Command string
+	// Args is the remainder of the message following the command, if any
+	Args string
+	// MessageId is the Twitch-assigned ID of the chat message
+	MessageId string
+	// MessageText is the full text of the chat message, including the command
+	MessageText string
+	// UserId is the Twitch user ID of the user who sent the message
+	UserId string
+	// UserLogin is the all-lowercase Twitch username of the user who sent the message
+	UserLogin string
+	// UserDisplayName is the display name of the user who sent the message
+	UserDisplayName string
+	// UserRoles describes the roles held by the user in the channel, which may be
+	// used to restrict commands to certain users
+	UserRoles roles.Set
+
+	// duplicates is the duplicate policy of the invoked command, which applies to
+	// all replies to the invocation
+	duplicates outbound.DuplicatePolicy
+}
+
+// Reply returns a Message with the given text that will be sent as a threaded reply to
+// the chat message that invoked the command
+func (inv *Invocation) Reply(text string) outbound.Message {
+	return outbound.Message{
+		Text:       text,
+		Duplicates: inv.duplicates,
+		ReplyParent: &outbound.ReplyParent{
+			MessageId: inv.MessageId,
+			UserId:    inv.UserId,
+			Username:  inv.UserDisplayName,
+			Text:      inv.MessageText,
+		},
+	}
+}
 
 type Handler interface {
-	Handle(command, args, userId, userDisplayName string) error
+	Handle(inv *Invocation) error
 }
 
-func NewHandler(ctx context.Context, authServiceClient auth.ServiceClient, say SayFunc, twitchEventsProducer rmq.Producer) Handler {
+// EnabledFunc returns true if the command with the given canonical name (without the
+// leading '!') is enabled in the channel served by a Handler
+type EnabledFunc func(command string) bool
+
+// HandlerOpts configures the commands that a Handler responds to, and who may invoke
+// them
+type HandlerOpts struct {
+	// Enabled determines which commands are enabled in the channel; if nil, all
+	// commands are enabled
+	Enabled EnabledFunc
+	// Cooldowns tracks command cooldowns, and may be shared between handlers so that
+	// cooldowns survive reconnection; if nil, the handler tracks its own cooldowns
+	// using the default cooldown for each command
+	Cooldowns *Cooldowns
+	// Permissions grants or revokes access to commands for specific users
+	Permissions PermissionConfig
+	// Static is the set of commands defined in a config file, which may be shared
+	// between handlers and reloaded at any time; if nil, the handler uses the default
+	// set of static commands
+	Static *StaticCommands
+	// Custom is the set of custom commands that moderators have created from chat,
+	// which may be shared between handlers; if nil, the handler keeps its own custom
+	// commands in memory
+	Custom *CustomCommands
+}
+
+func NewHandler(ctx context.Context, authServiceClient auth.ServiceClient, say SayFunc, twitchEventsProducer rmq.Producer, opts HandlerOpts) Handler {
+	registry, err := newRegistry(builtinCommands())
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in commands: %v", err))
+	}
+	if opts.Enabled == nil {
+		opts.Enabled = func(string) bool { return true }
+	}
+	if opts.Cooldowns == nil {
+		opts.Cooldowns = NewCooldowns(CooldownConfig{})
+	}
+	if opts.Static == nil {
+		opts.Static, err = LoadStaticCommands("")
+		if err != nil {
+			panic(fmt.Sprintf("invalid default static commands: %v", err))
+		}
+	}
+	if opts.Custom == nil {
+		opts.Custom, err = NewCustomCommands(nil)
+		if err != nil {
+			panic(fmt.Sprintf("failed to initialize custom commands: %v", err))
+		}
+	}
 	return &handler{
 		ctx:                  ctx,
 		authServiceClient:    authServiceClient,
 		say:                  say,
 		twitchEventsProducer: twitchEventsProducer,
+		registry:             registry,
+		enabled:              opts.Enabled,
+		cooldowns:            opts.Cooldowns,
+		permissions:          opts.Permissions,
+		static:               opts.Static,
+		custom:               opts.Custom,
 	}
 }
 
 type handler struct {
 	ctx                  context.Context
 	authServiceClient    auth.ServiceClient
-	say                  func(s string) error
+	say                  SayFunc
 	twitchEventsProducer rmq.Producer
+	registry             *registry
+	enabled              EnabledFunc
+	cooldowns            *Cooldowns
+	permissions          PermissionConfig
+	static               *StaticCommands
+	custom               *CustomCommands
 }
 
-func (h *handler) Handle(command, args, userId, userDisplayName string) error {
-	switch command {
-	case "ghosts":
-		return h.handleGhosts()
-	case "friends":
-		return h.handleFriends()
-	case "alerts":
-		return h.handleAlerts()
-	case "tapes":
-		return h.handleTapes()
-	case "remix":
-		return h.handleRemix()
-	case "youtube":
-		return h.handleYoutube()
-	case "camera":
-		return h.handleCamera()
-	case "bc":
-		return h.handleBc()
-	case "uptime":
-		return h.handleUptime()
-	case "tape":
-		return h.handleTape()
-	case "balance":
-		return h.handleBalance(userId, userDisplayName)
+// Handle looks up the command invoked by the user and runs it. Commands that aren't
+// enabled in the channel are ignored, as are unrecognized commands in channels where
+// only specific commands are enabled, and commands that are on cooldown. If the user
+// isn't permitted to invoke the command, a PermissionError is returned.
+func (h *handler) Handle(inv *Invocation) error {
+	c, ok := h.lookup(inv.Channel, inv.Command)
+	if !ok {
+		if !h.enabled(strings.ToLower(inv.Command)) {
+			return nil
+		}
+		return fmt.Errorf("unrecognized command: %s", inv.Command)
 	}
-	if strings.ToLower(command) == "prayerbear" {
-		return h.handleNumericCommand(200, "prayerbear", userId, userDisplayName)
+	if !h.isEnabled(c, inv.Command) {
+		return nil
 	}
-	if strings.ToLower(command) == "standback" {
-		return h.handleNumericCommand(300, "standback", userId, userDisplayName)
+	inv.duplicates = c.duplicates
+	if err := h.permissions.authorize(c, inv); err != nil {
+		return err
 	}
-	if command == "ghost" {
-		message := command + " "
-		if !strings.HasPrefix(args, "of ") {
-			message += "of "
+	if ok, remaining, notify := h.cooldowns.acquire(c, inv, time.Now()); !ok {
+		if notify {
+			return h.say(outbound.PriorityLow, inv.Reply(fmt.Sprintf("!%s is on cooldown for %s.", c.name, formatCooldown(remaining))))
 		}
-		message += args
-		return h.handleNumericCommand(200, message, userId, userDisplayName)
+		return nil
+	}
+	return c.run(h, inv)
+}
+
+// lookup returns the command invoked by the given name in the given channel, if any:
+// commands defined in code take precedence over static commands, and both take
+// precedence over custom commands
+func (h *handler) lookup(channel, name string) (*command, bool) {
+	if c, ok := h.lookupBuiltin(name); ok {
+		return c, true
+	}
+	return h.custom.current(channel).lookup(name)
+}
+
+// lookupBuiltin returns the command defined in code or in the static config with the
+// given name, if any
+func (h *handler) lookupBuiltin(name string) (*command, bool) {
+	if c, ok := h.registry.lookup(name); ok {
+		return c, true
 	}
-	if command == "friend" {
-		message := fmt.Sprintf("%s %s", command, args)
-		return h.handleNumericCommand(200, message, userId, userDisplayName)
+	return h.static.current().lookup(name)
+}
+
+// list returns all commands available in the given channel, sorted by name
+func (h *handler) list(channel string) []*command {
+	commands := append(h.registry.list(), h.static.current().list()...)
+	return sortCommands(append(commands, h.custom.current(channel).list()...))
+}
+
+// isEnabled returns true if the given command, invoked under the given name, is
+// enabled in the channel: commands that match a pattern may be enabled by the name
+// they were invoked with (e.g. '200')
+func (h *handler) isEnabled(c *command, invokedAs string) bool {
+	if c.match != nil {
+		return h.enabled(strings.ToLower(invokedAs))
 	}
+	return h.enabled(c.name)
+}
+
+// infoCooldown is the default cooldown for commands that reply with static
+// information (see static.yaml): once the information has been posted in chat, there's
+// no need to post it again right away
+var infoCooldown = CooldownPolicy{Global: 30 * time.Second, ExemptModerators: true}
 
-	if numPoints, err := strconv.Atoi(command); err == nil && numPoints > 0 {
-		return h.handleNumericCommand(numPoints, args, userId, userDisplayName)
+// builtinCommands returns the set of commands that are implemented in code, whose names
+// can't be used by static commands
+func builtinCommands() []command {
+	return []command{
+		{
+			name:        "help",
+			usage:       "[<command>]",
+			description: "Explains how to use a command.",
+			cooldown:    CooldownPolicy{PerUser: 10 * time.Second},
+			run:         (*handler).handleHelp,
+		},
+		{
+			name:        "commands",
+			description: "Lists the commands you can use.",
+			duplicates:  outbound.DuplicatesCoalesce,
+			cooldown:    infoCooldown,
+			run:         (*handler).handleCommands,
+		},
+		{
+			name:        "uptime",
+			description: "Shows how long the current broadcast has been live.",
+			cooldown:    CooldownPolicy{Global: 10 * time.Second, ExemptModerators: true},
+			run:         (*handler).handleUptime,
+		},
+		{
+			name:        "tape",
+			description: "Shows the tape that's currently being screened.",
+			cooldown:    CooldownPolicy{Global: 10 * time.Second, ExemptModerators: true},
+			run:         (*handler).handleTape,
+		},
+		{
+			name:        "balance",
+			description: "Shows how many fun points you have available.",
+			cooldown:    CooldownPolicy{PerUser: 10 * time.Second},
+			run:         (*handler).handleBalance,
+		},
+		{
+			name:        "prayerbear",
+			description: "Spends 200 fun points to summon prayer bear.",
+			run:         (*handler).handlePrayerbear,
+		},
+		{
+			name:        "standback",
+			description: "Spends 300 fun points to ask everyone to stand back.",
+			run:         (*handler).handleStandback,
+		},
+		{
+			name:        "ghost",
+			usage:       "of <whatever>",
+			description: "Spends 200 fun points to submit a ghost alert.",
+			run:         (*handler).handleGhost,
+		},
+		{
+			name:        "friend",
+			usage:       "<whatever>",
+			description: "Spends 200 fun points to submit a friend alert.",
+			run:         (*handler).handleFriend,
+		},
+		{
+			name:        "addcom",
+			usage:       "!<name> <response>",
+			description: "Creates a custom command.",
+			role:        roles.RoleModerator,
+			run:         (*handler).handleAddcom,
+		},
+		{
+			name:        "editcom",
+			usage:       "!<name> <response>",
+			description: "Changes the response to a custom command.",
+			role:        roles.RoleModerator,
+			run:         (*handler).handleEditcom,
+		},
+		{
+			name:        "delcom",
+			usage:       "!<name>",
+			description: "Deletes a custom command.",
+			role:        roles.RoleModerator,
+			run:         (*handler).handleDelcom,
+		},
+		{
+			name:        "listcom",
+			description: "Lists the custom commands in the channel.",
+			role:        roles.RoleModerator,
+			run:         (*handler).handleListcom,
+		},
+		{
+			name:        "<points>",
+			usage:       "[<message>]",
+			description: "Spends the given number of fun points, e.g. !500 hello.",
+			match:       isNumericCommand,
+			run:         (*handler).handleNumeric,
+		},
 	}
-	return fmt.Errorf("unrecognized command: %s", command)
 }
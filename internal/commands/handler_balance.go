@@ -4,18 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/golden-vcr/auth"
+	"github.com/golden-vcr/chatbot/internal/outbound"
 )
 
-func (h *handler) handleBalance(userId, userDisplayName string) error {
+func (h *handler) handleBalance(inv *Invocation) error {
 	accessToken, err := h.authServiceClient.RequestServiceToken(h.ctx, auth.ServiceTokenRequest{
 		Service: "chatbot",
 		User: auth.UserDetails{
-			Id:          userId,
-			Login:       strings.ToLower(userDisplayName),
-			DisplayName: userDisplayName,
+			Id:          inv.UserId,
+			Login:       inv.UserLogin,
+			DisplayName: inv.UserDisplayName,
 		},
 	})
 	if err != nil {
@@ -41,5 +41,5 @@ func (h *handler) handleBalance(userId, userDisplayName string) error {
 	if err := json.NewDecoder(res.Body).Decode(&f); err != nil {
 		return err
 	}
-	return h.say(fmt.Sprintf("@%s You have %d fun points available.", userDisplayName, f.AvailablePoints))
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("You have %d fun points available.", f.AvailablePoints)))
 }
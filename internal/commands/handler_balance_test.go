@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golden-vcr/auth"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_handler_handleBalance(t *testing.T) {
+	authServiceClient := &fakeAuthServiceClient{err: errors.New("auth is down")}
+	say := func(priority outbound.Priority, m outbound.Message) error { return nil }
+	h := NewHandler(context.Background(), authServiceClient, say, nil, HandlerOpts{}).(*handler)
+
+	// The user's balance should be requested for their login, which may bear no
+	// resemblance to their localized display name
+	err := h.Handle(&Invocation{
+		Channel:         "goldenvcr",
+		Command:         "balance",
+		UserId:          "90790024",
+		UserLogin:       "wasabimilkshake",
+		UserDisplayName: "わさびミルクシェイク",
+	})
+	assert.EqualError(t, err, "auth is down")
+	assert.Equal(t, []auth.ServiceTokenRequest{{
+		Service: "chatbot",
+		User: auth.UserDetails{
+			Id:          "90790024",
+			Login:       "wasabimilkshake",
+			DisplayName: "わさびミルクシェイク",
+		},
+	}}, authServiceClient.requests)
+}
+
+type fakeAuthServiceClient struct {
+	requests []auth.ServiceTokenRequest
+	err      error
+}
+
+func (c *fakeAuthServiceClient) RequestServiceToken(ctx context.Context, payload auth.ServiceTokenRequest) (string, error) {
+	c.requests = append(c.requests, payload)
+	return "", c.err
+}
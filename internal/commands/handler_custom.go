@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+)
+
+func (h *handler) handleAddcom(inv *Invocation) error {
+	name, response, err := h.parseCustomCommandArgs(inv, "addcom", true)
+	if err != nil {
+		return err
+	}
+
+	// Custom commands can never shadow built-in commands. Built-in commands may still
+	// be added later with the same name as an existing custom command, in which case
+	// the custom command can be edited or deleted, but not invoked.
+	if _, ok := h.lookupBuiltin(name); ok {
+		return fmt.Errorf("!%s is a built-in command, so it can't be changed.", name)
+	}
+	err = h.custom.add(inv.Channel, CustomCommand{
+		Name:      name,
+		Response:  response,
+		UpdatedBy: inv.UserLogin,
+		UpdatedAt: time.Now(),
+	})
+	if errors.Is(err, ErrCustomCommandExists) {
+		return fmt.Errorf("!%s already exists; use !editcom to change it.", name)
+	}
+	if err != nil {
+		return err
+	}
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("Added !%s.", name)))
+}
+
+func (h *handler) handleEditcom(inv *Invocation) error {
+	name, response, err := h.parseCustomCommandArgs(inv, "editcom", true)
+	if err != nil {
+		return err
+	}
+	err = h.custom.edit(inv.Channel, CustomCommand{
+		Name:      name,
+		Response:  response,
+		UpdatedBy: inv.UserLogin,
+		UpdatedAt: time.Now(),
+	})
+	if errors.Is(err, ErrCustomCommandNotFound) {
+		return fmt.Errorf("!%s is not a custom command.", name)
+	}
+	if err != nil {
+		return err
+	}
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("Updated !%s.", name)))
+}
+
+func (h *handler) handleDelcom(inv *Invocation) error {
+	name, _, err := h.parseCustomCommandArgs(inv, "delcom", false)
+	if err != nil {
+		return err
+	}
+	err = h.custom.delete(inv.Channel, name)
+	if errors.Is(err, ErrCustomCommandNotFound) {
+		return fmt.Errorf("!%s is not a custom command.", name)
+	}
+	if err != nil {
+		return err
+	}
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("Deleted !%s.", name)))
+}
+
+func (h *handler) handleListcom(inv *Invocation) error {
+	commands := h.custom.List(inv.Channel)
+	if len(commands) == 0 {
+		return h.say(outbound.PriorityNormal, inv.Reply("There are no custom commands in this channel."))
+	}
+	names := make([]string, 0, len(commands))
+	for _, c := range commands {
+		names = append(names, "!"+c.Name)
+	}
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("Custom commands: %s.", strings.Join(names, ", "))))
+}
+
+// parseCustomCommandArgs parses the arguments to a command that manages custom
+// commands, i.e. '!<name> <response>' if withResponse is true, or just '!<name>'
+func (h *handler) parseCustomCommandArgs(inv *Invocation, manager string, withResponse bool) (string, string, error) {
+	usage := fmt.Sprintf("Usage: !%s !<name>", manager)
+	if withResponse {
+		usage += " <response>"
+	}
+	nameArg, response, _ := strings.Cut(strings.TrimSpace(inv.Args), " ")
+	response = strings.TrimSpace(response)
+	if nameArg == "" || (withResponse && response == "") || (!withResponse && response != "") {
+		return "", "", errors.New(usage)
+	}
+
+	name := normalizeCustomCommandName(nameArg)
+	if !commandNameRegex.MatchString(name) {
+		return "", "", fmt.Errorf("'%s' is not a valid command name.", nameArg)
+	}
+	if utf8.RuneCountInString(response) > outbound.MaxMessageLength {
+		return "", "", fmt.Errorf("Responses may be at most %d characters long.", outbound.MaxMessageLength)
+	}
+	return name, response, nil
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
+)
+
+func (h *handler) handleHelp(inv *Invocation) error {
+	name := strings.TrimPrefix(strings.TrimSpace(inv.Args), "!")
+	if spacePos := strings.IndexRune(name, ' '); spacePos >= 0 {
+		name = name[:spacePos]
+	}
+	if name == "" {
+		return h.say(outbound.PriorityLow, inv.Reply("Send !commands for a list of commands, or !help <command> to learn how to use a command."))
+	}
+	c, ok := h.lookup(inv.Channel, name)
+	if !ok || !h.isEnabled(c, name) {
+		return fmt.Errorf("unrecognized command: %s", name)
+	}
+	return h.say(outbound.PriorityLow, inv.Reply(formatHelp(c)))
+}
+
+func (h *handler) handleCommands(inv *Invocation) error {
+	names := make([]string, 0)
+	for _, c := range h.list(inv.Channel) {
+		if !h.enabled(c.name) || h.permissions.authorize(c, inv) != nil {
+			continue
+		}
+		names = append(names, "!"+c.name)
+	}
+	return h.say(outbound.PriorityLow, inv.Reply(fmt.Sprintf("Commands: %s. Send !help <command> for details.", strings.Join(names, ", "))))
+}
+
+// formatHelp returns a description of how to use the given command, e.g. '!ghost of
+// <whatever>: Spends 200 fun points to submit a ghost alert.'
+func formatHelp(c *command) string {
+	text := "!" + c.name
+	if c.usage != "" {
+		text += " " + c.usage
+	}
+	text += ": " + c.description
+	if c.role != roles.RoleEveryone {
+		text += fmt.Sprintf(" Only available to %s.", describeRole(c.role))
+	}
+	if len(c.aliases) > 0 {
+		text += " Also available as !" + strings.Join(c.aliases, ", !") + "."
+	}
+	return text
+}
@@ -3,17 +3,57 @@ package commands
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/golden-vcr/schemas/core"
 	etwitch "github.com/golden-vcr/schemas/twitch-events"
 )
 
-func (h *handler) handleNumericCommand(numPoints int, args, userId, userDisplayName string) error {
+func (h *handler) handlePrayerbear(inv *Invocation) error {
+	return h.handleNumericCommand(200, "prayerbear", inv)
+}
+
+func (h *handler) handleStandback(inv *Invocation) error {
+	return h.handleNumericCommand(300, "standback", inv)
+}
+
+func (h *handler) handleGhost(inv *Invocation) error {
+	message := "ghost "
+	if !strings.HasPrefix(inv.Args, "of ") {
+		message += "of "
+	}
+	message += inv.Args
+	return h.handleNumericCommand(200, message, inv)
+}
+
+func (h *handler) handleFriend(inv *Invocation) error {
+	message := fmt.Sprintf("friend %s", inv.Args)
+	return h.handleNumericCommand(200, message, inv)
+}
+
+func (h *handler) handleNumeric(inv *Invocation) error {
+	numPoints, err := strconv.Atoi(inv.Command)
+	if err != nil {
+		return err
+	}
+	return h.handleNumericCommand(numPoints, inv.Args, inv)
+}
+
+// isNumericCommand returns true if the given command name is a positive number of fun
+// points, e.g. '!500'
+func isNumericCommand(name string) bool {
+	numPoints, err := strconv.Atoi(name)
+	return err == nil && numPoints > 0
+}
+
+func (h *handler) handleNumericCommand(numPoints int, args string, inv *Invocation) error {
 	ev := etwitch.Event{
 		Type: etwitch.EventTypeViewerRedeemedFunPoints,
 		Viewer: &core.Viewer{
-			TwitchUserId:      userId,
-			TwitchDisplayName: userDisplayName,
+			TwitchUserId:      inv.UserId,
+			TwitchDisplayName: inv.UserDisplayName,
 		},
 		Payload: &etwitch.Payload{
 			ViewerRedeemedFunPoints: &etwitch.PayloadViewerRedeemedFunPoints{
@@ -7,9 +7,10 @@ import (
 	"time"
 
 	"github.com/golden-vcr/broadcasts"
+	"github.com/golden-vcr/chatbot/internal/outbound"
 )
 
-func (h *handler) handleTape() error {
+func (h *handler) handleTape(inv *Invocation) error {
 	// GET /api/broadcasts/history to obtain data for the most recent stream
 	url := "https://goldenvcr.com/api/broadcasts/history"
 	req, err := http.NewRequest(http.MethodGet, url, nil)
@@ -43,10 +44,10 @@ func (h *handler) handleTape() error {
 
 	// Early-out if we're not screening a tape
 	if broadcast == nil {
-		return h.say("No broadcast is currently live.")
+		return h.say(outbound.PriorityNormal, inv.Reply("No broadcast is currently live."))
 	}
 	if screening == nil {
-		return h.say("No tape is currently being screened.")
+		return h.say(outbound.PriorityNormal, inv.Reply("No tape is currently being screened."))
 	}
 
 	// Request the full details of the tape we're currently screening
@@ -90,5 +91,5 @@ func (h *handler) handleTape() error {
 	}
 	minutesElapsed := max(0, int(time.Since(screening.StartedAt).Minutes()))
 	tapeUrl := fmt.Sprintf("https://goldenvcr.com/tapes/%d", screening.TapeId)
-	return h.say(fmt.Sprintf("The current tape is #%d: «%s»%s. It's been screened for %dm so far. %s", f.Id, f.Title, desc, minutesElapsed, tapeUrl))
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("The current tape is #%d: «%s»%s. It's been screened for %dm so far. %s", f.Id, f.Title, desc, minutesElapsed, tapeUrl)))
 }
@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_handler_Handle(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   []string
+		command   string
+		args      string
+		wantReply string
+		wantErr   string
+	}{
+		{
+			"commands are case-insensitive",
+			nil,
+			"CAMERA",
+			"",
+			"A camera is a device for recording visual images in the form of photographs, film, or video signals.",
+			"",
+		},
+		{
+			"help without args explains how to get help",
+			nil,
+			"help",
+			"",
+			"Send !commands for a list of commands, or !help <command> to learn how to use a command.",
+			"",
+		},
+		{
+			"help describes a command",
+			nil,
+			"help",
+			"!ghost",
+			"!ghost of <whatever>: Spends 200 fun points to submit a ghost alert.",
+			"",
+		},
+		{
+			"help describes a numeric command",
+			nil,
+			"help",
+			"500",
+			"!<points> [<message>]: Spends the given number of fun points, e.g. !500 hello.",
+			"",
+		},
+		{
+			"help rejects unrecognized commands",
+			nil,
+			"help",
+			"nope",
+			"",
+			"unrecognized command: nope",
+		},
+		{
+			"commands lists only enabled commands",
+			[]string{"commands", "help", "camera", "youtube"},
+			"commands",
+			"",
+			"Commands: !camera, !commands, !help, !youtube. Send !help <command> for details.",
+			"",
+		},
+		{
+			"help ignores commands that aren't enabled",
+			[]string{"help", "camera"},
+			"help",
+			"youtube",
+			"",
+			"unrecognized command: youtube",
+		},
+		{
+			"disabled commands are ignored",
+			[]string{"camera"},
+			"youtube",
+			"",
+			"",
+			"",
+		},
+		{
+			"unrecognized commands are ignored unless all commands are enabled",
+			[]string{"camera"},
+			"nope",
+			"",
+			"",
+			"",
+		},
+		{
+			"unrecognized commands are rejected",
+			nil,
+			"nope",
+			"",
+			"",
+			"unrecognized command: nope",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := []outbound.Message{}
+			say := func(priority outbound.Priority, m outbound.Message) error {
+				replies = append(replies, m)
+				return nil
+			}
+			opts := HandlerOpts{}
+			if tt.enabled != nil {
+				opts.Enabled = func(command string) bool {
+					for _, name := range tt.enabled {
+						if name == command {
+							return true
+						}
+					}
+					return false
+				}
+			}
+			h := NewHandler(context.Background(), nil, say, nil, opts)
+			err := h.Handle(&Invocation{Command: tt.command, Args: tt.args, MessageId: "1"})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.wantReply == "" {
+				assert.Empty(t, replies)
+			} else if assert.Len(t, replies, 1) {
+				assert.Equal(t, tt.wantReply, replies[0].Text)
+			}
+		})
+	}
+}
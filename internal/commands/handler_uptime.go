@@ -7,9 +7,10 @@ import (
 	"time"
 
 	"github.com/golden-vcr/broadcasts"
+	"github.com/golden-vcr/chatbot/internal/outbound"
 )
 
-func (h *handler) handleUptime() error {
+func (h *handler) handleUptime(inv *Invocation) error {
 	// GET /api/broadcasts/history to obtain data for the most recent stream
 	url := "https://goldenvcr.com/api/broadcasts/history"
 	req, err := http.NewRequest(http.MethodGet, url, nil)
@@ -39,7 +40,7 @@ func (h *handler) handleUptime() error {
 
 	// Early-out if we're not screening a tape
 	if broadcast == nil {
-		return h.say("No broadcast is currently live.")
+		return h.say(outbound.PriorityNormal, inv.Reply("No broadcast is currently live."))
 	}
 
 	// Send a message indicating how long we've been live
@@ -52,5 +53,5 @@ func (h *handler) handleUptime() error {
 	} else {
 		readout = fmt.Sprintf("%dm", minuteFigure)
 	}
-	return h.say(fmt.Sprintf("Broadcast %d has been live for %s.", broadcast.Id, readout))
+	return h.say(outbound.PriorityNormal, inv.Reply(fmt.Sprintf("Broadcast %d has been live for %s.", broadcast.Id, readout)))
 }
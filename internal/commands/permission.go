@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golden-vcr/chatbot/internal/roles"
+)
+
+// AllCommands may be used in place of a command name in a PermissionConfig in order to
+// grant or revoke access to every command
+const AllCommands = "*"
+
+// PermissionConfig grants or revokes access to commands for specific users, regardless
+// of the roles they hold. Users are identified by login or by Twitch user ID.
+type PermissionConfig struct {
+	// Allow maps command names (or AllCommands) to users who may invoke those commands
+	// even if they don't hold the required role
+	Allow map[string][]string
+	// Deny maps command names (or AllCommands) to users who may never invoke those
+	// commands; Deny takes precedence over Allow
+	Deny map[string][]string
+}
+
+// PermissionError indicates that a user is not permitted to invoke a command
+type PermissionError struct {
+	// Command is the name of the command, without the leading '!'
+	Command string
+	// Role is the minimum role required in order to invoke the command, or empty if
+	// the user was denied access explicitly
+	Role roles.Role
+}
+
+func (e *PermissionError) Error() string {
+	if e.Role == "" {
+		return fmt.Sprintf("You are not permitted to use !%s.", e.Command)
+	}
+	return fmt.Sprintf("!%s is only available to %s.", e.Command, describeRole(e.Role))
+}
+
+// ParsePermissionOverrides parses a list of specs in the form
+// '<command>=<user>+<user>+...' (e.g. 'bc=wasabimilkshake+90790024') into a map
+// suitable for PermissionConfig.Allow or PermissionConfig.Deny
+func ParsePermissionOverrides(specs []string) (map[string][]string, error) {
+	overrides := make(map[string][]string)
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, userList, ok := strings.Cut(spec, "=")
+		name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "!"))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid permission spec '%s'", spec)
+		}
+		for _, user := range strings.Split(userList, "+") {
+			user = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(user), "@"))
+			if user == "" {
+				return nil, fmt.Errorf("empty user in permission spec '%s'", spec)
+			}
+			overrides[name] = append(overrides[name], user)
+		}
+	}
+	return overrides, nil
+}
+
+// authorize returns a PermissionError if the user who sent the given invocation is
+// not permitted to invoke the given command
+func (p *PermissionConfig) authorize(c *command, inv *Invocation) error {
+	if p.lists(p.Deny, c, inv) {
+		return &PermissionError{Command: c.name}
+	}
+	if p.lists(p.Allow, c, inv) || inv.UserRoles.AtLeast(c.role) {
+		return nil
+	}
+	return &PermissionError{Command: c.name, Role: c.role}
+}
+
+// lists returns true if the given overrides include the user who sent the invocation,
+// for the given command or for all commands. A command that matches a pattern may
+// also be named as it was invoked, e.g. '200' for the '<points>' command.
+func (p *PermissionConfig) lists(overrides map[string][]string, c *command, inv *Invocation) bool {
+	names := []string{c.name, AllCommands}
+	if c.match != nil {
+		names = append(names, strings.ToLower(inv.Command))
+	}
+	for _, name := range names {
+		for _, user := range overrides[name] {
+			if strings.EqualFold(user, inv.UserLogin) || user == inv.UserId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeRole returns a description of the users who hold the given role (or any
+// role that outranks it)
+func describeRole(role roles.Role) string {
+	switch role {
+	case roles.RoleSubscriber:
+		return "subscribers"
+	case roles.RoleFounder:
+		return "founders"
+	case roles.RoleVIP:
+		return "VIPs"
+	case roles.RoleModerator:
+		return "moderators"
+	case roles.RoleBroadcaster:
+		return "the broadcaster"
+	}
+	return "everyone"
+}
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParsePermissionOverrides(t *testing.T) {
+	got, err := ParsePermissionOverrides([]string{"!BC=WasabiMilkshake+90790024", "*=@troll", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"bc": {"wasabimilkshake", "90790024"},
+		"*":  {"troll"},
+	}, got)
+
+	_, err = ParsePermissionOverrides([]string{"bc"})
+	assert.EqualError(t, err, "invalid permission spec 'bc'")
+	_, err = ParsePermissionOverrides([]string{"bc=someone++else"})
+	assert.EqualError(t, err, "empty user in permission spec 'bc=someone++else'")
+}
+
+func Test_PermissionConfig_authorize(t *testing.T) {
+	modOnly := &command{name: "addcom", role: roles.RoleModerator}
+	subOnly := &command{name: "bc", role: roles.RoleSubscriber}
+	numeric := &command{name: "<points>", role: roles.RoleEveryone, match: isNumericCommand}
+	p := PermissionConfig{
+		Allow: map[string][]string{"addcom": {"wasabimilkshake"}},
+		Deny:  map[string][]string{"*": {"666"}, "bc": {"wasabimilkshake"}, "200": {"someone"}, "<points>": {"troll"}},
+	}
+	tests := []struct {
+		name    string
+		c       *command
+		inv     Invocation
+		wantErr string
+	}{
+		{
+			"user without the required role is rejected",
+			modOnly,
+			Invocation{UserId: "1", UserLogin: "someone", UserRoles: roles.Set{Subscriber: true}},
+			"!addcom is only available to moderators.",
+		},
+		{
+			"user with the required role is permitted",
+			modOnly,
+			Invocation{UserId: "1", UserLogin: "someone", UserRoles: roles.Set{Moderator: true}},
+			"",
+		},
+		{
+			"higher-ranked roles satisfy lower-ranked requirements",
+			subOnly,
+			Invocation{UserId: "1", UserLogin: "someone", UserRoles: roles.Set{VIP: true}},
+			"",
+		},
+		{
+			"allowed user is permitted regardless of role",
+			modOnly,
+			Invocation{UserId: "90790024", UserLogin: "wasabimilkshake"},
+			"",
+		},
+		{
+			"denied user is rejected regardless of role",
+			subOnly,
+			Invocation{UserId: "90790024", UserLogin: "wasabimilkshake", UserRoles: roles.Set{Subscriber: true}},
+			"You are not permitted to use !bc.",
+		},
+		{
+			"users may be denied all commands by user ID",
+			modOnly,
+			Invocation{UserId: "666", UserLogin: "troll", UserRoles: roles.Set{Moderator: true}},
+			"You are not permitted to use !addcom.",
+		},
+		{
+			"commands that match a pattern may be named as invoked",
+			numeric,
+			Invocation{Command: "200", UserId: "1", UserLogin: "someone"},
+			"You are not permitted to use !<points>.",
+		},
+		{
+			"overrides for one invocation of a pattern don't apply to others",
+			numeric,
+			Invocation{Command: "500", UserId: "1", UserLogin: "someone"},
+			"",
+		},
+		{
+			"commands that match a pattern may be named by their pattern",
+			numeric,
+			Invocation{Command: "500", UserId: "2", UserLogin: "troll"},
+			"You are not permitted to use !<points>.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.authorize(tt.c, &tt.inv)
+			if tt.wantErr != "" {
+				var permissionErr *PermissionError
+				assert.ErrorAs(t, err, &permissionErr)
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_handler_Handle_permissions(t *testing.T) {
+	replies := []string{}
+	say := func(priority outbound.Priority, m outbound.Message) error {
+		replies = append(replies, m.Text)
+		return nil
+	}
+	h := NewHandler(context.Background(), nil, say, nil, HandlerOpts{}).(*handler)
+	registry, err := newRegistry([]command{
+		{name: "commands", description: "Lists commands.", run: (*handler).handleCommands},
+		{name: "help", description: "Explains commands.", run: (*handler).handleHelp},
+		{name: "secret", description: "Does mod things.", role: roles.RoleModerator, run: func(h *handler, inv *Invocation) error {
+			return h.say(outbound.PriorityNormal, inv.Reply("done"))
+		}},
+	})
+	assert.NoError(t, err)
+	h.registry = registry
+	h.static.registry, err = newRegistry(nil)
+	assert.NoError(t, err)
+
+	// Commands that a user isn't permitted to use are rejected, and they're omitted
+	// from the list of commands, but they're still documented by !help
+	err = h.Handle(&Invocation{Command: "secret"})
+	assert.EqualError(t, err, "!secret is only available to moderators.")
+	assert.NoError(t, h.Handle(&Invocation{Command: "commands"}))
+	assert.NoError(t, h.Handle(&Invocation{Command: "help", Args: "secret"}))
+	assert.Equal(t, []string{
+		"Commands: !commands, !help. Send !help <command> for details.",
+		"!secret: Does mod things. Only available to moderators.",
+	}, replies)
+
+	// Moderators may use the command, and it's listed for them
+	replies = nil
+	assert.NoError(t, h.Handle(&Invocation{Command: "secret", UserRoles: roles.Set{Moderator: true}}))
+	assert.NoError(t, h.Handle(&Invocation{Command: "commands", UserRoles: roles.Set{Moderator: true}}))
+	assert.Equal(t, []string{
+		"done",
+		"Commands: !commands, !help, !secret. Send !help <command> for details.",
+	}, replies)
+}
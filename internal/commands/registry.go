@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
+)
+
+// command describes a single chat command that the bot responds to, along with the
+// metadata used to document it in !help and !commands
+type command struct {
+	// name is the canonical name of the command, without the leading '!'
+	name string
+	// aliases lists any alternative names by which the command may be invoked
+	aliases []string
+	// description briefly explains what the command does
+	description string
+	// usage describes the arguments that the command accepts, if any, e.g.
+	// 'of <whatever>'
+	usage string
+	// role is the minimum role that a user must hold in order to invoke the command;
+	// empty if the command is available to everyone
+	role roles.Role
+	// cooldown determines how often the command may be invoked, unless overridden by
+	// the CooldownConfig
+	cooldown CooldownPolicy
+	// duplicates determines how replies to the command are handled if they're
+	// identical to the last message sent by the bot: replies with purely static
+	// information can be coalesced, since the previous reply suffices
+	duplicates outbound.DuplicatePolicy
+	// match, if set, allows the command to be invoked under any name for which it
+	// returns true (e.g. '!200'), in which case name is used only for documentation
+	match func(name string) bool
+	// run handles a single invocation of the command
+	run func(h *handler, inv *Invocation) error
+}
+
+// names returns the canonical name of the command followed by its aliases
+func (c *command) names() []string {
+	return append([]string{c.name}, c.aliases...)
+}
+
+// registry indexes a set of commands by name, for case-insensitive lookup
+type registry struct {
+	commands []*command
+	byName   map[string]*command
+}
+
+func newRegistry(commands []command) (*registry, error) {
+	r := &registry{
+		byName: make(map[string]*command),
+	}
+	for i := range commands {
+		if err := r.register(&commands[i]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// register adds a command to the registry, failing if any of its names are already
+// taken by another command
+func (r *registry) register(c *command) error {
+	if c.name == "" {
+		return fmt.Errorf("command has no name")
+	}
+	if c.run == nil {
+		return fmt.Errorf("command '%s' has no handler", c.name)
+	}
+	if c.role == "" {
+		c.role = roles.RoleEveryone
+	}
+	if c.match == nil {
+		for _, name := range c.names() {
+			if _, exists := r.byName[strings.ToLower(name)]; exists {
+				return fmt.Errorf("command name '%s' is already registered", name)
+			}
+		}
+		for _, name := range c.names() {
+			r.byName[strings.ToLower(name)] = c
+		}
+	}
+	r.commands = append(r.commands, c)
+	return nil
+}
+
+// lookup returns the command invoked by the given name, if any: names are matched
+// case-insensitively, and commands registered by name take precedence over commands
+// that match a pattern
+func (r *registry) lookup(name string) (*command, bool) {
+	name = strings.ToLower(name)
+	if c, ok := r.byName[name]; ok {
+		return c, true
+	}
+	for _, c := range r.commands {
+		if c.match != nil && c.match(name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// list returns all registered commands, sorted by name, with commands that match a
+// pattern listed last
+func (r *registry) list() []*command {
+	return sortCommands(append([]*command{}, r.commands...))
+}
+
+// sortCommands sorts the given commands in place by name, with commands that match a
+// pattern listed last
+func sortCommands(commands []*command) []*command {
+	sort.SliceStable(commands, func(i, j int) bool {
+		if (commands[i].match == nil) != (commands[j].match == nil) {
+			return commands[i].match == nil
+		}
+		return commands[i].name < commands[j].name
+	})
+	return commands
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_registry(t *testing.T) {
+	noop := func(h *handler, inv *Invocation) error { return nil }
+	r, err := newRegistry([]command{
+		{name: "balance", aliases: []string{"points"}, run: noop},
+		{name: "<points>", match: isNumericCommand, run: noop},
+		{name: "camera", run: noop},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		lookup   string
+		wantName string
+	}{
+		{"exact name", "camera", "camera"},
+		{"names are case-insensitive", "CaMeRa", "camera"},
+		{"alias", "Points", "balance"},
+		{"pattern", "500", "<points>"},
+		{"unrecognized", "ghosts", ""},
+		{"pattern rejects non-matching names", "-5", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := r.lookup(tt.lookup)
+			if tt.wantName == "" {
+				assert.False(t, ok)
+			} else if assert.True(t, ok) {
+				assert.Equal(t, tt.wantName, c.name)
+			}
+		})
+	}
+
+	// Commands are listed by name, with pattern commands last
+	names := []string{}
+	for _, c := range r.list() {
+		names = append(names, c.name)
+	}
+	assert.Equal(t, []string{"balance", "camera", "<points>"}, names)
+
+	// Names and aliases may not be registered twice
+	assert.EqualError(t, r.register(&command{name: "POINTS", run: noop}), "command name 'POINTS' is already registered")
+	assert.EqualError(t, r.register(&command{name: "tapes"}), "command 'tapes' has no handler")
+}
+
+func Test_builtinCommands(t *testing.T) {
+	r, err := newRegistry(builtinCommands())
+	assert.NoError(t, err)
+	for _, c := range r.list() {
+		assert.NotEmpty(t, c.description, "command '%s' has no description", c.name)
+	}
+}
@@ -0,0 +1,258 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultStaticConfig is the config file that defines the bot's static commands unless
+// another file is used instead
+//
+//go:embed static.yaml
+var defaultStaticConfig []byte
+
+// choicePlaceholder is replaced, in the response to a static command, with a value
+// chosen at random from that command's list of choices
+const choicePlaceholder = "{choice}"
+
+// commandNameRegex matches valid command names
+var commandNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// staticConfig is the format of a config file (in YAML or JSON) that defines commands
+// whose responses are given as data rather than in code
+type staticConfig struct {
+	Commands []staticCommand `yaml:"commands"`
+}
+
+// staticCommand defines a single command that replies with static text, optionally
+// including a value chosen at random from a list
+type staticCommand struct {
+	Name        string          `yaml:"name"`
+	Aliases     []string        `yaml:"aliases"`
+	Description string          `yaml:"description"`
+	Role        string          `yaml:"role"`
+	Cooldown    *staticCooldown `yaml:"cooldown"`
+	Response    string          `yaml:"response"`
+	Choices     []string        `yaml:"choices"`
+}
+
+// staticCooldown declares the default cooldown for a static command
+type staticCooldown struct {
+	Global           duration `yaml:"global"`
+	PerUser          duration `yaml:"perUser"`
+	ExemptModerators bool     `yaml:"exemptModerators"`
+}
+
+// duration is a time.Duration that's given in a config file as a string, e.g. '30s'
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	if parsed < 0 {
+		return fmt.Errorf("duration may not be negative")
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// parseStaticConfig parses and validates a config file, returning the set of commands
+// it defines; reserved is used to ensure that those commands don't conflict with any
+// commands defined in code
+func parseStaticConfig(data []byte, reserved *registry) (*registry, error) {
+	var config staticConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse commands config: %w", err)
+	}
+
+	commands := make([]command, 0, len(config.Commands))
+	for i, sc := range config.Commands {
+		c, err := sc.compile(reserved)
+		if err != nil {
+			if sc.Name == "" {
+				return nil, fmt.Errorf("invalid command at index %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("invalid command '%s': %w", sc.Name, err)
+		}
+		commands = append(commands, c)
+	}
+
+	// Names and aliases must be unique among the commands in the file
+	return newRegistry(commands)
+}
+
+// compile validates a static command and converts it to a command that sends its
+// response when invoked
+func (sc *staticCommand) compile(reserved *registry) (command, error) {
+	for _, name := range append([]string{sc.Name}, sc.Aliases...) {
+		if !commandNameRegex.MatchString(name) {
+			return command{}, fmt.Errorf("invalid command name '%s'", name)
+		}
+		if _, ok := reserved.lookup(name); ok {
+			return command{}, fmt.Errorf("name '%s' is reserved for a built-in command", name)
+		}
+	}
+	if sc.Description == "" {
+		return command{}, fmt.Errorf("description is required")
+	}
+	if strings.TrimSpace(sc.Response) == "" {
+		return command{}, fmt.Errorf("response is required")
+	}
+	if len(sc.Choices) > 0 && !strings.Contains(sc.Response, choicePlaceholder) {
+		return command{}, fmt.Errorf("response must include '%s' if choices are given", choicePlaceholder)
+	}
+	if len(sc.Choices) == 0 && strings.Contains(sc.Response, choicePlaceholder) {
+		return command{}, fmt.Errorf("response includes '%s', but no choices are given", choicePlaceholder)
+	}
+	role, err := roles.ParseRole(sc.Role)
+	if err != nil {
+		return command{}, err
+	}
+
+	// Fixed responses are coalesced and cooled down as static information, since
+	// repeating the same text in chat serves no purpose; responses that vary are
+	// delivered every time
+	c := command{
+		name:        strings.ToLower(sc.Name),
+		description: sc.Description,
+		role:        role,
+	}
+	for _, alias := range sc.Aliases {
+		c.aliases = append(c.aliases, strings.ToLower(alias))
+	}
+	if len(sc.Choices) == 0 {
+		c.duplicates = outbound.DuplicatesCoalesce
+		c.cooldown = infoCooldown
+	}
+	if sc.Cooldown != nil {
+		c.cooldown = CooldownPolicy{
+			Global:           time.Duration(sc.Cooldown.Global),
+			PerUser:          time.Duration(sc.Cooldown.PerUser),
+			ExemptModerators: sc.Cooldown.ExemptModerators,
+		}
+	}
+	response := sc.Response
+	choices := append([]string{}, sc.Choices...)
+	c.run = func(h *handler, inv *Invocation) error {
+		text := response
+		if len(choices) > 0 {
+			text = strings.ReplaceAll(text, choicePlaceholder, choices[rand.Intn(len(choices))])
+		}
+		return h.say(outbound.PriorityLow, inv.Reply(text))
+	}
+	return c, nil
+}
+
+// StaticCommands holds the set of commands defined in a config file. It may be shared
+// by any number of handlers, and it can be reloaded while the bot is running, in which
+// case all handlers immediately begin using the new set of commands.
+type StaticCommands struct {
+	path     string
+	registry *registry
+	modTime  time.Time
+	mu       sync.RWMutex
+}
+
+// LoadStaticCommands loads the commands defined in the config file at the given path,
+// or the default set of static commands if path is empty
+func LoadStaticCommands(path string) (*StaticCommands, error) {
+	s := &StaticCommands{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the config file again, replacing the current set of commands. If the
+// file is invalid, the current set of commands is left unchanged and an error is
+// returned.
+func (s *StaticCommands) Reload() error {
+	data := defaultStaticConfig
+	var modTime time.Time
+	if s.path != "" {
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+		data, err = os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	reserved, err := newRegistry(builtinCommands())
+	if err != nil {
+		return err
+	}
+	registry, err := parseStaticConfig(data, reserved)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registry = registry
+	s.modTime = modTime
+	return nil
+}
+
+// Watch polls the config file at the given interval until ctx is canceled, reloading
+// it whenever it's modified, and calling onReload with the result of each reload
+func (s *StaticCommands) Watch(ctx context.Context, interval time.Duration, onReload func(err error)) {
+	if s.path == "" {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				onReload(err)
+			}
+			continue
+		}
+		s.mu.RLock()
+		modified := !info.ModTime().Equal(s.modTime)
+		s.mu.RUnlock()
+		if modified {
+			err := s.Reload()
+			if err != nil {
+				// Don't retry an invalid file until it's modified again
+				s.mu.Lock()
+				s.modTime = info.ModTime()
+				s.mu.Unlock()
+			}
+			onReload(err)
+		}
+	}
+}
+
+// current returns the current set of static commands
+func (s *StaticCommands) current() *registry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.registry
+}
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseStaticConfig(t *testing.T) {
+	reserved, err := newRegistry(builtinCommands())
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			"valid yaml",
+			"commands:\n  - name: Discord\n    aliases: [chat]\n    description: Links to Discord.\n    role: subscriber\n    cooldown: {global: 1m, exemptModerators: true}\n    response: Join us!\n",
+			"",
+		},
+		{
+			"valid json",
+			`{"commands": [{"name": "flip", "description": "Flips a coin.", "response": "It's {choice}!", "choices": ["heads", "tails"]}]}`,
+			"",
+		},
+		{
+			"unknown fields are rejected",
+			"commands:\n  - name: discord\n    description: Links to Discord.\n    reply: Join us!\n",
+			"failed to parse commands config: yaml: unmarshal errors:\n  line 4: field reply not found in type commands.staticCommand",
+		},
+		{
+			"built-in names are reserved",
+			"commands:\n  - name: Balance\n    description: Overrides balance.\n    response: You're broke.\n",
+			"invalid command 'Balance': name 'Balance' is reserved for a built-in command",
+		},
+		{
+			"numeric names are reserved",
+			"commands:\n  - name: discord\n    aliases: ['500']\n    description: Links to Discord.\n    response: Join us!\n",
+			"invalid command 'discord': name '500' is reserved for a built-in command",
+		},
+		{
+			"names must be valid",
+			"commands:\n  - name: '!discord'\n    description: Links to Discord.\n    response: Join us!\n",
+			"invalid command '!discord': invalid command name '!discord'",
+		},
+		{
+			"names must be unique",
+			"commands:\n  - name: discord\n    description: Links to Discord.\n    response: Join us!\n  - name: chat\n    aliases: [DISCORD]\n    description: Links to chat.\n    response: Chat here!\n",
+			"command name 'discord' is already registered",
+		},
+		{
+			"description is required",
+			"commands:\n  - name: discord\n    response: Join us!\n",
+			"invalid command 'discord': description is required",
+		},
+		{
+			"response is required",
+			"commands:\n  - description: Does nothing.\n    name: discord\n",
+			"invalid command 'discord': response is required",
+		},
+		{
+			"choices require a placeholder",
+			"commands:\n  - name: flip\n    description: Flips a coin.\n    response: It's a coin!\n    choices: [heads, tails]\n",
+			"invalid command 'flip': response must include '{choice}' if choices are given",
+		},
+		{
+			"placeholder requires choices",
+			"commands:\n  - name: flip\n    description: Flips a coin.\n    response: It's {choice}!\n",
+			"invalid command 'flip': response includes '{choice}', but no choices are given",
+		},
+		{
+			"roles must be valid",
+			"commands:\n  - name: discord\n    description: Links to Discord.\n    role: admin\n    response: Join us!\n",
+			"invalid command 'discord': unrecognized role 'admin'",
+		},
+		{
+			"durations must be valid",
+			"commands:\n  - name: discord\n    description: Links to Discord.\n    cooldown: {global: soon}\n    response: Join us!\n",
+			"failed to parse commands config: time: invalid duration \"soon\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseStaticConfig([]byte(tt.config), reserved)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_parseStaticConfig_commands(t *testing.T) {
+	reserved, err := newRegistry(builtinCommands())
+	assert.NoError(t, err)
+	r, err := parseStaticConfig([]byte("commands:\n  - name: Discord\n    aliases: [Chat]\n    description: Links to Discord.\n    role: vip\n    response: Join us!\n  - name: flip\n    description: Flips a coin.\n    cooldown: {perUser: 10s}\n    response: It's {choice}!\n    choices: [heads]\n"), reserved)
+	assert.NoError(t, err)
+
+	// Fixed responses default to the cooldown and duplicate policy for static
+	// information, and names are case-insensitive
+	c, ok := r.lookup("chat")
+	if assert.True(t, ok) {
+		assert.Equal(t, "discord", c.name)
+		assert.Equal(t, roles.RoleVIP, c.role)
+		assert.Equal(t, infoCooldown, c.cooldown)
+		assert.Equal(t, outbound.DuplicatesCoalesce, c.duplicates)
+	}
+
+	// Responses with choices are varied, and cooldowns may be given explicitly
+	c, ok = r.lookup("flip")
+	if assert.True(t, ok) {
+		assert.Equal(t, CooldownPolicy{PerUser: 10 * time.Second}, c.cooldown)
+		assert.Equal(t, outbound.DuplicatesVary, c.duplicates)
+		replies := []string{}
+		h := &handler{say: func(priority outbound.Priority, m outbound.Message) error {
+			replies = append(replies, m.Text)
+			return nil
+		}}
+		assert.NoError(t, c.run(h, &Invocation{Command: "flip"}))
+		assert.Equal(t, []string{"It's heads!"}, replies)
+	}
+}
+
+func Test_LoadStaticCommands_default(t *testing.T) {
+	s, err := LoadStaticCommands("")
+	assert.NoError(t, err)
+	for _, name := range []string{"ghosts", "friends", "alerts", "tapes", "remix", "youtube", "camera", "bc"} {
+		_, ok := s.current().lookup(name)
+		assert.True(t, ok, "default static commands should include '%s'", name)
+	}
+}
+
+func Test_StaticCommands_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.yaml")
+	write := func(response string, modTime time.Time) {
+		config := "commands:\n  - name: discord\n    description: Links to Discord.\n    response: " + response + "\n"
+		assert.NoError(t, os.WriteFile(path, []byte(config), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	respond := func(s *StaticCommands) string {
+		c, ok := s.current().lookup("discord")
+		if !ok {
+			return ""
+		}
+		replies := []string{}
+		h := &handler{say: func(priority outbound.Priority, m outbound.Message) error {
+			replies = append(replies, m.Text)
+			return nil
+		}}
+		assert.NoError(t, c.run(h, &Invocation{Command: "discord"}))
+		return strings.Join(replies, "")
+	}
+
+	// A missing file is an error at startup
+	_, err := LoadStaticCommands(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	now := time.Now()
+	write("Join us!", now.Add(-time.Minute))
+	s, err := LoadStaticCommands(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "Join us!", respond(s))
+
+	// An invalid file is rejected, and the previous commands remain in effect
+	write("", now.Add(-30*time.Second))
+	assert.EqualError(t, s.Reload(), "invalid command 'discord': response is required")
+	assert.Equal(t, "Join us!", respond(s))
+
+	// Once the file is modified, the watcher should pick up the changes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 8)
+	go s.Watch(ctx, 5*time.Millisecond, func(err error) { reloaded <- err })
+	assert.EqualError(t, <-reloaded, "invalid command 'discord': response is required")
+	write("Join us on Discord!", now)
+	assert.NoError(t, <-reloaded)
+	assert.Equal(t, "Join us on Discord!", respond(s))
+}
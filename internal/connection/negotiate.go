@@ -0,0 +1,46 @@
+package connection
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// prefersJSON parses the value of an Accept header and returns true if the client
+// prefers application/json over text/plain. Clients that don't express a preference
+// get plain text.
+func prefersJSON(accept string) bool {
+	jsonQuality := 0.0
+	textQuality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		// Each media range may carry a quality value, e.g. 'application/json;q=0.9',
+		// which defaults to 1
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQuality = max(jsonQuality, quality)
+		case "text/plain":
+			textQuality = max(textQuality, quality)
+		}
+	}
+	return jsonQuality > 0 && jsonQuality > textQuality
+}
+
+// acceptsJSON is a mux.MatcherFunc that matches requests whose Accept header prefers
+// application/json
+func acceptsJSON(req *http.Request, match *mux.RouteMatch) bool {
+	return prefersJSON(req.Header.Get("accept"))
+}
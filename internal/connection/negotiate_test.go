@@ -0,0 +1,30 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_prefersJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/plain", false},
+		{"application/json", true},
+		{"Application/JSON", true},
+		{"text/html, application/json", true},
+		{"application/json, text/plain", false},
+		{"application/json;q=0.9, text/plain", false},
+		{"application/json, text/plain;q=0.5", true},
+		{"application/json;q=0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, prefersJSON(tt.accept))
+		})
+	}
+}
@@ -2,6 +2,8 @@ package connection
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -12,6 +14,8 @@ import (
 	"github.com/golden-vcr/auth"
 	"github.com/golden-vcr/chatbot"
 	"github.com/golden-vcr/chatbot/internal/csrf"
+	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/outbound"
 	"github.com/golden-vcr/chatbot/internal/state"
 	"github.com/golden-vcr/chatbot/internal/tokens"
 	"github.com/golden-vcr/server-common/entry"
@@ -44,7 +48,7 @@ func NewServer(ctx context.Context, logger *slog.Logger, agent state.Agent, twit
 		if err == nil {
 			// If the refresh was successful, attempt to reinitialize the agent so that
 			// we automatically initialize a bot and log it in
-			err = agent.Reinitialize(credentials.AccessToken, 3*time.Second)
+			err = agent.Reinitialize(credentials, 3*time.Second)
 			if err == nil {
 				// If we successfully logged in, store our post-refresh credentials
 				logger.Info("Successfully initialized agent from stored credentials")
@@ -75,21 +79,37 @@ func NewServer(ctx context.Context, logger *slog.Logger, agent state.Agent, twit
 }
 
 func (s *Server) RegisterRoutes(c auth.Client, r *mux.Router) {
+	requireBroadcasterAccess := func(next http.Handler) http.Handler {
+		return auth.RequireAccess(c, auth.RoleBroadcaster, next)
+	}
+
+	// Clients that ask for JSON get a detailed status document, which describes the
+	// bot's account and its errors and so is only available to the broadcaster; all
+	// other clients get a plain-text status string
+	r.Path("/status").Methods("GET").MatcherFunc(acceptsJSON).Handler(requireBroadcasterAccess(http.HandlerFunc(s.handleGetStatusDetails)))
 	r.Path("/status").Methods("GET").HandlerFunc(s.handleGetStatus)
 	r.Path("/login").Methods("GET").HandlerFunc(s.handleGetLogin)
 	r.Path("/auth").Methods("GET").HandlerFunc(s.handleGetAuth)
 
-	requireBroadcasterAccess := func(next http.Handler) http.Handler {
-		return auth.RequireAccess(c, auth.RoleBroadcaster, next)
-	}
 	logout := r.Path("/logout").Subrouter()
 	logout.Use(requireBroadcasterAccess)
 	logout.Methods("POST").HandlerFunc(s.handlePostLogout)
+	say := r.Path("/say").Subrouter()
+	say.Use(requireBroadcasterAccess)
+	say.Methods("POST").HandlerFunc(s.handlePostSay)
+}
+
+func (s *Server) handleGetStatusDetails(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(res).Encode(s.agent.GetStatusDetails()); err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func (s *Server) handleGetStatus(res http.ResponseWriter, req *http.Request) {
-	status := s.agent.GetStatus()
-	res.Write([]byte(status))
+	// The plain-text status is only the bare status value, so that health checks can
+	// compare it directly; the JSON status has the details
+	res.Write([]byte(s.agent.GetStatus()))
 }
 
 func (s *Server) handleGetLogin(res http.ResponseWriter, req *http.Request) {
@@ -102,7 +122,7 @@ func (s *Server) handleGetLogin(res http.ResponseWriter, req *http.Request) {
 	q.Set("response_type", "code")
 	q.Set("client_id", s.clientId)
 	q.Set("redirect_uri", s.redirectUri)
-	q.Set("scope", strings.Join(chatbot.RequiredScopes, " "))
+	q.Set("scope", strings.Join(append(append([]string{}, chatbot.RequiredScopes...), chatbot.OptionalScopes...), " "))
 	q.Set("state", s.csrfBuffer.Peek())
 	u.RawQuery = q.Encode()
 
@@ -157,7 +177,7 @@ func (s *Server) handleGetAuth(res http.ResponseWriter, req *http.Request) {
 
 	// Reinitialize the agent with our new user access token, causing any existing bot
 	// to be replaced by a new one with a fresh login
-	if err := s.agent.Reinitialize(credentials.AccessToken, 3*time.Second); err != nil {
+	if err := s.agent.Reinitialize(credentials, 3*time.Second); err != nil {
 		http.Error(res, fmt.Sprintf("chat bot initialization failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -184,3 +204,97 @@ func (s *Server) handlePostLogout(res http.ResponseWriter, req *http.Request) {
 
 	res.Write([]byte(fmt.Sprintf("Disconnected chat bot %s and cleared stored tokens.", s.botUsername)))
 }
+
+// sayTimeout is the maximum amount of time that POST /say will wait for a message to
+// be delivered, which may take a while if it needs to wait for rate limits or retries
+const sayTimeout = 30 * time.Second
+
+func (s *Server) handlePostSay(res http.ResponseWriter, req *http.Request) {
+	// Parse and validate the message to be sent
+	var payload chatbot.SayRequest
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		http.Error(res, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	m, err := messageFromSayRequest(&payload)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Send the message through the bot's outbound queue, the same as any reply to a
+	// command, and report the outcome once it's been delivered (or has failed)
+	ctx, cancel := context.WithTimeout(req.Context(), sayTimeout)
+	defer cancel()
+	result := chatbot.SayResponse{Delivered: true}
+	status := http.StatusOK
+	if err := s.agent.Say(ctx, strings.ToLower(strings.TrimPrefix(payload.Channel, "#")), m); err != nil {
+		result = chatbot.SayResponse{Error: err.Error()}
+		status = sayErrorStatus(err)
+	}
+	res.Header().Set("content-type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(result)
+}
+
+// messageFromSayRequest validates the payload of a POST /say request and converts it
+// to an outbound message
+func messageFromSayRequest(payload *chatbot.SayRequest) (outbound.Message, error) {
+	text := strings.TrimSpace(payload.Text)
+	if text == "" {
+		return outbound.Message{}, fmt.Errorf("text is required")
+	}
+	m := outbound.Message{
+		Text: text,
+		// Messages sent on the broadcaster's behalf should always be delivered
+		Duplicates: outbound.DuplicatesVary,
+	}
+	switch payload.Kind {
+	case "", chatbot.SayKindMessage:
+		m.Kind = outbound.KindMessage
+	case chatbot.SayKindAction:
+		m.Kind = outbound.KindAction
+	case chatbot.SayKindAnnouncement:
+		m.Kind = outbound.KindAnnouncement
+	default:
+		return outbound.Message{}, fmt.Errorf("unsupported kind '%s'", payload.Kind)
+	}
+	if payload.Color != "" {
+		if m.Kind != outbound.KindAnnouncement {
+			return outbound.Message{}, fmt.Errorf("color is only supported for announcements")
+		}
+		switch payload.Color {
+		case "primary", "blue", "green", "orange", "purple":
+			m.Color = payload.Color
+		default:
+			return outbound.Message{}, fmt.Errorf("unsupported color '%s'", payload.Color)
+		}
+	}
+	return m, nil
+}
+
+// sayErrorStatus returns the HTTP status code that best describes why a message sent
+// via POST /say was not delivered
+func sayErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, outbound.ErrDeliveryUnconfirmed):
+		// The message was sent, so it was probably delivered, but Twitch never
+		// confirmed it
+		return http.StatusAccepted
+	case errors.Is(err, irc.ErrUnknownChannel):
+		return http.StatusNotFound
+	case errors.Is(err, irc.ErrAnnouncementsUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, state.ErrNotConnected),
+		errors.Is(err, irc.ErrShutDown),
+		errors.Is(err, outbound.ErrQueueFull),
+		errors.Is(err, outbound.ErrDropped),
+		errors.Is(err, outbound.ErrClosed):
+		return http.StatusServiceUnavailable
+	}
+
+	// Any other error indicates that Twitch refused to deliver the message
+	return http.StatusBadGateway
+}
@@ -0,0 +1,227 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golden-vcr/auth"
+	authmock "github.com/golden-vcr/auth/mock"
+	"github.com/golden-vcr/chatbot"
+	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/state"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Server_getStatus(t *testing.T) {
+	c := authmock.NewClient().AllowTwitchUserAccessToken("viewer-token", auth.RoleViewer, auth.UserDetails{
+		Id:          "1234",
+		Login:       "someviewer",
+		DisplayName: "SomeViewer",
+	}).AllowTwitchUserAccessToken("broadcaster-token", auth.RoleBroadcaster, auth.UserDetails{
+		Id:          "31337",
+		Login:       "channelowner",
+		DisplayName: "ChannelOwner",
+	})
+	r := mux.NewRouter()
+	s := &Server{agent: &fakeAgent{}}
+	s.RegisterRoutes(c, r)
+
+	tests := []struct {
+		name       string
+		accept     string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"plain-text status is public",
+			"",
+			"",
+			http.StatusOK,
+			"connected",
+		},
+		{
+			"detailed status requires a token",
+			"application/json",
+			"",
+			http.StatusBadRequest,
+			"Twitch user access token or internal JWT must be supplied in Authorization header",
+		},
+		{
+			"detailed status is not available to viewers",
+			"application/json",
+			"viewer-token",
+			http.StatusForbidden,
+			"insufficient access: requires broadcaster; you are viewer",
+		},
+		{
+			"detailed status is available to the broadcaster",
+			"application/json",
+			"broadcaster-token",
+			http.StatusOK,
+			`{"status":"connected","botUsername":"goldenvcrbot","botUserId":"12345","channels":null,"numReconnects":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/status", nil)
+			if tt.accept != "" {
+				req.Header.Set("accept", tt.accept)
+			}
+			if tt.token != "" {
+				req.Header.Set("authorization", "Bearer "+tt.token)
+			}
+			res := httptest.NewRecorder()
+			r.ServeHTTP(res, req)
+
+			assert.Equal(t, tt.wantStatus, res.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(res.Body.String()))
+		})
+	}
+}
+
+func Test_Server_handlePostSay(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		sayErr      error
+		wantChannel string
+		wantMessage *outbound.Message
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			"message is sent to home channel by default",
+			`{"text":"hello world"}`,
+			nil,
+			"",
+			&outbound.Message{Text: "hello world"},
+			http.StatusOK,
+			`{"delivered":true}`,
+		},
+		{
+			"action is sent to the requested channel",
+			`{"channel":"#WasabiMilkshake","kind":"action","text":"waves"}`,
+			nil,
+			"wasabimilkshake",
+			&outbound.Message{Text: "waves", Kind: outbound.KindAction},
+			http.StatusOK,
+			`{"delivered":true}`,
+		},
+		{
+			"announcement may have a color",
+			`{"kind":"announcement","text":"we're live","color":"purple"}`,
+			nil,
+			"",
+			&outbound.Message{Text: "we're live", Kind: outbound.KindAnnouncement, Color: "purple"},
+			http.StatusOK,
+			`{"delivered":true}`,
+		},
+		{
+			"text is required",
+			`{"text":"  "}`,
+			nil,
+			"",
+			nil,
+			http.StatusBadRequest,
+			"text is required",
+		},
+		{
+			"kind must be valid",
+			`{"kind":"whisper","text":"psst"}`,
+			nil,
+			"",
+			nil,
+			http.StatusBadRequest,
+			"unsupported kind 'whisper'",
+		},
+		{
+			"color is only valid for announcements",
+			`{"text":"hello","color":"blue"}`,
+			nil,
+			"",
+			nil,
+			http.StatusBadRequest,
+			"color is only supported for announcements",
+		},
+		{
+			"bot must be connected",
+			`{"text":"hello"}`,
+			state.ErrNotConnected,
+			"",
+			&outbound.Message{Text: "hello"},
+			http.StatusServiceUnavailable,
+			`{"delivered":false,"error":"chat bot is not connected"}`,
+		},
+		{
+			"channel must be known",
+			`{"channel":"somewhereelse","text":"hello"}`,
+			irc.ErrUnknownChannel,
+			"somewhereelse",
+			&outbound.Message{Text: "hello"},
+			http.StatusNotFound,
+			`{"delivered":false,"error":"bot is not configured to join the requested channel"}`,
+		},
+		{
+			"unconfirmed delivery is reported",
+			`{"text":"hello"}`,
+			outbound.ErrDeliveryUnconfirmed,
+			"",
+			&outbound.Message{Text: "hello"},
+			http.StatusAccepted,
+			`{"delivered":false,"error":"outbound message was sent, but its delivery was not confirmed"}`,
+		},
+		{
+			"rejection by Twitch is reported",
+			`{"kind":"announcement","text":"hello"}`,
+			errors.New("request to send announcement failed with status 403: forbidden"),
+			"",
+			&outbound.Message{Text: "hello", Kind: outbound.KindAnnouncement},
+			http.StatusBadGateway,
+			`{"delivered":false,"error":"request to send announcement failed with status 403: forbidden"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &fakeAgent{sayErr: tt.sayErr}
+			s := &Server{agent: agent}
+			req := httptest.NewRequest(http.MethodPost, "/say", strings.NewReader(tt.body))
+			res := httptest.NewRecorder()
+			s.handlePostSay(res, req)
+
+			assert.Equal(t, tt.wantStatus, res.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(res.Body.String()))
+			assert.Equal(t, tt.wantChannel, agent.channel)
+			assert.Equal(t, tt.wantMessage, agent.message)
+		})
+	}
+}
+
+// fakeAgent reports that it's connected, records the message passed to Say, and fails
+// with the given error
+type fakeAgent struct {
+	state.Agent
+	sayErr  error
+	channel string
+	message *outbound.Message
+}
+
+func (a *fakeAgent) GetStatus() chatbot.Status {
+	return chatbot.StatusConnected
+}
+
+func (a *fakeAgent) GetStatusDetails() chatbot.StatusDetails {
+	return chatbot.StatusDetails{Status: chatbot.StatusConnected, BotUsername: "goldenvcrbot", BotUserId: "12345"}
+}
+
+func (a *fakeAgent) Say(ctx context.Context, channel string, m outbound.Message) error {
+	a.channel = channel
+	a.message = &m
+	return a.sayErr
+}
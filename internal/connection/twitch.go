@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/golden-vcr/chatbot"
+	"github.com/golden-vcr/chatbot/internal/state"
 	"github.com/nicklaw5/helix/v2"
 )
 
@@ -14,6 +15,7 @@ type TwitchClient interface {
 	GetUserAccessTokenFromCode(code string) (*helix.AccessCredentials, error)
 	RefreshCredentials(ctx context.Context, credentials *helix.AccessCredentials) (*helix.AccessCredentials, error)
 	ResolveUserInfo(userAccessToken string) (*helix.User, error)
+	SendAnnouncement(userAccessToken, broadcasterId, moderatorId, text, color string) error
 }
 
 // NewTwitchClient initializes a TwitchClient that's prepared to initiate a user
@@ -81,7 +83,14 @@ func (c *twitchClient) RefreshCredentials(ctx context.Context, credentials *heli
 		return nil, fmt.Errorf("failed to refresh user access token: %w", err)
 	}
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return nil, fmt.Errorf("request to refresh user access token failed with status %d: %s", res.StatusCode, res.ErrorMessage)
+		// Twitch responds with a 4xx status (e.g. 400 for an invalid refresh token) if
+		// the refresh token will never be accepted, whereas rate limiting and server
+		// errors are transient
+		err := fmt.Errorf("request to refresh user access token failed with status %d: %s", res.StatusCode, res.ErrorMessage)
+		if res.StatusCode >= 400 && res.StatusCode <= 499 && res.StatusCode != 429 {
+			return nil, fmt.Errorf("%w: %v", state.ErrRefreshTokenRejected, err)
+		}
+		return nil, err
 	}
 
 	// Ensure that the user authorized all required scopes
@@ -120,3 +129,26 @@ func (c *twitchClient) ResolveUserInfo(userAccessToken string) (*helix.User, err
 	}
 	return &res.Data.Users[0], nil
 }
+
+// SendAnnouncement sends an announcement to the given broadcaster's chat as the user
+// to whom the given access token has been granted, who must be a moderator in that
+// channel. This requires the 'moderator:manage:announcements' scope.
+func (c *twitchClient) SendAnnouncement(userAccessToken, broadcasterId, moderatorId, text, color string) error {
+	client, err := c.makeUserAuthorizedClient(userAccessToken)
+	if err != nil {
+		return err
+	}
+	res, err := client.SendChatAnnouncement(&helix.SendChatAnnouncementParams{
+		BroadcasterID: broadcasterId,
+		ModeratorID:   moderatorId,
+		Message:       text,
+		Color:         color,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send announcement: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("request to send announcement failed with status %d: %s", res.StatusCode, res.ErrorMessage)
+	}
+	return nil
+}
@@ -2,81 +2,345 @@ package irc
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golden-vcr/auth"
 	"github.com/golden-vcr/chatbot"
 	"github.com/golden-vcr/chatbot/internal/commands"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/roles"
 	"github.com/golden-vcr/server-common/rmq"
 )
 
 var ErrReceivedReconnect = errors.New("received RECONNECT message from Twitch IRC server")
+var ErrConnectionClosed = errors.New("connection to Twitch IRC server was closed")
+var ErrPingTimeout = errors.New("timed out waiting for PONG from Twitch IRC server")
+var ErrShutDown = errors.New("bot was shut down")
+var ErrLoginFailed = errors.New("Login authentication failed")
+var ErrUnknownChannel = errors.New("bot is not configured to join the requested channel")
+var ErrAnnouncementsUnsupported = errors.New("bot is not configured to send announcements")
+
+// outboundQueueCapacity is the maximum number of messages the bot will hold while
+// waiting for rate limits to allow them to be sent
+const outboundQueueCapacity = 32
+
+// BotOpts is the set of options used to configure a Bot's behavior on its connection
+type BotOpts struct {
+	// PingInterval is how often the bot should send its own PING to the server in
+	// order to verify that the connection is still alive
+	PingInterval time.Duration
+	// PingTimeout is how long the bot will wait for a PONG in response to its PING
+	// before concluding that the connection is dead
+	PingTimeout time.Duration
+	// DeliveryTimeout is how long the bot will wait, after sending a message to a
+	// channel, for Twitch to either confirm it (with USERSTATE) or reject it (with
+	// NOTICE): if neither happens in that time, delivery fails with
+	// outbound.ErrDeliveryUnconfirmed, and the message is not retried
+	DeliveryTimeout time.Duration
+	// Logger is used to log messages that Twitch rejects
+	Logger Logger
+	// Announce is used to send announcements, which Twitch doesn't support via IRC; if
+	// nil, the bot can't send announcements
+	Announce AnnounceFunc
+	// Commands configures the command handler in each channel: its Cooldowns may be
+	// shared with subsequent bots so that cooldowns survive reconnection, and its
+	// Enabled func is replaced with each channel's own list of enabled commands
+	Commands commands.HandlerOpts
+}
+
+// AnnounceFunc sends an announcement with the given text and accent color to the
+// channel owned by the given broadcaster, on behalf of the given moderator (i.e. the
+// bot's own user)
+type AnnounceFunc func(broadcasterId, moderatorId, text, color string) error
 
 type Bot interface {
 	GetStatus() chatbot.Status
 	GetLastError() error
 	GetLastPingTime() time.Time
+	GetLastPongTime() time.Time
+	GetLatency() time.Duration
+	GetUserId() string
+	GetConnectedSince() time.Time
+	GetChannelStatuses() []chatbot.ChannelStatus
+
+	// Done returns a channel that's closed once the bot has failed, i.e. as soon as
+	// GetLastError will return a non-nil error: once the bot is done, it will not
+	// recover, and it should be replaced with a new bot on a new connection
+	Done() <-chan struct{}
+
+	// Say sends a message to the given channel, blocking until it's been delivered (or
+	// has failed to be delivered) or ctx is canceled
+	Say(ctx context.Context, channel string, m outbound.Message) error
+
+	// Shutdown gracefully takes the bot offline: it stops handling new commands, waits
+	// for in-progress command handlers (and the replies they've queued) to finish, then
+	// leaves all channels and quits. If ctx is done before handlers finish, any replies
+	// still queued are abandoned. Once Shutdown returns, the bot is done, and its
+	// connection may be closed.
+	Shutdown(ctx context.Context) error
 }
 
-func NewBot(ctx context.Context, conn Conn, channelName, username, userAccessToken string, messagesChan chan<- *Message, emitBotMessage func(string), authServiceClient auth.ServiceClient, twitchEventsProducer rmq.Producer) (Bot, error) {
+// NewBot initializes a bot that joins the given channels using a single connection.
+// The first channel is the bot's home channel: USERNOTICE events are only published
+// for that channel, and the bot is considered connected once it has joined it.
+func NewBot(ctx context.Context, conn Conn, opts BotOpts, channels []Channel, username, userAccessToken string, messagesChan chan<- *Message, emitBotMessage func(channel string, m outbound.Message), authServiceClient auth.ServiceClient, twitchEventsProducer rmq.Producer) (Bot, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("at least one channel is required")
+	}
+
+	// Prepare default options if not explicitly specified
+	if opts.PingInterval == 0 {
+		opts.PingInterval = 30 * time.Second
+	}
+	if opts.PingTimeout == 0 {
+		opts.PingTimeout = 10 * time.Second
+	}
+	if opts.DeliveryTimeout == 0 {
+		opts.DeliveryTimeout = time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = NewStreamLogger(os.Stdout)
+	}
+	if opts.Commands.Cooldowns == nil {
+		opts.Commands.Cooldowns = commands.NewCooldowns(commands.CooldownConfig{})
+	}
+
 	lines, err := conn.Recv()
 	if err != nil {
 		return nil, err
 	}
 
-	say := func(s string) error {
-		if err := conn.Sendf("PRIVMSG #%s :%s", channelName, s); err != nil {
-			return err
-		}
-		emitBotMessage(s)
-		return nil
-	}
+	// The bot's context lives only as long as the bot: once the bot fails, we stop
+	// sending messages
+	ctx, cancel := context.WithCancel(ctx)
 
 	b := &bot{
-		conn:           conn,
-		channel:        fmt.Sprintf("#%s", channelName),
-		nick:           strings.ToLower(username),
-		accessToken:    userAccessToken,
-		commandHandler: commands.NewHandler(ctx, authServiceClient, say, twitchEventsProducer),
-		signalError: func(err error) {
-			emitBotMessage(fmt.Sprintf("ERROR: %s", err))
-		},
+		conn:                 conn,
+		channels:             make(map[string]*botChannel, len(channels)),
+		nick:                 strings.ToLower(username),
+		accessToken:          userAccessToken,
+		twitchEventsProducer: twitchEventsProducer,
+		cancel:               cancel,
+		done:                 make(chan struct{}),
 	}
+	for _, channel := range channels {
+		if _, ok := b.channels[channel.Name]; ok {
+			cancel()
+			return nil, fmt.Errorf("channel %s is listed more than once", channel.Name)
+		}
+		bc := newBotChannel(ctx, conn, opts, channel, emitBotMessage, authServiceClient, twitchEventsProducer)
+		b.channels[channel.Name] = bc
+		b.channelOrder = append(b.channelOrder, bc)
+	}
+	b.home = b.channelOrder[0]
+	b.signalError = func(err error) {
+		emitBotMessage(b.home.Name, outbound.Message{Text: fmt.Sprintf("ERROR: %s", err)})
+	}
+
 	go func() {
 		for s := range lines {
 			message, err := b.handle(s)
 			if err != nil {
+				// Once we've failed, keep draining lines until the connection is
+				// closed, so that its reader is never left blocked
 				b.fail(err)
+				for range lines {
+				}
 				return
 			}
 			messagesChan <- message
 		}
+
+		// If the connection was closed out from under us, we're no longer connected
+		b.fail(ErrConnectionClosed)
 	}()
 
 	if err := b.init(); err != nil {
+		cancel()
 		return nil, err
 	}
 
+	// Periodically ping the server so that we notice if the connection goes dead
+	go b.keepalive(ctx, opts.PingInterval, opts.PingTimeout)
+
 	return b, nil
 }
 
-type bot struct {
-	conn           Conn
-	channel        string
-	nick           string
-	accessToken    string
+// botChannel holds the state of the bot in a single channel: each channel has its own
+// outbound queue (and thus its own rate limits) and its own command handler
+type botChannel struct {
+	Channel
+	queue          outbound.Queue
+	say            commands.SayFunc
 	commandHandler commands.Handler
-	signalError    func(err error)
+	gotRoomState   bool
+	isModerator    bool
+
+	// delivery, while a message is being sent, receives the outcome reported by
+	// Twitch: nil on USERSTATE, or a NoticeError if the message was rejected
+	delivery          chan error
+	lastDeliveryError *chatbot.ErrorDetails
+	// roomId and botUserId identify the channel's broadcaster and the bot's own user,
+	// as required in order to send announcements
+	roomId     string
+	botUserId  string
+	deliveryMu sync.Mutex
+}
+
+func newBotChannel(ctx context.Context, conn Conn, opts BotOpts, channel Channel, emitBotMessage func(channel string, m outbound.Message), authServiceClient auth.ServiceClient, twitchEventsProducer rmq.Producer) *botChannel {
+	bc := &botChannel{Channel: channel}
+
+	// All messages that the bot sends to the channel go through a queue, which ensures
+	// that we don't exceed Twitch's rate limits, and which retries messages that
+	// Twitch rejects for transient reasons
+	bc.queue = outbound.NewQueue(ctx, func(m outbound.Message) error {
+		var err error
+		if m.Kind == outbound.KindAnnouncement {
+			err = bc.announce(opts.Announce, m)
+		} else {
+			err = bc.deliver(ctx, conn, opts.DeliveryTimeout, m)
+		}
+		if errors.Is(err, outbound.ErrDeliveryUnconfirmed) {
+			// The message was most likely delivered, so it belongs in the chatlog, but
+			// the caller is told that we can't be sure
+			opts.Logger.LogError(fmt.Errorf("message to #%s was not confirmed: %w", channel.Name, err))
+			emitBotMessage(channel.Name, m)
+			return err
+		}
+		if err != nil {
+			bc.recordDeliveryError(err)
+			opts.Logger.LogError(fmt.Errorf("message to #%s was not delivered: %w", channel.Name, err))
+			return err
+		}
+
+		// Twitch echoes announcements back to us as USERNOTICE messages, so only
+		// regular messages need to be emitted to the chatlog directly
+		if m.Kind != outbound.KindAnnouncement {
+			emitBotMessage(channel.Name, m)
+		}
+		return nil
+	}, outboundQueueCapacity)
+	bc.say = func(priority outbound.Priority, m outbound.Message) error {
+		return bc.send(ctx, priority, m)
+	}
+	handlerOpts := opts.Commands
+	handlerOpts.Enabled = bc.allowsCommand
+	bc.commandHandler = commands.NewHandler(ctx, authServiceClient, bc.say, twitchEventsProducer, handlerOpts)
+	return bc
+}
+
+// send queues a message for delivery to the channel, blocking until it's delivered.
+// Twitch drops messages that are too long, so long messages are sent in several
+// parts, each of which is delivered before the next is queued.
+func (bc *botChannel) send(ctx context.Context, priority outbound.Priority, m outbound.Message) error {
+	for _, part := range outbound.SplitMessage(m) {
+		if err := bc.queue.Send(ctx, priority, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver sends a PRIVMSG to the channel, then waits for Twitch to either confirm or
+// reject it, returning outbound.ErrDeliveryUnconfirmed if neither happens before the
+// timeout (or before the bot fails). Twitch doesn't identify which message a NOTICE
+// refers to, so the queue sends only one message at a time to each channel.
+func (bc *botChannel) deliver(ctx context.Context, conn Conn, timeout time.Duration, m outbound.Message) error {
+	result := make(chan error, 1)
+	bc.deliveryMu.Lock()
+	bc.delivery = result
+	bc.deliveryMu.Unlock()
+	defer func() {
+		bc.deliveryMu.Lock()
+		bc.delivery = nil
+		bc.deliveryMu.Unlock()
+	}()
+
+	if err := conn.Sendf("%sPRIVMSG #%s :%s", formatOutboundTags(m), bc.Name, m.WireText()); err != nil {
+		return err
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+	case <-ctx.Done():
+	}
+	return outbound.ErrDeliveryUnconfirmed
+}
+
+// announce sends an announcement to the channel via the given AnnounceFunc
+func (bc *botChannel) announce(announce AnnounceFunc, m outbound.Message) error {
+	if announce == nil {
+		return ErrAnnouncementsUnsupported
+	}
+	bc.deliveryMu.Lock()
+	roomId, botUserId := bc.roomId, bc.botUserId
+	bc.deliveryMu.Unlock()
+	if roomId == "" || botUserId == "" {
+		return fmt.Errorf("can't send announcement before joining #%s", bc.Name)
+	}
+	return announce(roomId, botUserId, m.Text, m.Color)
+}
+
+// recordDeliveryError notes the most recent failure to deliver a message to the
+// channel
+func (bc *botChannel) recordDeliveryError(err error) {
+	bc.deliveryMu.Lock()
+	defer bc.deliveryMu.Unlock()
+	bc.lastDeliveryError = &chatbot.ErrorDetails{
+		Message: err.Error(),
+		Time:    time.Now(),
+	}
+}
+
+// resolveDelivery reports the outcome of the message currently being delivered, if
+// any
+func (bc *botChannel) resolveDelivery(err error) {
+	bc.deliveryMu.Lock()
+	defer bc.deliveryMu.Unlock()
+	if bc.delivery != nil {
+		bc.delivery <- err
+		bc.delivery = nil
+	}
+}
+
+type bot struct {
+	conn         Conn
+	channels     map[string]*botChannel
+	channelOrder []*botChannel
+	home         *botChannel
+	nick         string
+	accessToken  string
+	signalError  func(err error)
+
+	twitchEventsProducer rmq.Producer
 
 	err          error
+	cancel       context.CancelFunc
+	done         chan struct{}
 	lastPingTime time.Time
+	mu           sync.RWMutex
+
+	pendingPing  string
+	pingSentAt   time.Time
+	lastPongTime time.Time
+	latency      time.Duration
+	pingMu       sync.RWMutex
 
 	gotCapAck          bool
 	gotGlobalUserState bool
-	gotRoomState       bool
+	userId             string
+	connectedSince     time.Time
+
+	shuttingDown bool
+	inProgress   sync.WaitGroup
 }
 
 func (b *bot) init() error {
@@ -100,6 +364,10 @@ func (b *bot) handle(s string) (*Message, error) {
 		return nil, err
 	}
 
+	// Hold the lock while we update our state in response to the message
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	// If we're still in the init stage, we need to send a JOIN message, but only once
 	// user login is complete
 	hasSentJoin := b.gotCapAck && b.gotGlobalUserState
@@ -114,15 +382,35 @@ func (b *bot) handle(s string) (*Message, error) {
 		b.lastPingTime = time.Now()
 		return m, nil
 
+	// If we get a PONG in response to the last PING we sent, the connection is alive,
+	// and we can note how long the round trip took
+	case "PONG":
+		b.pingMu.Lock()
+		if b.pendingPing != "" && m.Body == b.pendingPing {
+			b.lastPongTime = time.Now()
+			b.latency = b.lastPongTime.Sub(b.pingSentAt)
+			b.pendingPing = ""
+		}
+		b.pingMu.Unlock()
+		return m, nil
+
 	// If we get a RECONNECT message, the connection is being closed server-side for
 	// maintenance reasons and we should attempt to reconnect
 	case "RECONNECT":
 		return m, ErrReceivedReconnect
 
-	// If we get a NOTICE telling us our login failed, abort
+	// If we get a NOTICE telling us our login failed, abort; if it tells us that a
+	// message we sent was rejected, report that failure to the channel's queue
 	case "NOTICE":
-		if m.Body == "Login authentication failed" {
-			return m, fmt.Errorf("Login authentication failed")
+		if notice, err := ParseNotice(m); err == nil {
+			if notice.Text == ErrLoginFailed.Error() {
+				return m, ErrLoginFailed
+			}
+			if bc := b.channels[notice.Channel]; bc != nil {
+				if noticeErr := noticeErrorFromNotice(notice); noticeErr != nil {
+					bc.resolveDelivery(noticeErr)
+				}
+			}
 		}
 		// All other NOTICE message should be ignored
 		return m, nil
@@ -138,43 +426,110 @@ func (b *bot) handle(s string) (*Message, error) {
 		}
 		return m, nil
 
-	// If we get a GLOBALUSERSTATE after a CAP * ACK, we're ready to join the channel
+	// If we get a GLOBALUSERSTATE after a CAP * ACK, we're ready to join our channels
 	case "GLOBALUSERSTATE":
 		if !b.gotGlobalUserState {
 			b.gotGlobalUserState = true
+			if gus, err := ParseGlobalUserstate(m); err == nil {
+				b.userId = gus.UserId
+				for _, bc := range b.channelOrder {
+					bc.deliveryMu.Lock()
+					bc.botUserId = gus.UserId
+					bc.deliveryMu.Unlock()
+				}
+			}
 			if !hasSentJoin && b.gotCapAck {
 				return m, b.sendJoin()
 			}
 		}
 		return m, nil
 
-	// If we're receiving a ROOMSTATE message for the channel we wanted to join, we've
-	// successfully joined that channel
+	// If we're receiving a ROOMSTATE message for a channel we wanted to join, we've
+	// successfully joined that channel; ROOMSTATE also tells us whether the channel is
+	// in slow mode, either upon joining or when the setting changes
 	case "ROOMSTATE":
-		if includes(m.Params, b.channel) {
-			b.gotRoomState = true
+		if rs, err := ParseRoomstate(m); err == nil {
+			if bc := b.channels[rs.Channel]; bc != nil {
+				if bc == b.home && !bc.gotRoomState {
+					b.connectedSince = time.Now()
+				}
+				bc.gotRoomState = true
+				if rs.RoomId != "" {
+					bc.deliveryMu.Lock()
+					bc.roomId = rs.RoomId
+					bc.deliveryMu.Unlock()
+				}
+				if rs.SlowMode != nil {
+					bc.queue.SetSlowMode(*rs.SlowMode)
+				}
+			}
+		}
+		return m, nil
+
+	// USERSTATE describes the bot's own state in a channel, which tells us whether we
+	// have moderator privileges (and thus higher rate limits) in that channel; Twitch
+	// also sends it to confirm that a message we sent was delivered
+	case "USERSTATE":
+		if us, err := ParseUserstate(m); err == nil {
+			if bc := b.channels[us.Channel]; bc != nil {
+				bc.isModerator = us.IsModerator || roles.HasBadge(us.Badges, "broadcaster")
+				bc.queue.SetModerator(bc.isModerator)
+				bc.resolveDelivery(nil)
+			}
 		}
 		return m, nil
 
-	// If we get a PRIVMSG prefixed with '!', attempt to parse it as a command
+	// USERNOTICE tells us that a user has subscribed, gifted subs, raided the channel,
+	// etc., which the rest of the platform needs to know about: only events in our
+	// home channel are relevant to the platform
+	case "USERNOTICE":
+		if un, err := ParseUsernotice(m); err == nil && un.Channel == b.home.Name && !b.shuttingDown {
+			b.inProgress.Add(1)
+			go func() {
+				defer b.inProgress.Done()
+				b.publishUsernotice(un)
+			}()
+		}
+		return m, nil
+
+	// If we get a PRIVMSG prefixed with '!', attempt to parse it as a command and handle
+	// it (unless we're shutting down): the command handler ignores any commands that
+	// aren't enabled in the channel
 	case "PRIVMSG":
-		if includes(m.Params, b.channel) && len(m.Body) > 1 && m.Body[0] == '!' {
-			command := m.Body[1:]
+		if pm, err := ParsePrivmsg(m); err == nil && !b.shuttingDown && len(pm.Text) > 1 && pm.Text[0] == '!' {
+			bc := b.channels[pm.Channel]
+			if bc == nil || len(bc.Commands) == 0 {
+				return m, nil
+			}
+			command := pm.Text[1:]
 			args := ""
-			if spacePos := strings.IndexRune(m.Body, ' '); spacePos >= 2 {
-				command = m.Body[1:spacePos]
-				args = m.Body[spacePos+1:]
+			if spacePos := strings.IndexRune(pm.Text, ' '); spacePos >= 2 {
+				command = pm.Text[1:spacePos]
+				args = pm.Text[spacePos+1:]
 			}
 
-			userId := m.Extra["user-id"]
-			displayName := m.Extra["display-name"]
-			if userId != "" && displayName != "" {
-				go func() {
-					if err := b.commandHandler.Handle(command, args, userId, displayName); err != nil {
-						b.conn.Sendf("PRIVMSG %s :%s", b.channel, err)
-					}
-				}()
+			inv := &commands.Invocation{
+				Channel:         pm.Channel,
+				Command:         command,
+				Args:            args,
+				MessageId:       pm.MessageId,
+				MessageText:     pm.Text,
+				UserId:          pm.UserId,
+				UserLogin:       pm.Login,
+				UserDisplayName: pm.DisplayName,
+				UserRoles:       pm.Roles(),
 			}
+			b.inProgress.Add(1)
+			go func() {
+				defer b.inProgress.Done()
+				// If the reply was rejected by Twitch (or may not have been delivered),
+				// that failure has already been logged, and replying with an error
+				// would likely fail as well
+				var noticeErr *NoticeError
+				if err := bc.commandHandler.Handle(inv); err != nil && !errors.As(err, &noticeErr) && !errors.Is(err, outbound.ErrDeliveryUnconfirmed) {
+					bc.say(outbound.PriorityHigh, inv.Reply(err.Error()))
+				}
+			}()
 		}
 	}
 
@@ -182,33 +537,225 @@ func (b *bot) handle(s string) (*Message, error) {
 	return m, nil
 }
 
+// keepalive sends a PING to the server at the given interval until ctx is canceled,
+// and fails the bot if the server doesn't respond with a PONG within the timeout
+func (b *bot) keepalive(ctx context.Context, interval, timeout time.Duration) {
+	for {
+		// Wait until it's time to send another PING
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		// Send a PING with a unique token, which the server will echo back to us
+		token := strconv.FormatInt(time.Now().UnixNano(), 10)
+		b.pingMu.Lock()
+		b.pendingPing = token
+		b.pingSentAt = time.Now()
+		b.pingMu.Unlock()
+		if err := b.conn.Sendf("PING :%s", token); err != nil {
+			b.fail(fmt.Errorf("failed to send PING: %w", err))
+			return
+		}
+
+		// Wait for the timeout to elapse, then verify that we got our PONG
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(timeout):
+		}
+		b.pingMu.RLock()
+		gotPong := b.pendingPing != token
+		b.pingMu.RUnlock()
+		if !gotPong {
+			b.fail(ErrPingTimeout)
+			return
+		}
+	}
+}
+
 func (b *bot) sendJoin() error {
-	return b.conn.Sendf("JOIN %s", b.channel)
+	for _, bc := range b.channelOrder {
+		if err := b.conn.Sendf("JOIN #%s", bc.Name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *bot) fail(err error) {
-	b.signalError(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Only the first error is recorded: once the bot has failed, it's done for good
+	if b.err != nil {
+		return
+	}
+	if !errors.Is(err, ErrConnectionClosed) && !errors.Is(err, ErrShutDown) {
+		b.signalError(err)
+	}
 	b.err = err
+	b.cancel()
+	close(b.done)
 }
 
 func (b *bot) GetStatus() chatbot.Status {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
 	if b.err != nil {
 		return chatbot.StatusDisconnected
 	}
-	if b.gotCapAck && b.gotGlobalUserState && b.gotRoomState {
+	if b.gotCapAck && b.gotGlobalUserState && b.home.gotRoomState {
 		return chatbot.StatusConnected
 	}
 	return chatbot.StatusConnecting
 }
 
 func (b *bot) GetLastError() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return b.err
 }
 
 func (b *bot) GetLastPingTime() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return b.lastPingTime
 }
 
+func (b *bot) GetLastPongTime() time.Time {
+	b.pingMu.RLock()
+	defer b.pingMu.RUnlock()
+	return b.lastPongTime
+}
+
+func (b *bot) GetLatency() time.Duration {
+	b.pingMu.RLock()
+	defer b.pingMu.RUnlock()
+	return b.latency
+}
+
+func (b *bot) GetUserId() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.userId
+}
+
+func (b *bot) GetConnectedSince() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.connectedSince
+}
+
+func (b *bot) GetChannelStatuses() []chatbot.ChannelStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	statuses := make([]chatbot.ChannelStatus, 0, len(b.channelOrder))
+	for _, bc := range b.channelOrder {
+		bc.deliveryMu.Lock()
+		lastDeliveryError := bc.lastDeliveryError
+		bc.deliveryMu.Unlock()
+		statuses = append(statuses, chatbot.ChannelStatus{
+			Name:              bc.Name,
+			Joined:            bc.gotRoomState && b.err == nil,
+			IsModerator:       bc.isModerator,
+			LastDeliveryError: lastDeliveryError,
+		})
+	}
+	return statuses
+}
+
+func (b *bot) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *bot) Say(ctx context.Context, channel string, m outbound.Message) error {
+	// Messages sent while we're shutting down are rejected; otherwise, they're tracked
+	// so that shutdown waits for them to be delivered
+	b.mu.Lock()
+	bc := b.channels[channel]
+	if bc == nil {
+		b.mu.Unlock()
+		return ErrUnknownChannel
+	}
+	if b.err != nil {
+		err := b.err
+		b.mu.Unlock()
+		return err
+	}
+	if b.shuttingDown {
+		b.mu.Unlock()
+		return ErrShutDown
+	}
+	b.inProgress.Add(1)
+	b.mu.Unlock()
+	defer b.inProgress.Done()
+
+	return bc.send(ctx, outbound.PriorityHigh, m)
+}
+
+func (b *bot) Shutdown(ctx context.Context) error {
+	// Stop handling new commands and events
+	b.mu.Lock()
+	b.shuttingDown = true
+	b.mu.Unlock()
+
+	// Wait for any commands that are already being handled to finish, including the
+	// delivery of any replies they've queued
+	finished := make(chan struct{})
+	go func() {
+		b.inProgress.Wait()
+		close(finished)
+	}()
+	var err error
+	select {
+	case <-finished:
+	case <-b.done:
+	case <-ctx.Done():
+		err = fmt.Errorf("abandoned in-progress commands during shutdown: %w", ctx.Err())
+	}
+
+	// Leave all channels, then quit, giving the server a chance to close the
+	// connection on its end
+	if b.GetLastError() == nil {
+		for _, bc := range b.channelOrder {
+			b.conn.Sendf("PART #%s", bc.Name)
+		}
+		b.conn.Send("QUIT")
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+		}
+	}
+
+	// Stop sending messages, failing any that are still queued, and mark the bot as
+	// done
+	b.fail(ErrShutDown)
+	return err
+}
+
+// publishUsernotice produces events to the twitch-events queue in response to a
+// USERNOTICE, signaling an error if that fails
+func (b *bot) publishUsernotice(un *Usernotice) {
+	events, err := twitchEventsFromUsernotice(un)
+	if err != nil {
+		b.signalError(fmt.Errorf("failed to handle %s USERNOTICE: %w", un.Kind, err))
+		return
+	}
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err == nil {
+			err = b.twitchEventsProducer.Send(context.Background(), data)
+		}
+		if err != nil {
+			b.signalError(fmt.Errorf("failed to publish %s event: %w", ev.Type, err))
+		}
+	}
+}
+
 func includes(params []string, s string) bool {
 	for _, p := range params {
 		if p == s {
@@ -217,3 +764,13 @@ func includes(params []string, s string) bool {
 	}
 	return false
 }
+
+// formatOutboundTags returns the client tags that should precede the PRIVMSG for an
+// outbound message, if any
+func formatOutboundTags(m outbound.Message) string {
+	tags := make(map[string]string)
+	if m.ReplyParent != nil && m.ReplyParent.MessageId != "" {
+		tags["reply-parent-msg-id"] = m.ReplyParent.MessageId
+	}
+	return formatTags(tags)
+}
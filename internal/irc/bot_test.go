@@ -0,0 +1,562 @@
+package irc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot"
+	"github.com/golden-vcr/chatbot/internal/irc/irctest"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bot_loginFailed(t *testing.T) {
+	srv, err := irctest.NewServer(irctest.ServerOpts{
+		AcceptToken: func(token string) bool { return token == "good-token" },
+	})
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, err := NewConn(ctx, ConnOpts{Dial: srv.Dial, Logger: NewStreamLogger(io.Discard)})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	messagesChan := make(chan *Message)
+	go func() {
+		for range messagesChan {
+		}
+	}()
+	b, err := NewBot(ctx, conn, BotOpts{}, []Channel{testChannel}, "TapeBoy", "bad-token", messagesChan, func(string, outbound.Message) {}, nil, nil)
+	assert.NoError(t, err)
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("bot did not fail after login was rejected")
+	}
+	assert.EqualError(t, b.GetLastError(), "Login authentication failed")
+	assert.Equal(t, chatbot.StatusDisconnected, b.GetStatus())
+}
+
+func Test_Bot_keepalive(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	b := newTestBot(t, c, BotOpts{
+		PingInterval: 20 * time.Millisecond,
+		PingTimeout:  20 * time.Millisecond,
+	}, func(string, outbound.Message) {})
+	assert.Equal(t, chatbot.StatusConnected, b.GetStatus())
+
+	// The bot should send a PING on its own; if we answer it, the bot should record
+	// the round-trip time and remain connected
+	ping := c.awaitSent(t, "PING :")
+	token := strings.TrimPrefix(ping, "PING :")
+	c.recv(fmt.Sprintf(":tmi.twitch.tv PONG tmi.twitch.tv :%s", token))
+	assert.Eventually(t, func() bool {
+		return !b.GetLastPongTime().IsZero()
+	}, time.Second, time.Millisecond)
+	assert.Greater(t, b.GetLatency(), time.Duration(0))
+	assert.NoError(t, b.GetLastError())
+
+	// If we ignore the next PING, the bot should fail
+	c.awaitSent(t, "PING :")
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("bot did not fail after PING timeout")
+	}
+	assert.ErrorIs(t, b.GetLastError(), ErrPingTimeout)
+	assert.Equal(t, chatbot.StatusDisconnected, b.GetStatus())
+}
+
+func Test_Bot_splitsLongMessages(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	emitted := make(chan string, 8)
+	newTestBot(t, c, BotOpts{}, func(channel string, m outbound.Message) {
+		emitted <- m.Text
+	})
+
+	// An unrecognized command causes the bot to reply with an error that echoes the
+	// command: if that reply is too long, it should be sent as two messages (without
+	// breaking up the command), each of which is also emitted to the chatlog
+	command := strings.Repeat("x", 500)
+	c.recv(fmt.Sprintf("@badges=;color=;display-name=Someone;emotes=;id=1;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!%s", command))
+	first := c.awaitSent(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :")
+	second := c.awaitSent(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :")
+	assert.Equal(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :unrecognized command:", first)
+	assert.Equal(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :"+command, second)
+	assert.Equal(t, "unrecognized command:", <-emitted)
+	assert.Equal(t, command, <-emitted)
+}
+
+func Test_Bot_repliesInThread(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	emitted := make(chan outbound.Message, 8)
+	newTestBot(t, c, BotOpts{}, func(channel string, m outbound.Message) {
+		emitted <- m
+	})
+
+	// The bot should reply to a command with a threaded reply to the message that
+	// invoked it, and the emitted message should identify that parent message
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=a5f2c3;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!camera please")
+	sent := c.awaitSent(t, "@reply-parent-msg-id=a5f2c3 PRIVMSG #goldenvcr :")
+	assert.Equal(t, "@reply-parent-msg-id=a5f2c3 PRIVMSG #goldenvcr :A camera is a device for recording visual images in the form of photographs, film, or video signals.", sent)
+	m := <-emitted
+	assert.Equal(t, &outbound.ReplyParent{
+		MessageId: "a5f2c3",
+		UserId:    "42",
+		Username:  "Someone",
+		Text:      "!camera please",
+	}, m.ReplyParent)
+}
+
+func Test_Bot_deliveryFailures(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	emitted := make(chan string, 8)
+	b := newTestBot(t, c, BotOpts{Logger: NewStreamLogger(io.Discard)}, func(channel string, m outbound.Message) {
+		emitted <- m.Text
+	})
+
+	// If Twitch rejects a reply for a reason that won't change if we try again, the
+	// reply should be dropped without being emitted to the chatlog, the failure should
+	// be reported in the channel's status, and the bot should not reply with an error
+	c.reject("msg_banned")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=1;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!camera")
+	c.awaitSent(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :A camera")
+	assert.Eventually(t, func() bool {
+		return b.GetChannelStatuses()[0].LastDeliveryError != nil
+	}, time.Second, time.Millisecond)
+	assert.Contains(t, b.GetChannelStatuses()[0].LastDeliveryError.Message, "bot is banned from the channel")
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Lock()
+	for _, s := range c.sent {
+		assert.NotContains(t, s, "PRIVMSG")
+	}
+	c.mu.Unlock()
+	assert.Empty(t, emitted)
+
+	// If a reply is rejected due to slow mode, it should be sent again once the delay
+	// has elapsed
+	c.reject("msg_slowmode")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=2;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!youtube")
+	first := c.awaitSent(t, "@reply-parent-msg-id=2 PRIVMSG #goldenvcr :Watch VODs")
+	c.mu.Lock()
+	c.sent = nil
+	c.mu.Unlock()
+	var second string
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, s := range c.sent {
+			if strings.HasPrefix(s, "@reply-parent-msg-id=2 PRIVMSG") {
+				second = s
+				return true
+			}
+		}
+		return false
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, first, second)
+	assert.Equal(t, strings.SplitN(first, " :", 2)[1], <-emitted)
+	assert.Contains(t, b.GetChannelStatuses()[0].LastDeliveryError.Message, "channel is in slow mode")
+	assert.NoError(t, b.GetLastError())
+}
+
+func Test_Bot_Say(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	emitted := make(chan outbound.Message, 8)
+	type announcement struct {
+		broadcasterId string
+		moderatorId   string
+		text          string
+		color         string
+	}
+	announced := make(chan announcement, 8)
+	b := newTestBot(t, c, BotOpts{
+		DeliveryTimeout: 20 * time.Millisecond,
+		Announce: func(broadcasterId, moderatorId, text, color string) error {
+			announced <- announcement{broadcasterId, moderatorId, text, color}
+			return nil
+		},
+	}, func(channel string, m outbound.Message) {
+		emitted <- m
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// A regular message should be sent as a PRIVMSG and emitted to the chatlog
+	err := b.Say(ctx, "goldenvcr", outbound.Message{Text: "hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, "PRIVMSG #goldenvcr :hello", c.awaitSent(t, "PRIVMSG"))
+	assert.Equal(t, "hello", (<-emitted).Text)
+
+	// An action should be sent as a CTCP ACTION
+	err = b.Say(ctx, "goldenvcr", outbound.Message{Text: "waves", Kind: outbound.KindAction})
+	assert.NoError(t, err)
+	assert.Equal(t, "PRIVMSG #goldenvcr :\x01ACTION waves\x01", c.awaitSent(t, "PRIVMSG"))
+	assert.Equal(t, "waves", (<-emitted).Text)
+
+	// An announcement should be sent via the Twitch API, identifying the channel and
+	// the bot by the user IDs reported in ROOMSTATE and GLOBALUSERSTATE
+	err = b.Say(ctx, "goldenvcr", outbound.Message{Text: "we're live", Kind: outbound.KindAnnouncement, Color: "purple"})
+	assert.NoError(t, err)
+	assert.Equal(t, announcement{"953753877", "1001686376", "we're live", "purple"}, <-announced)
+	assert.False(t, c.hasSent("PRIVMSG #goldenvcr :we're live"))
+
+	// If Twitch neither confirms nor rejects a message, the caller should be told that
+	// its delivery wasn't confirmed, but it's most likely in chat
+	c.ignore()
+	err = b.Say(ctx, "goldenvcr", outbound.Message{Text: "anyone there?"})
+	assert.ErrorIs(t, err, outbound.ErrDeliveryUnconfirmed)
+	assert.Equal(t, "PRIVMSG #goldenvcr :anyone there?", c.awaitSent(t, "PRIVMSG"))
+	assert.Equal(t, "anyone there?", (<-emitted).Text)
+	assert.Empty(t, b.GetChannelStatuses()[0].LastDeliveryError)
+
+	// Messages can't be sent to channels the bot hasn't joined
+	err = b.Say(ctx, "somewhereelse", outbound.Message{Text: "hello"})
+	assert.ErrorIs(t, err, ErrUnknownChannel)
+}
+
+func Test_Bot_multipleChannels(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	type emittedMessage struct {
+		channel string
+		text    string
+	}
+	emitted := make(chan emittedMessage, 8)
+	channels := []Channel{
+		testChannel,
+		{Name: "wasabimilkshake", Commands: []string{"camera"}},
+		{Name: "testchannel", Commands: []string{}},
+	}
+	messagesChan := make(chan *Message)
+	go func() {
+		for range messagesChan {
+		}
+	}()
+	b, err := NewBot(c.ctx, c, BotOpts{}, channels, "TapeBoy", "token", messagesChan, func(channel string, m outbound.Message) {
+		emitted <- emittedMessage{channel, m.Text}
+	}, nil, nil)
+	assert.NoError(t, err)
+
+	// The bot should join all channels on its single connection, and it should be
+	// considered connected once it has joined its home channel
+	c.awaitSent(t, "NICK tapeboy")
+	c.recv(":tmi.twitch.tv CAP * ACK :twitch.tv/commands twitch.tv/tags")
+	c.recv("@badge-info=;badges=;color=;display-name=TapeBoy;emote-sets=0;user-id=1001686376;user-type= :tmi.twitch.tv GLOBALUSERSTATE")
+	c.awaitSent(t, "JOIN #goldenvcr")
+	c.awaitSent(t, "JOIN #wasabimilkshake")
+	c.awaitSent(t, "JOIN #testchannel")
+	c.recv("@emote-only=0;followers-only=-1;r9k=0;room-id=90790024;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #wasabimilkshake")
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, chatbot.StatusConnecting, b.GetStatus())
+	c.recv("@emote-only=0;followers-only=-1;r9k=0;room-id=953753877;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #goldenvcr")
+	assert.Eventually(t, func() bool {
+		return b.GetStatus() == chatbot.StatusConnected
+	}, time.Second, time.Millisecond)
+
+	// Commands that aren't enabled in a channel should be ignored
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=1;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #testchannel :!camera")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=2;room-id=90790024;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #wasabimilkshake :!youtube")
+
+	// Enabled commands should be answered in the channel where they were invoked
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=3;room-id=90790024;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #wasabimilkshake :!camera")
+	sent := c.awaitSent(t, "@reply-parent-msg-id=")
+	assert.True(t, strings.HasPrefix(sent, "@reply-parent-msg-id=3 PRIVMSG #wasabimilkshake :A camera"))
+	assert.Equal(t, emittedMessage{"wasabimilkshake", strings.SplitN(sent, " :", 2)[1]}, <-emitted)
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=4;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!camera")
+	sent = c.awaitSent(t, "@reply-parent-msg-id=")
+	assert.True(t, strings.HasPrefix(sent, "@reply-parent-msg-id=4 PRIVMSG #goldenvcr :A camera"))
+	assert.Equal(t, "goldenvcr", (<-emitted).channel)
+}
+
+func Test_Bot_Shutdown(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	b := newTestBot(t, c, BotOpts{}, func(string, outbound.Message) {})
+
+	// Put the channel in slow mode, so that the second of two replies will be held in
+	// the queue for a second (the replies differ, so they can't be coalesced)
+	c.recv("@room-id=953753877;slow=1 :tmi.twitch.tv ROOMSTATE #goldenvcr")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=1;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!camera")
+	c.awaitSent(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=2;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!youtube")
+	time.Sleep(10 * time.Millisecond)
+
+	// Once we start shutting down, the bot should ignore new commands, but it should
+	// deliver the reply that's already queued before leaving the channel and quitting
+	go func() {
+		for !c.hasSent("QUIT") {
+			time.Sleep(time.Millisecond)
+		}
+		c.Close()
+	}()
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		shutdownErr <- b.Shutdown(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=3;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!camera")
+	c.mu.Lock()
+	sentBeforeDrain := append([]string{}, c.sent...)
+	c.mu.Unlock()
+	assert.Empty(t, sentBeforeDrain)
+
+	assert.NoError(t, <-shutdownErr)
+	assert.Equal(t, chatbot.StatusDisconnected, b.GetStatus())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if assert.Len(t, c.sent, 3) {
+		assert.True(t, strings.HasPrefix(c.sent[0], "@reply-parent-msg-id=2 PRIVMSG #goldenvcr :"))
+		assert.Equal(t, "PART #goldenvcr", c.sent[1])
+		assert.Equal(t, "QUIT", c.sent[2])
+	}
+}
+
+func Test_Bot_Shutdown_deadline(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	b := newTestBot(t, c, BotOpts{}, func(string, outbound.Message) {})
+
+	// If a queued reply can't be delivered before the deadline, the bot should abandon
+	// it and leave the channel anyway
+	c.recv("@room-id=953753877;slow=30 :tmi.twitch.tv ROOMSTATE #goldenvcr")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=1;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!camera")
+	c.awaitSent(t, "@reply-parent-msg-id=1 PRIVMSG #goldenvcr :")
+	c.recv("@badges=;color=;display-name=Someone;emotes=;id=2;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :!youtube")
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := b.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	c.awaitSent(t, "PART #goldenvcr")
+	c.awaitSent(t, "QUIT")
+	assert.ErrorIs(t, b.GetLastError(), ErrShutDown)
+}
+
+func Test_Bot_failureWithPendingLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		firstLine string
+		wantErr   string
+	}{
+		{
+			"reconnect",
+			":tmi.twitch.tv RECONNECT",
+			ErrReceivedReconnect.Error(),
+		},
+		{
+			"malformed line",
+			"@=x :tmi.twitch.tv NOTICE * :hello",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			serverDone := make(chan struct{})
+			go func() {
+				io.Copy(io.Discard, server)
+				close(serverDone)
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			conn, err := NewConn(ctx, ConnOpts{
+				Dial:   func(context.Context, string) (net.Conn, error) { return client, nil },
+				Logger: NewStreamLogger(io.Discard),
+			})
+			assert.NoError(t, err)
+			messagesChan := make(chan *Message)
+			go func() {
+				for range messagesChan {
+				}
+			}()
+			b, err := NewBot(ctx, conn, BotOpts{}, []Channel{testChannel}, "TapeBoy", "token", messagesChan, func(string, outbound.Message) {}, nil, nil)
+			assert.NoError(t, err)
+
+			// The bot should fail on the first line, but lines that arrive before the
+			// connection is closed must not leave the connection's reader blocked
+			_, err = server.Write([]byte(tt.firstLine + "\n"))
+			assert.NoError(t, err)
+			select {
+			case <-b.Done():
+			case <-time.After(time.Second):
+				t.Fatalf("bot did not fail")
+			}
+			if tt.wantErr != "" {
+				assert.EqualError(t, b.GetLastError(), tt.wantErr)
+			} else {
+				assert.Error(t, b.GetLastError())
+			}
+			_, err = server.Write([]byte("PING :tmi.twitch.tv\n"))
+			assert.NoError(t, err)
+
+			// Closing the connection should not panic
+			conn.Close()
+			select {
+			case <-serverDone:
+			case <-time.After(time.Second):
+				t.Fatalf("connection was not closed")
+			}
+		})
+	}
+}
+
+func Test_NewBot_invalidChannels(t *testing.T) {
+	c := newScriptedConn()
+	defer c.Close()
+	_, err := NewBot(c.ctx, c, BotOpts{}, nil, "TapeBoy", "token", nil, nil, nil, nil)
+	assert.EqualError(t, err, "at least one channel is required")
+	_, err = NewBot(c.ctx, c, BotOpts{}, []Channel{testChannel, testChannel}, "TapeBoy", "token", nil, nil, nil, nil)
+	assert.EqualError(t, err, "channel goldenvcr is listed more than once")
+}
+
+// testChannel is the home channel joined by bots in tests, with all commands enabled
+var testChannel = Channel{Name: "goldenvcr", Commands: []string{AllCommands}}
+
+// newTestBot initializes a Bot on the given scriptedConn and completes the Twitch IRC
+// handshake for channel #goldenvcr
+func newTestBot(t *testing.T, c *scriptedConn, opts BotOpts, emitBotMessage func(channel string, m outbound.Message)) Bot {
+	messagesChan := make(chan *Message)
+	go func() {
+		for range messagesChan {
+		}
+	}()
+
+	b, err := NewBot(c.ctx, c, opts, []Channel{testChannel}, "TapeBoy", "token", messagesChan, emitBotMessage, nil, nil)
+	assert.NoError(t, err)
+	c.awaitSent(t, "NICK tapeboy")
+	c.recv(":tmi.twitch.tv CAP * ACK :twitch.tv/commands twitch.tv/tags")
+	c.recv("@badge-info=;badges=;color=;display-name=TapeBoy;emote-sets=0;user-id=1001686376;user-type= :tmi.twitch.tv GLOBALUSERSTATE")
+	c.awaitSent(t, "JOIN #goldenvcr")
+	c.recv("@emote-only=0;followers-only=-1;r9k=0;room-id=953753877;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #goldenvcr")
+	assert.Eventually(t, func() bool {
+		return b.GetStatus() == chatbot.StatusConnected
+	}, time.Second, time.Millisecond)
+	return b
+}
+
+// scriptedConn is a Conn that lets a test inject received lines and inspect sent lines.
+// Like Twitch, it confirms each PRIVMSG with a USERSTATE, unless a rejection has been
+// scripted for that message.
+type scriptedConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lines      chan string
+	sent       []string
+	rejections []string
+	closed     bool
+	mu         sync.Mutex
+}
+
+func newScriptedConn() *scriptedConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scriptedConn{
+		ctx:    ctx,
+		cancel: cancel,
+		lines:  make(chan string, 32),
+	}
+}
+
+func (c *scriptedConn) recv(line string) {
+	c.lines <- line
+}
+
+// reject causes the next PRIVMSG to be answered with a NOTICE carrying the given
+// msg-id, rather than being confirmed
+func (c *scriptedConn) reject(msgId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rejections = append(c.rejections, msgId)
+}
+
+// ignore causes the next PRIVMSG to go unanswered, so that its delivery is never
+// confirmed
+func (c *scriptedConn) ignore() {
+	c.reject("")
+}
+
+func (c *scriptedConn) awaitSent(t *testing.T, prefix string) string {
+	found := ""
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, s := range c.sent {
+			if strings.HasPrefix(s, prefix) {
+				found = s
+				c.sent = c.sent[i+1:]
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+	return found
+}
+
+func (c *scriptedConn) hasSent(line string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.sent {
+		if s == line {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *scriptedConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.cancel()
+		close(c.lines)
+	}
+}
+
+func (c *scriptedConn) Recv() (<-chan string, error) {
+	return c.lines, nil
+}
+
+func (c *scriptedConn) Send(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, s)
+
+	if _, privmsg, ok := strings.Cut(s, "PRIVMSG "); ok && !c.closed {
+		channel, _, _ := strings.Cut(privmsg, " ")
+		reply := fmt.Sprintf("@badge-info=;badges=;color=;display-name=TapeBoy;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE %s", channel)
+		if len(c.rejections) > 0 {
+			reply = fmt.Sprintf("@msg-id=%s :tmi.twitch.tv NOTICE %s :Your message was not sent.", c.rejections[0], channel)
+			if c.rejections[0] == "" {
+				reply = ""
+			}
+			c.rejections = c.rejections[1:]
+		}
+		if reply != "" {
+			c.lines <- reply
+		}
+	}
+	return nil
+}
+
+func (c *scriptedConn) Sendf(format string, a ...any) error {
+	return c.Send(fmt.Sprintf(format, a...))
+}
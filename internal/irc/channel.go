@@ -0,0 +1,56 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AllCommands may be listed in a Channel's Commands to enable every command
+const AllCommands = "*"
+
+// Channel describes a Twitch channel that the bot should join
+type Channel struct {
+	// Name is the name of the channel, without the leading '#'
+	Name string
+	// Commands lists the names of the commands (without the leading '!') that the bot
+	// will respond to in the channel: if it includes AllCommands, the bot responds to
+	// any command, and if it's empty, the bot ignores all commands
+	Commands []string
+}
+
+// ParseChannel parses a channel spec, which takes the form '<name>' for a channel in
+// which the bot should not respond to any commands, or '<name>:<cmd>+<cmd>+...' to
+// enable a specific set of commands (where '<name>:*' enables all commands)
+func ParseChannel(spec string) (Channel, error) {
+	name, commandList, hasCommands := strings.Cut(strings.TrimSpace(spec), ":")
+	name = strings.ToLower(strings.TrimPrefix(name, "#"))
+	if name == "" || strings.ContainsAny(name, " #,") {
+		return Channel{}, fmt.Errorf("invalid channel name in spec '%s'", spec)
+	}
+
+	commands := []string{}
+	if hasCommands {
+		for _, command := range strings.Split(commandList, "+") {
+			command = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(command), "!"))
+			if command == "" {
+				return Channel{}, fmt.Errorf("empty command name in spec '%s'", spec)
+			}
+			commands = append(commands, command)
+		}
+	}
+	return Channel{
+		Name:     name,
+		Commands: commands,
+	}, nil
+}
+
+// allowsCommand returns true if the bot should respond to the given command (without
+// the leading '!') in this channel
+func (c *Channel) allowsCommand(command string) bool {
+	for _, allowed := range c.Commands {
+		if allowed == AllCommands || strings.EqualFold(allowed, command) {
+			return true
+		}
+	}
+	return false
+}
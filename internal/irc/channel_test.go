@@ -0,0 +1,84 @@
+package irc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+		want    Channel
+	}{
+		{
+			"name only",
+			"goldenvcr",
+			"",
+			Channel{Name: "goldenvcr", Commands: []string{}},
+		},
+		{
+			"name is normalized",
+			" #GoldenVCR ",
+			"",
+			Channel{Name: "goldenvcr", Commands: []string{}},
+		},
+		{
+			"all commands",
+			"goldenvcr:*",
+			"",
+			Channel{Name: "goldenvcr", Commands: []string{AllCommands}},
+		},
+		{
+			"specific commands",
+			"wasabimilkshake:camera+!YouTube",
+			"",
+			Channel{Name: "wasabimilkshake", Commands: []string{"camera", "youtube"}},
+		},
+		{
+			"empty name",
+			":camera",
+			"invalid channel name in spec ':camera'",
+			Channel{},
+		},
+		{
+			"invalid name",
+			"golden vcr",
+			"invalid channel name in spec 'golden vcr'",
+			Channel{},
+		},
+		{
+			"empty command",
+			"goldenvcr:camera++youtube",
+			"empty command name in spec 'goldenvcr:camera++youtube'",
+			Channel{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChannel(tt.spec)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Channel_allowsCommand(t *testing.T) {
+	all := Channel{Name: "goldenvcr", Commands: []string{AllCommands}}
+	assert.True(t, all.allowsCommand("camera"))
+	assert.True(t, all.allowsCommand("200"))
+
+	some := Channel{Name: "wasabimilkshake", Commands: []string{"camera"}}
+	assert.True(t, some.allowsCommand("camera"))
+	assert.True(t, some.allowsCommand("Camera"))
+	assert.False(t, some.allowsCommand("balance"))
+
+	none := Channel{Name: "wasabimilkshake", Commands: []string{}}
+	assert.False(t, none.allowsCommand("camera"))
+}
@@ -10,6 +10,9 @@ import (
 	"os"
 	"strings"
 	"sync"
+
+	"github.com/golden-vcr/chatbot/internal/irc/wsline"
+	"github.com/gorilla/websocket"
 )
 
 // Conn is a low-level interface representing a connection to an IRC server. It simply
@@ -25,12 +28,38 @@ type Conn interface {
 
 // ConnOpts is the set of options used to configure a connection to an IRC server
 type ConnOpts struct {
-	Server string
-	Dial   DialFunc
-	Logger Logger
+	// Transport determines how IRC messages are carried to and from the server, which
+	// also determines the default values of Server and Dial
+	Transport Transport
+	Server    string
+	Dial      DialFunc
+	Logger    Logger
 }
 
-// DialFunc is a function that establishes a TCP connection to the given server. If the
+// Transport identifies a protocol used to carry IRC messages
+type Transport string
+
+const (
+	// TransportTCP sends and receives '\n'-delimited IRC messages over a TLS connection,
+	// by default to irc.chat.twitch.tv:6697
+	TransportTCP Transport = "tcp"
+	// TransportWebSocket sends and receives IRC messages as WebSocket text frames, by
+	// default via wss://irc-ws.chat.twitch.tv:443, for use in environments where only
+	// HTTPS traffic is permitted
+	TransportWebSocket Transport = "websocket"
+)
+
+// ParseTransport converts a string to a Transport, or returns an error if the string
+// does not name a supported transport
+func ParseTransport(s string) (Transport, error) {
+	switch t := Transport(strings.ToLower(s)); t {
+	case TransportTCP, TransportWebSocket:
+		return t, nil
+	}
+	return "", fmt.Errorf("unsupported IRC transport '%s'", s)
+}
+
+// DialFunc is a function that establishes a connection to the given server. If the
 // provided context is canceled during the connection attempt, the connection attempt
 // should be aborted. Once the connection is established, ctx is no longer relevant:
 // canceling it will NOT result in an automatic disconnect.
@@ -38,23 +67,38 @@ type DialFunc func(ctx context.Context, server string) (net.Conn, error)
 
 func NewConn(ctx context.Context, opts ConnOpts) (Conn, error) {
 	// Prepare default options if not explicitly specified
-	if opts.Server == "" {
-		opts.Server = "irc.chat.twitch.tv:6697"
+	if opts.Transport == "" {
+		opts.Transport = TransportTCP
 	}
-	if opts.Dial == nil {
-		opts.Dial = func(ctx context.Context, server string) (net.Conn, error) {
-			d := tls.Dialer{}
-			return d.DialContext(ctx, "tcp", server)
+	switch opts.Transport {
+	case TransportTCP:
+		if opts.Server == "" {
+			opts.Server = "irc.chat.twitch.tv:6697"
+		}
+		if opts.Dial == nil {
+			opts.Dial = func(ctx context.Context, server string) (net.Conn, error) {
+				d := tls.Dialer{}
+				return d.DialContext(ctx, "tcp", server)
+			}
+		}
+	case TransportWebSocket:
+		if opts.Server == "" {
+			opts.Server = "wss://irc-ws.chat.twitch.tv:443"
 		}
+		if opts.Dial == nil {
+			opts.Dial = DialWebSocket
+		}
+	default:
+		return nil, fmt.Errorf("unsupported IRC transport '%s'", opts.Transport)
 	}
 	if opts.Logger == nil {
 		opts.Logger = NewStreamLogger(os.Stdout)
 	}
 
-	// Initiate a TCP connection to the IRC server, giving us a bidirectional stream
-	// which we can write to in order to send '\n'-delimited IRC messages, and which we
-	// can read from in order to receive '\n'-delimited IRC messages
-	tcpConn, err := opts.Dial(ctx, opts.Server)
+	// Initiate a connection to the IRC server, giving us a bidirectional stream which
+	// we can write to in order to send '\n'-delimited IRC messages, and which we can
+	// read from in order to receive '\n'-delimited IRC messages
+	netConn, err := opts.Dial(ctx, opts.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -62,16 +106,20 @@ func NewConn(ctx context.Context, opts ConnOpts) (Conn, error) {
 	// Initialize an irc.Conn that will allow us to read from and write to our
 	// connection in the form of plain-text IRC messages
 	c := &conn{
-		Conn:              tcpConn,
-		reader:            bufio.NewReader(tcpConn),
+		Conn:              netConn,
+		reader:            bufio.NewReader(netConn),
 		logger:            opts.Logger,
 		receivedLinesChan: make(chan string),
+		done:              make(chan struct{}),
 	}
 
 	// Run a goroutine that will await new messages from the server for as long as our
 	// connection is valid, sending them into messagesChan as they're received, and
-	// closing the channel if any error occurs
+	// closing the channel if any error occurs. This goroutine is the only sender, so
+	// it's solely responsible for closing the channel: if the connection is closed
+	// while it's waiting for a line to be received, it gives up on that line.
 	go func() {
+		defer close(c.receivedLinesChan)
 		for {
 			// Block until the next line is available
 			s, err := c.reader.ReadString('\n')
@@ -88,7 +136,11 @@ func NewConn(ctx context.Context, opts ConnOpts) (Conn, error) {
 			// its raw text to our channel
 			line := strings.TrimSuffix(s, "\n")
 			c.logger.LogRecv(line)
-			c.receivedLinesChan <- line
+			select {
+			case c.receivedLinesChan <- line:
+			case <-c.done:
+				return
+			}
 		}
 	}()
 
@@ -107,6 +159,7 @@ type conn struct {
 	reader            *bufio.Reader
 	logger            Logger
 	receivedLinesChan chan string
+	done              chan struct{}
 
 	closed bool
 	mu     sync.RWMutex
@@ -121,7 +174,7 @@ func (c *conn) close() {
 		if err != nil && !errors.Is(err, net.ErrClosed) {
 			c.logger.LogError(fmt.Errorf("error closing connection to IRC server: %w", err))
 		}
-		close(c.receivedLinesChan)
+		close(c.done)
 		c.closed = true
 	}
 }
@@ -153,3 +206,14 @@ func (c *conn) Sendf(format string, a ...any) error {
 	s := fmt.Sprintf(format, a...)
 	return c.Send(s)
 }
+
+// DialWebSocket is a DialFunc that opens a WebSocket connection to the given URL (e.g.
+// 'wss://irc-ws.chat.twitch.tv:443'), returning a net.Conn that maps each WebSocket
+// text frame to one or more lines of text
+func DialWebSocket(ctx context.Context, server string) (net.Conn, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, server, nil)
+	if err != nil {
+		return nil, err
+	}
+	return wsline.NewConn(ws), nil
+}
@@ -1,11 +1,19 @@
 package irc
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/golden-vcr/chatbot"
+	"github.com/golden-vcr/chatbot/internal/irc/irctest"
+	"github.com/golden-vcr/chatbot/internal/outbound"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,6 +55,52 @@ func Test_Connection(t *testing.T) {
 	}, receivedLines)
 }
 
+func Test_NewConn_webSocket(t *testing.T) {
+	// Serve our fake Twitch IRC server over WebSocket
+	srv, err := irctest.NewServer(irctest.ServerOpts{})
+	assert.NoError(t, err)
+	defer srv.Close()
+	httpServer := httptest.NewServer(http.HandlerFunc(srv.HandleWebSocket))
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, err := NewConn(ctx, ConnOpts{
+		Transport: TransportWebSocket,
+		Server:    "ws" + strings.TrimPrefix(httpServer.URL, "http"),
+		Logger:    NewStreamLogger(io.Discard),
+	})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// A bot should be able to complete the Twitch IRC handshake and respond to
+	// commands, with no awareness of the underlying transport
+	messagesChan := make(chan *Message)
+	go func() {
+		for range messagesChan {
+		}
+	}()
+	b, err := NewBot(ctx, conn, BotOpts{}, []Channel{testChannel}, "TapeBoy", "token", messagesChan, func(string, outbound.Message) {}, nil, nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return b.GetStatus() == chatbot.StatusConnected
+	}, time.Second, time.Millisecond)
+	messageId := srv.SendPrivmsg("goldenvcr", irctest.User{Id: "90790024", Login: "wasabimilkshake"}, "!camera")
+	_, err = srv.WaitForSent(time.Second, fmt.Sprintf("@reply-parent-msg-id=%s PRIVMSG #goldenvcr :A camera", messageId))
+	assert.NoError(t, err)
+}
+
+func Test_ParseTransport(t *testing.T) {
+	transport, err := ParseTransport("tcp")
+	assert.NoError(t, err)
+	assert.Equal(t, TransportTCP, transport)
+	transport, err = ParseTransport("WebSocket")
+	assert.NoError(t, err)
+	assert.Equal(t, TransportWebSocket, transport)
+	_, err = ParseTransport("carrier-pigeon")
+	assert.EqualError(t, err, "unsupported IRC transport 'carrier-pigeon'")
+}
+
 type mockConn struct {
 	linesReceived chan string
 	serverReplies chan string
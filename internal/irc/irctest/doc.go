@@ -0,0 +1,16 @@
+// Package irctest provides an in-process fake of the Twitch IRC server, for use in
+// tests that exercise the chat bot end-to-end without any network access.
+//
+// Example usage:
+//
+//	srv, err := irctest.NewServer(irctest.ServerOpts{})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Close()
+//
+//	conn, err := irc.NewConn(ctx, irc.ConnOpts{Dial: srv.Dial})
+//	...
+//	srv.SendPrivmsg("goldenvcr", irctest.User{Id: "90790024", Login: "wasabimilkshake"}, "!camera")
+//	line, err := srv.WaitForSent(time.Second, "PRIVMSG #goldenvcr :")
+package irctest
@@ -0,0 +1,377 @@
+package irctest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/irc/wsline"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// ErrTimedOut is returned when an expected line is not sent by any client in time
+var ErrTimedOut = errors.New("timed out waiting for line")
+
+// ServerOpts is the set of options used to configure a fake Twitch IRC server
+type ServerOpts struct {
+	// AcceptToken reports whether the given OAuth token (sent via 'PASS oauth:...') is
+	// valid: if nil, all tokens are accepted
+	AcceptToken func(token string) bool
+
+	// BotUserId is the Twitch user ID reported to clients in GLOBALUSERSTATE
+	BotUserId string
+
+	// RoomId is the Twitch user ID of the broadcaster, reported in ROOMSTATE
+	RoomId string
+
+	// IsModerator indicates whether clients should be told that they're moderators in
+	// the channels they join, via USERSTATE
+	IsModerator bool
+
+	// SlowModeSeconds is the slow mode interval reported in ROOMSTATE upon join
+	SlowModeSeconds int
+}
+
+// User identifies a chatter on whose behalf the fake server sends messages
+type User struct {
+	Id          string
+	Login       string
+	DisplayName string
+	Color       string
+	Badges      string
+}
+
+// Server is a fake Twitch IRC server that listens on a local TCP port (and that can
+// also accept WebSocket connections via HandleWebSocket). It performs the same login
+// and join handshake that Twitch does, it lets tests inject arbitrary messages, and it
+// records every line that clients send to it.
+type Server struct {
+	// Addr is the host:port on which the server is listening
+	Addr string
+
+	opts     ServerOpts
+	listener net.Listener
+
+	clients  map[*client]struct{}
+	sent     []string
+	matched  map[int]struct{}
+	sentCond *sync.Cond
+	numConns int
+	closed   bool
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// client represents a single connection accepted by the server
+type client struct {
+	conn     net.Conn
+	nick     string
+	channels map[string]struct{}
+	writeMu  sync.Mutex
+}
+
+// NewServer starts a fake Twitch IRC server listening on a random local port
+func NewServer(opts ServerOpts) (*Server, error) {
+	if opts.BotUserId == "" {
+		opts.BotUserId = "1001686376"
+	}
+	if opts.RoomId == "" {
+		opts.RoomId = "953753877"
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		opts:     opts,
+		listener: listener,
+		clients:  make(map[*client]struct{}),
+		matched:  make(map[int]struct{}),
+	}
+	s.sentCond = sync.NewCond(&s.mu)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.accept(conn)
+			}()
+		}
+	}()
+	return s, nil
+}
+
+// accept registers a new client connection and serves it until it's closed
+func (s *Server) accept(conn net.Conn) {
+	c := &client{
+		conn:     conn,
+		channels: make(map[string]struct{}),
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.clients[c] = struct{}{}
+	s.numConns++
+	s.mu.Unlock()
+	s.serve(c)
+}
+
+// HandleWebSocket is an http.HandlerFunc that accepts a WebSocket connection and
+// serves it in the same manner as a TCP connection, with each WebSocket text frame
+// carrying a line of text, as with Twitch's IRC-over-WebSocket endpoint
+func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.wg.Add(1)
+	defer s.wg.Done()
+	s.accept(wsline.NewConn(ws))
+}
+
+// Dial connects to the fake server, ignoring the requested server address: it can be
+// used as an irc.DialFunc
+func (s *Server) Dial(ctx context.Context, server string) (net.Conn, error) {
+	d := net.Dialer{}
+	return d.DialContext(ctx, "tcp", s.Addr)
+}
+
+// Close disconnects all clients and stops the server
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.listener.Close()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.sentCond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// DropConnections abruptly closes all client connections, without sending anything
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+// NumConnections returns the total number of connections the server has accepted
+func (s *Server) NumConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.numConns
+}
+
+// Sent returns every line that's been sent to the server by any client, in order
+func (s *Server) Sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.sent...)
+}
+
+// WaitForSent blocks until a client has sent a line that begins with the given prefix,
+// returning the first such line. Lines are only matched once: once WaitForSent has
+// returned a line, subsequent calls will only consider lines sent after it.
+func (s *Server) WaitForSent(timeout time.Duration, prefix string) (string, error) {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		s.sentCond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for i, line := range s.sent {
+			if _, ok := s.matched[i]; ok {
+				continue
+			}
+			if strings.HasPrefix(line, prefix) {
+				s.matched[i] = struct{}{}
+				return line, nil
+			}
+		}
+		if s.closed || !time.Now().Before(deadline) {
+			return "", fmt.Errorf("%w: no line with prefix '%s'", ErrTimedOut, prefix)
+		}
+		s.sentCond.Wait()
+	}
+}
+
+// Send writes a raw line to every connected client
+func (s *Server) Send(line string) {
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range clients {
+		c.send(line)
+	}
+}
+
+// SendPrivmsg sends a chat message from the given user to the given channel, returning
+// the message ID
+func (s *Server) SendPrivmsg(channel string, user User, text string) string {
+	messageId := uuid.NewString()
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Login
+	}
+	s.Send(fmt.Sprintf("@badge-info=;badges=%s;color=%s;display-name=%s;emotes=;first-msg=0;flags=;id=%s;mod=0;returning-chatter=0;room-id=%s;subscriber=0;tmi-sent-ts=%d;turbo=0;user-id=%s;user-type= :%s!%s@%s.tmi.twitch.tv PRIVMSG #%s :%s",
+		user.Badges, user.Color, displayName, messageId, s.opts.RoomId, time.Now().UnixMilli(), user.Id, user.Login, user.Login, user.Login, channel, text))
+	return messageId
+}
+
+// SendClearmsg tells clients that a moderator has deleted a single message
+func (s *Server) SendClearmsg(channel, login, targetMessageId, text string) {
+	s.Send(fmt.Sprintf("@login=%s;room-id=%s;target-msg-id=%s;tmi-sent-ts=%d :tmi.twitch.tv CLEARMSG #%s :%s",
+		login, s.opts.RoomId, targetMessageId, time.Now().UnixMilli(), channel, text))
+}
+
+// SendClearchat tells clients that a user's messages have been purged (if
+// targetUserId and targetLogin are set) or that the entire chat has been cleared
+func (s *Server) SendClearchat(channel, targetUserId, targetLogin string) {
+	if targetUserId == "" {
+		s.Send(fmt.Sprintf("@room-id=%s;tmi-sent-ts=%d :tmi.twitch.tv CLEARCHAT #%s", s.opts.RoomId, time.Now().UnixMilli(), channel))
+		return
+	}
+	s.Send(fmt.Sprintf("@room-id=%s;target-user-id=%s;tmi-sent-ts=%d :tmi.twitch.tv CLEARCHAT #%s :%s",
+		s.opts.RoomId, targetUserId, time.Now().UnixMilli(), channel, targetLogin))
+}
+
+// SendNotice sends a NOTICE with the given msg-id to the given channel
+func (s *Server) SendNotice(channel, msgId, text string) {
+	s.Send(fmt.Sprintf("@msg-id=%s :tmi.twitch.tv NOTICE #%s :%s", msgId, channel, text))
+}
+
+// SendReconnect tells all clients that the server is about to go down, then closes
+// their connections, as Twitch does during maintenance
+func (s *Server) SendReconnect() {
+	s.Send(":tmi.twitch.tv RECONNECT")
+	s.DropConnections()
+}
+
+// serve handles all lines sent by a single client until the connection is closed
+func (s *Server) serve(c *client) {
+	defer func() {
+		c.conn.Close()
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	token := ""
+	reader := bufio.NewReader(c.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		s.mu.Lock()
+		s.sent = append(s.sent, line)
+		s.sentCond.Broadcast()
+		s.mu.Unlock()
+
+		// Ignore any client tags that precede the command
+		untagged := line
+		if strings.HasPrefix(untagged, "@") {
+			_, untagged, _ = strings.Cut(untagged, " ")
+		}
+		command, args, _ := strings.Cut(untagged, " ")
+		switch command {
+		case "CAP":
+			if caps, ok := strings.CutPrefix(args, "REQ :"); ok {
+				c.send(fmt.Sprintf(":tmi.twitch.tv CAP * ACK :%s", caps))
+			}
+		case "PASS":
+			token = strings.TrimPrefix(args, "oauth:")
+		case "NICK":
+			if s.opts.AcceptToken != nil && !s.opts.AcceptToken(token) {
+				c.send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+				return
+			}
+			c.nick = args
+			for _, welcome := range []string{
+				"001 %s :Welcome, GLHF!",
+				"002 %s :Your host is tmi.twitch.tv",
+				"003 %s :This server is rather new",
+				"004 %s :-",
+				"375 %s :-",
+				"372 %s :You are in a maze of twisty passages, all alike.",
+				"376 %s :>",
+			} {
+				c.send(":tmi.twitch.tv " + fmt.Sprintf(welcome, c.nick))
+			}
+			c.send(fmt.Sprintf("@badge-info=;badges=;color=;display-name=%s;emote-sets=0;user-id=%s;user-type= :tmi.twitch.tv GLOBALUSERSTATE", c.nick, s.opts.BotUserId))
+		case "JOIN":
+			channel := args
+			c.channels[channel] = struct{}{}
+			c.send(fmt.Sprintf(":%s!%s@%s.tmi.twitch.tv JOIN %s", c.nick, c.nick, c.nick, channel))
+			c.send(s.userstate(c.nick, channel))
+			c.send(fmt.Sprintf("@emote-only=0;followers-only=-1;r9k=0;room-id=%s;slow=%d;subs-only=0 :tmi.twitch.tv ROOMSTATE %s", s.opts.RoomId, s.opts.SlowModeSeconds, channel))
+			c.send(fmt.Sprintf(":%s.tmi.twitch.tv 353 %s = %s :%s", c.nick, c.nick, channel, c.nick))
+			c.send(fmt.Sprintf(":%s.tmi.twitch.tv 366 %s %s :End of /NAMES list", c.nick, c.nick, channel))
+		case "PRIVMSG":
+			// Twitch confirms each message sent by a client with a USERSTATE
+			channel, _, _ := strings.Cut(args, " ")
+			c.send(s.userstate(c.nick, channel))
+		case "PART":
+			channel := args
+			delete(c.channels, channel)
+			c.send(fmt.Sprintf(":%s!%s@%s.tmi.twitch.tv PART %s", c.nick, c.nick, c.nick, channel))
+		case "PING":
+			c.send(fmt.Sprintf(":tmi.twitch.tv PONG tmi.twitch.tv %s", args))
+		case "QUIT":
+			return
+		}
+	}
+}
+
+// userstate returns the USERSTATE message that describes the given client's state in
+// the given channel
+func (s *Server) userstate(nick, channel string) string {
+	mod := 0
+	badges := ""
+	if s.opts.IsModerator {
+		mod = 1
+		badges = "moderator/1"
+	}
+	return fmt.Sprintf("@badge-info=;badges=%s;color=;display-name=%s;emote-sets=0;mod=%d;subscriber=0;user-type= :tmi.twitch.tv USERSTATE %s", badges, nick, mod, channel)
+}
+
+// send writes a single line to the client, ignoring errors
+func (c *client) send(line string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write([]byte(line + "\r\n"))
+}
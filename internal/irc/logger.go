@@ -1,6 +1,7 @@
 package irc
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -24,12 +25,15 @@ func NewStreamLogger(stream io.Writer) Logger {
 	}
 }
 
-func NewStructuredLogger(logger *slog.Logger) Logger {
+// NewStructuredLogger returns a Logger that logs IRC traffic via the given slog
+// Logger, subject to the given LogPolicy
+func NewStructuredLogger(logger *slog.Logger, policy LogPolicy) Logger {
 	if logger == nil {
 		logger = slog.Default()
 	}
 	return &structuredLogger{
 		logger: logger,
+		filter: newLogFilter(policy),
 	}
 }
 
@@ -53,14 +57,19 @@ func (l *streamLogger) LogError(err error) {
 
 type structuredLogger struct {
 	logger *slog.Logger
+	filter *logFilter
 }
 
 func (l *structuredLogger) LogSend(s string) {
-	l.logger.Info("Sending IRC message", "message", redactSend(s))
+	if level, message, ok := l.filter.apply(redactSend(s)); ok {
+		l.logger.Log(context.Background(), level, "Sending IRC message", "message", message)
+	}
 }
 
 func (l *structuredLogger) LogRecv(s string) {
-	l.logger.Info("Received IRC message", "message", s)
+	if level, message, ok := l.filter.apply(s); ok {
+		l.logger.Log(context.Background(), level, "Received IRC message", "message", message)
+	}
 }
 
 func (l *structuredLogger) LogError(err error) {
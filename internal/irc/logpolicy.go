@@ -0,0 +1,280 @@
+package irc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slog"
+)
+
+// LevelOff may be used in a LogPolicy to disable logging for a message type entirely
+const LevelOff = slog.Level(1 << 10)
+
+// redactedValue replaces any value that's been redacted from a logged message
+const redactedValue = "<REDACTED>"
+
+// userTags lists the tags whose values identify a Twitch user, which are hashed if a
+// LogPolicy has HashUsers enabled
+var userTags = []string{
+	"user-id",
+	"login",
+	"display-name",
+	"target-user-id",
+	"reply-parent-user-id",
+	"reply-parent-user-login",
+	"reply-parent-display-name",
+	"reply-thread-parent-user-id",
+	"reply-thread-parent-user-login",
+	"reply-thread-parent-display-name",
+	"msg-param-login",
+	"msg-param-displayName",
+	"msg-param-recipient-id",
+	"msg-param-recipient-user-name",
+	"msg-param-recipient-display-name",
+	"msg-param-sender-login",
+	"msg-param-sender-name",
+	"msg-param-gifter-id",
+	"msg-param-gifter-login",
+	"msg-param-gifter-name",
+	"msg-param-prior-gifter-id",
+	"msg-param-prior-gifter-user-name",
+	"msg-param-prior-gifter-display-name",
+}
+
+// userTextTags lists the tags whose values are human-readable text that may mention
+// users by name (e.g. 'Alice gifted a Tier 1 sub to Bob!'), which can't be hashed
+// piecemeal and are therefore redacted if a LogPolicy has HashUsers enabled
+var userTextTags = []string{
+	"system-msg",
+}
+
+// bodyTags lists the tags that carry the text of another message, which are redacted
+// along with the bodies of messages whose type is listed in RedactBodies
+var bodyTags = []string{
+	"reply-parent-msg-body",
+	"reply-thread-parent-msg-body",
+}
+
+// LogPolicy determines which IRC messages are logged by a structured logger, at what
+// level, and with which details removed. The zero value logs every message at Info
+// level, unmodified (except for passwords, which are always redacted).
+type LogPolicy struct {
+	// Levels maps message types (e.g. 'PRIVMSG', 'PING') to the level at which
+	// messages of that type are logged, where the key '*' sets the level for all other
+	// types (Info by default), and LevelOff disables logging
+	Levels map[string]slog.Level
+	// SampleEvery maps message types to a number N such that only one in every N
+	// messages of that type is logged, in order to reduce the volume of logs
+	SampleEvery map[string]int
+	// RedactTags lists tags whose values should be replaced with '<REDACTED>'
+	RedactTags []string
+	// RedactBodies lists message types (e.g. 'PRIVMSG', 'WHISPER') whose bodies should
+	// be replaced with '<REDACTED>', along with any tags that quote other messages
+	RedactBodies []string
+	// HashUsers, if true, replaces the values of tags that identify users, as well as
+	// the nicknames of senders, with a hash of that value: the same user always has
+	// the same hash, so their messages can be correlated without identifying them.
+	// Tags with system-generated text that names users (e.g. 'system-msg') are
+	// redacted.
+	HashUsers bool
+	// HashSalt is combined with each value before hashing it, so that hashes can't be
+	// reversed by hashing known user IDs
+	HashSalt string
+}
+
+// ParseLogLevels parses a list of 'TYPE=level' specs (e.g. 'PRIVMSG=debug',
+// 'PING=off', '*=warn') into a map suitable for LogPolicy.Levels
+func ParseLogLevels(specs []string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, spec := range specs {
+		messageType, value, ok := cutSpec(spec)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(value, "off") {
+			levels[messageType] = LevelOff
+			continue
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid log level in spec '%s'", spec)
+		}
+		levels[messageType] = level
+	}
+	return levels, nil
+}
+
+// ParseLogSampling parses a list of 'TYPE=N' specs (e.g. 'PRIVMSG=10' to log one in
+// every 10 PRIVMSG messages) into a map suitable for LogPolicy.SampleEvery
+func ParseLogSampling(specs []string) (map[string]int, error) {
+	sampleEvery := make(map[string]int)
+	for _, spec := range specs {
+		messageType, value, ok := cutSpec(spec)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid sample rate in spec '%s'", spec)
+		}
+		sampleEvery[messageType] = n
+	}
+	return sampleEvery, nil
+}
+
+// cutSpec splits a 'TYPE=value' spec, normalizing the message type to uppercase; it
+// returns false for empty specs
+func cutSpec(spec string) (string, string, bool) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return "", "", false
+	}
+	messageType, value, _ := strings.Cut(spec, "=")
+	return strings.ToUpper(strings.TrimSpace(messageType)), strings.TrimSpace(value), true
+}
+
+// logFilter applies a LogPolicy to individual lines of IRC traffic
+type logFilter struct {
+	policy LogPolicy
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+func newLogFilter(policy LogPolicy) *logFilter {
+	return &logFilter{
+		policy: policy,
+		counts: make(map[string]int),
+	}
+}
+
+// apply returns the level at which the given line should be logged and the text that
+// should be logged in its place, or false if the line should not be logged at all.
+// Redactions apply to lines sent by the bot as well as lines received, since the bot's
+// replies may quote what users said.
+func (f *logFilter) apply(line string) (slog.Level, string, bool) {
+	// Lines that can't be parsed are logged at the default level: since we can't tell
+	// which parts of them to redact, they're logged as-is only if no redactions are
+	// configured
+	m, err := parseMessage(line)
+	if err != nil {
+		level := f.level("*")
+		if f.redacts() {
+			line = redactedValue
+		}
+		return level, line, level != LevelOff
+	}
+
+	level := f.level(m.Type)
+	if level == LevelOff || !f.sample(m.Type) {
+		return level, "", false
+	}
+	return level, f.redact(m), true
+}
+
+// redacts returns true if the policy removes any details from logged messages
+func (f *logFilter) redacts() bool {
+	return len(f.policy.RedactTags) > 0 || len(f.policy.RedactBodies) > 0 || f.policy.HashUsers
+}
+
+// level returns the level at which messages of the given type should be logged
+func (f *logFilter) level(messageType string) slog.Level {
+	if level, ok := f.policy.Levels[messageType]; ok {
+		return level
+	}
+	if level, ok := f.policy.Levels["*"]; ok {
+		return level
+	}
+	return slog.LevelInfo
+}
+
+// sample returns true if the current message of the given type should be logged,
+// counting it toward that type's sample rate
+func (f *logFilter) sample(messageType string) bool {
+	n := f.policy.SampleEvery[messageType]
+	if n <= 1 {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := f.counts[messageType]
+	f.counts[messageType] = count + 1
+	return count%n == 0
+}
+
+// redact returns the text of the given message with all redactions and hashing
+// applied; if the policy requires no changes, the original line is returned
+func (f *logFilter) redact(m *Message) string {
+	redactBody := includes(f.policy.RedactBodies, m.Type)
+	if !f.redacts() {
+		return m.Raw
+	}
+
+	tags := make(map[string]string, len(m.Extra))
+	for key, value := range m.Extra {
+		tags[key] = value
+	}
+	prefix := m.Prefix
+	body := m.Body
+
+	if f.policy.HashUsers {
+		for _, key := range userTags {
+			if value := tags[key]; value != "" {
+				tags[key] = f.hash(value)
+			}
+		}
+		for _, key := range userTextTags {
+			if _, ok := tags[key]; ok {
+				tags[key] = redactedValue
+			}
+		}
+		if nick, _, ok := strings.Cut(prefix, "!"); ok && nick != "" {
+			prefix = strings.ReplaceAll(prefix, nick, f.hash(nick))
+		}
+		if m.Type == "CLEARCHAT" && body != "" {
+			body = f.hash(body)
+		}
+	}
+	if redactBody {
+		for _, key := range bodyTags {
+			if _, ok := tags[key]; ok {
+				tags[key] = redactedValue
+			}
+		}
+		if body != "" {
+			body = redactedValue
+		}
+	}
+	for _, key := range f.policy.RedactTags {
+		if _, ok := tags[key]; ok {
+			tags[key] = redactedValue
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(formatTags(tags))
+	if prefix != "" {
+		b.WriteByte(':')
+		b.WriteString(prefix)
+		b.WriteByte(' ')
+	}
+	b.WriteString(m.Type)
+	if len(m.Params) > 0 {
+		b.WriteByte(' ')
+		b.WriteString(strings.Join(m.Params, " "))
+	}
+	if body != "" {
+		b.WriteString(" :")
+		b.WriteString(body)
+	}
+	return b.String()
+}
+
+// hash returns a short, stable, salted hash of the given value
+func (f *logFilter) hash(value string) string {
+	sum := sha256.Sum256([]byte(f.policy.HashSalt + strings.ToLower(value)))
+	return "h_" + hex.EncodeToString(sum[:6])
+}
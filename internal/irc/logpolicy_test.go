@@ -0,0 +1,210 @@
+package irc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+)
+
+func Test_ParseLogLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    map[string]slog.Level
+		wantErr string
+	}{
+		{
+			"empty specs yield an empty map",
+			[]string{"", " "},
+			map[string]slog.Level{},
+			"",
+		},
+		{
+			"levels and 'off' are parsed, with types normalized to uppercase",
+			[]string{"privmsg=debug", "PING=off", "*=WARN"},
+			map[string]slog.Level{
+				"PRIVMSG": slog.LevelDebug,
+				"PING":    LevelOff,
+				"*":       slog.LevelWarn,
+			},
+			"",
+		},
+		{
+			"invalid levels are rejected",
+			[]string{"PRIVMSG=loud"},
+			nil,
+			"invalid log level in spec 'PRIVMSG=loud'",
+		},
+		{
+			"specs without a level are rejected",
+			[]string{"PRIVMSG"},
+			nil,
+			"invalid log level in spec 'PRIVMSG'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLogLevels(tt.specs)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParseLogSampling(t *testing.T) {
+	got, err := ParseLogSampling([]string{"privmsg=10", "USERNOTICE=1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"PRIVMSG": 10, "USERNOTICE": 1}, got)
+
+	_, err = ParseLogSampling([]string{"PRIVMSG=0"})
+	assert.EqualError(t, err, "invalid sample rate in spec 'PRIVMSG=0'")
+
+	_, err = ParseLogSampling([]string{"PRIVMSG=often"})
+	assert.EqualError(t, err, "invalid sample rate in spec 'PRIVMSG=often'")
+}
+
+func Test_logFilter_apply(t *testing.T) {
+	privmsg := "@badges=moderator/1;display-name=Wasabimilkshake;user-id=90790024 :wasabimilkshake!wasabimilkshake@wasabimilkshake.tmi.twitch.tv PRIVMSG #goldenvcr :hello world"
+	reply := "@display-name=Bob;reply-parent-display-name=Alice;reply-parent-msg-body=secret\\sstuff;reply-parent-user-id=123 :bob!bob@bob.tmi.twitch.tv PRIVMSG #goldenvcr :@Alice agreed"
+	subgift := "@display-name=Alice;login=alice;msg-id=subgift;msg-param-gifter-id=111;msg-param-gifter-login=alice;msg-param-gifter-name=Alice;msg-param-prior-gifter-display-name=Carol;msg-param-prior-gifter-id=333;msg-param-prior-gifter-user-name=carol;msg-param-recipient-display-name=Bob;msg-param-recipient-id=222;msg-param-recipient-user-name=bob;system-msg=Alice\\sgifted\\sa\\sTier\\s1\\ssub\\sto\\sBob!;user-id=111 :tmi.twitch.tv USERNOTICE #goldenvcr"
+	tests := []struct {
+		name      string
+		policy    LogPolicy
+		line      string
+		wantLevel slog.Level
+		wantText  string
+		wantOk    bool
+	}{
+		{
+			"zero policy logs lines unmodified at info level",
+			LogPolicy{},
+			privmsg,
+			slog.LevelInfo,
+			privmsg,
+			true,
+		},
+		{
+			"level is set per message type",
+			LogPolicy{Levels: map[string]slog.Level{"PRIVMSG": slog.LevelDebug, "*": slog.LevelWarn}},
+			privmsg,
+			slog.LevelDebug,
+			privmsg,
+			true,
+		},
+		{
+			"default level applies to other types",
+			LogPolicy{Levels: map[string]slog.Level{"PRIVMSG": slog.LevelDebug, "*": slog.LevelWarn}},
+			"PING :tmi.twitch.tv",
+			slog.LevelWarn,
+			"PING :tmi.twitch.tv",
+			true,
+		},
+		{
+			"off disables logging",
+			LogPolicy{Levels: map[string]slog.Level{"PING": LevelOff}},
+			"PING :tmi.twitch.tv",
+			LevelOff,
+			"",
+			false,
+		},
+		{
+			"tags are redacted",
+			LogPolicy{RedactTags: []string{"display-name", "client-nonce"}},
+			privmsg,
+			slog.LevelInfo,
+			"@badges=moderator/1;display-name=<REDACTED>;user-id=90790024 :wasabimilkshake!wasabimilkshake@wasabimilkshake.tmi.twitch.tv PRIVMSG #goldenvcr :hello world",
+			true,
+		},
+		{
+			"bodies are redacted along with quoted messages",
+			LogPolicy{RedactBodies: []string{"PRIVMSG"}},
+			reply,
+			slog.LevelInfo,
+			"@display-name=Bob;reply-parent-display-name=Alice;reply-parent-msg-body=<REDACTED>;reply-parent-user-id=123 :bob!bob@bob.tmi.twitch.tv PRIVMSG #goldenvcr :<REDACTED>",
+			true,
+		},
+		{
+			"bodies of other types are not redacted",
+			LogPolicy{RedactBodies: []string{"WHISPER"}},
+			privmsg,
+			slog.LevelInfo,
+			privmsg,
+			true,
+		},
+		{
+			"users are hashed",
+			LogPolicy{HashUsers: true, HashSalt: "pepper"},
+			privmsg,
+			slog.LevelInfo,
+			"@badges=moderator/1;display-name=h_ea6d87739bcd;user-id=h_5ff03c0f1661 :h_ea6d87739bcd!h_ea6d87739bcd@h_ea6d87739bcd.tmi.twitch.tv PRIVMSG #goldenvcr :hello world",
+			true,
+		},
+		{
+			"gifters are hashed and system messages are redacted",
+			LogPolicy{HashUsers: true, HashSalt: "pepper"},
+			subgift,
+			slog.LevelInfo,
+			"@display-name=h_b1b68da44784;login=h_b1b68da44784;msg-id=subgift;msg-param-gifter-id=h_3ae687387eea;msg-param-gifter-login=h_b1b68da44784;msg-param-gifter-name=h_b1b68da44784;msg-param-prior-gifter-display-name=h_616feffb0755;msg-param-prior-gifter-id=h_4cf2afb0c2a7;msg-param-prior-gifter-user-name=h_616feffb0755;msg-param-recipient-display-name=h_c774cc418908;msg-param-recipient-id=h_2f3972dd9359;msg-param-recipient-user-name=h_c774cc418908;system-msg=<REDACTED>;user-id=h_3ae687387eea :tmi.twitch.tv USERNOTICE #goldenvcr",
+			true,
+		},
+		{
+			"bodies of messages sent by the bot are redacted",
+			LogPolicy{RedactBodies: []string{"PRIVMSG"}},
+			"@reply-parent-msg-id=a5f2c3 PRIVMSG #goldenvcr :unrecognized command: my-secret",
+			slog.LevelInfo,
+			"@reply-parent-msg-id=a5f2c3 PRIVMSG #goldenvcr :<REDACTED>",
+			true,
+		},
+		{
+			"unparseable lines are logged as-is",
+			LogPolicy{},
+			"",
+			slog.LevelInfo,
+			"",
+			true,
+		},
+		{
+			"unparseable lines are redacted if any redaction is configured",
+			LogPolicy{RedactBodies: []string{"PRIVMSG"}},
+			"@=x :someone PRIVMSG #goldenvcr :my secret",
+			slog.LevelInfo,
+			"<REDACTED>",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newLogFilter(tt.policy)
+			level, text, ok := f.apply(tt.line)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantLevel, level)
+			assert.Equal(t, tt.wantText, text)
+		})
+	}
+}
+
+func Test_logFilter_sample(t *testing.T) {
+	f := newLogFilter(LogPolicy{SampleEvery: map[string]int{"PRIVMSG": 3}})
+	logged := 0
+	for i := 0; i < 9; i++ {
+		if _, _, ok := f.apply(":a!a@a.tmi.twitch.tv PRIVMSG #goldenvcr :hi"); ok {
+			logged++
+		}
+	}
+	assert.Equal(t, 3, logged)
+
+	// Other types are unaffected
+	_, _, ok := f.apply("PING :tmi.twitch.tv")
+	assert.True(t, ok)
+}
+
+func Test_logFilter_hash(t *testing.T) {
+	f := newLogFilter(LogPolicy{HashSalt: "pepper"})
+	assert.Equal(t, f.hash("Wasabimilkshake"), f.hash("wasabimilkshake"))
+	assert.NotEqual(t, f.hash("wasabimilkshake"), newLogFilter(LogPolicy{}).hash("wasabimilkshake"))
+}
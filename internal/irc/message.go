@@ -2,6 +2,7 @@ package irc
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -15,7 +16,9 @@ type Message struct {
 	// Extra is a parsed representation of the '@'-prefixed, ';'-delimited string of
 	// 'key=value' pairs that may appear before the message, separated from it by a
 	// space: e.g. '@foo=bar;x=42;type= :tmi.twitch.tv CLEARCHAT #somechannel' will have
-	// an Extra map of {"foo": "bar", "x": "42", "type": ""}
+	// an Extra map of {"foo": "bar", "x": "42", "type": ""}. Values are unescaped per
+	// the IRCv3 message-tags spec (e.g. '\s' becomes ' '), and tags that have no value
+	// at all (e.g. '@foo;x=42') are stored with an empty value.
 	Extra map[string]string
 
 	// Prefix is the user and/or host information that precedes the data of the message,
@@ -88,17 +91,107 @@ func parseExtra(s string) (map[string]string, string, error) {
 	// Parse the extra parameters to a map (e.g. 'foo=bar;baz=42' =>
 	// []string{'foo=bar', 'baz=42'})
 	for _, keyValuePair := range strings.Split(semicolonDelimitedKeyValuePairs, ";") {
+		// Tolerate empty tags, e.g. from a trailing semicolon
+		if keyValuePair == "" {
+			continue
+		}
+
+		// A tag with no equals sign is a key with no value
 		equalsPos := strings.IndexRune(keyValuePair, '=')
-		if equalsPos <= 0 {
-			return nil, "", fmt.Errorf("found no equals sign in extra key-value pair '%s'", keyValuePair)
+		if equalsPos < 0 {
+			extra[keyValuePair] = ""
+			continue
+		}
+		if equalsPos == 0 {
+			return nil, "", fmt.Errorf("found no key in extra key-value pair '%s'", keyValuePair)
 		}
 		key := keyValuePair[:equalsPos]
-		value := keyValuePair[equalsPos+1:]
+		value := unescapeTagValue(keyValuePair[equalsPos+1:])
 		extra[key] = value
 	}
 	return extra, remainder, nil
 }
 
+// unescapeTagValue decodes a tag value that was escaped according to the IRCv3
+// message-tags spec, i.e. where ';' is encoded as '\:', ' ' as '\s', '\' as '\\',
+// CR as '\r', and LF as '\n'. Any other escaped character is taken literally, and a
+// trailing lone backslash is dropped.
+func unescapeTagValue(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			break
+		}
+		switch s[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// escapeTagValue encodes a tag value so that it can be sent to an IRC server, per the
+// IRCv3 message-tags spec: it's the inverse of unescapeTagValue
+func escapeTagValue(s string) string {
+	return tagValueEscaper.Replace(s)
+}
+
+var tagValueEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
+// formatTags renders a set of tags as the '@'-prefixed string that should precede an
+// outbound IRC message, including the trailing space: e.g. {"foo": "a b", "x": ""}
+// renders as '@foo=a\sb;x '. Keys are sorted for deterministic output. If there are no
+// tags, formatTags returns an empty string.
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('@')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(key)
+		if value := tags[key]; value != "" {
+			b.WriteByte('=')
+			b.WriteString(escapeTagValue(value))
+		}
+	}
+	b.WriteByte(' ')
+	return b.String()
+}
+
 func parsePrefix(s string) (string, string) {
 	// If the message doesn't begin with ':', it has no prefix
 	if s == "" || s[0] != ':' {
@@ -1,6 +1,7 @@
 package irc
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -278,6 +279,60 @@ func Test_parseMessage(t *testing.T) {
 				},
 			},
 		},
+		{
+			"USERNOTICE with escaped tag values",
+			`@badge-info=;badges=;display-name=Some\sUser;emotes=;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;login=someuser;msg-id=raid;msg-param-displayName=Some\sUser;msg-param-viewerCount=15;room-id=953753877;system-msg=15\sraiders\sfrom\sSome\sUser\shave\sjoined!\:\sa\\b;tmi-sent-ts=1707152232192;user-id=12345 :tmi.twitch.tv USERNOTICE #goldenvcr` + "\r",
+			"",
+			&Message{
+				Raw: `@badge-info=;badges=;display-name=Some\sUser;emotes=;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;login=someuser;msg-id=raid;msg-param-displayName=Some\sUser;msg-param-viewerCount=15;room-id=953753877;system-msg=15\sraiders\sfrom\sSome\sUser\shave\sjoined!\:\sa\\b;tmi-sent-ts=1707152232192;user-id=12345 :tmi.twitch.tv USERNOTICE #goldenvcr`,
+				Extra: map[string]string{
+					"badge-info":            "",
+					"badges":                "",
+					"display-name":          "Some User",
+					"emotes":                "",
+					"id":                    "b34ccfc7-4977-403a-8a94-33c6bac34fb8",
+					"login":                 "someuser",
+					"msg-id":                "raid",
+					"msg-param-displayName": "Some User",
+					"msg-param-viewerCount": "15",
+					"room-id":               "953753877",
+					"system-msg":            `15 raiders from Some User have joined!; a\b`,
+					"tmi-sent-ts":           "1707152232192",
+					"user-id":               "12345",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "USERNOTICE",
+				Params: []string{
+					"#goldenvcr",
+				},
+				Body: "",
+			},
+		},
+		{
+			"valueless tags",
+			"@foo;bar=;baz=42; :tmi.twitch.tv PRIVMSG #goldenvcr :hello\r",
+			"",
+			&Message{
+				Raw: "@foo;bar=;baz=42; :tmi.twitch.tv PRIVMSG #goldenvcr :hello",
+				Extra: map[string]string{
+					"foo": "",
+					"bar": "",
+					"baz": "42",
+				},
+				Prefix: "tmi.twitch.tv",
+				Type:   "PRIVMSG",
+				Params: []string{
+					"#goldenvcr",
+				},
+				Body: "hello",
+			},
+		},
+		{
+			"tag with no key",
+			"@=foo :tmi.twitch.tv PRIVMSG #goldenvcr :hello\r",
+			"found no key in extra key-value pair '=foo'",
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -292,3 +347,60 @@ func Test_parseMessage(t *testing.T) {
 		})
 	}
 }
+
+func Test_unescapeTagValue(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"hello", "hello"},
+		{`hello\sworld`, "hello world"},
+		{`a\:b`, "a;b"},
+		{`a\\b`, `a\b`},
+		{`a\\sb`, `a\sb`},
+		{`line\rbreak\n`, "line\rbreak\n"},
+		{`\b\x`, "bx"},
+		{`trailing\`, "trailing"},
+		{`\\\s\:`, `\ ;`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got := unescapeTagValue(tt.s)
+			assert.Equal(t, tt.want, got)
+			if !strings.HasSuffix(tt.s, `\`) && !strings.Contains(tt.s, `\b`) {
+				assert.Equal(t, tt.s, escapeTagValue(got))
+			}
+		})
+	}
+}
+
+func Test_formatTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want string
+	}{
+		{
+			"no tags",
+			nil,
+			"",
+		},
+		{
+			"single tag",
+			map[string]string{"reply-parent-msg-id": "b34ccfc7-4977-403a-8a94-33c6bac34fb8"},
+			"@reply-parent-msg-id=b34ccfc7-4977-403a-8a94-33c6bac34fb8 ",
+		},
+		{
+			"multiple tags are sorted and escaped",
+			map[string]string{"z": "a b;c", "a": `\`, "m": ""},
+			`@a=\\;m;z=a\sb\:c `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatTags(tt.tags)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Errors indicating that Twitch rejected a message sent by the bot, as reported via a
+// NOTICE with the corresponding msg-id
+var (
+	ErrRateLimited      = errors.New("message was sent too quickly")
+	ErrDuplicateMessage = errors.New("message was identical to the previous message")
+	ErrBanned           = errors.New("bot is banned from the channel")
+	ErrTimedOut         = errors.New("bot is timed out in the channel")
+	ErrChannelSuspended = errors.New("channel is suspended")
+	ErrFollowersOnly    = errors.New("channel is in followers-only mode")
+	ErrSubscribersOnly  = errors.New("channel is in subscribers-only mode")
+	ErrEmoteOnly        = errors.New("channel is in emote-only mode")
+	ErrSlowMode         = errors.New("channel is in slow mode")
+)
+
+// rateLimitRetryDelay is how long the bot waits before resending a message that was
+// rejected because the bot exceeded Twitch's rate limits
+const rateLimitRetryDelay = 5 * time.Second
+
+// noticePolicy describes how the bot should respond to a NOTICE that indicates that a
+// message it sent was rejected
+type noticePolicy struct {
+	err   error
+	retry bool
+}
+
+// noticePolicies maps the msg-id of a NOTICE to the error it represents: if retry is
+// true, the message may be delivered if it's sent again later; otherwise it's dropped
+var noticePolicies = map[string]noticePolicy{
+	"msg_ratelimit":              {ErrRateLimited, true},
+	"msg_slowmode":               {ErrSlowMode, true},
+	"msg_duplicate":              {ErrDuplicateMessage, false},
+	"msg_banned":                 {ErrBanned, false},
+	"msg_timedout":               {ErrTimedOut, false},
+	"msg_channel_suspended":      {ErrChannelSuspended, false},
+	"msg_followersonly":          {ErrFollowersOnly, false},
+	"msg_followersonly_followed": {ErrFollowersOnly, false},
+	"msg_followersonly_zero":     {ErrFollowersOnly, false},
+	"msg_subsonly":               {ErrSubscribersOnly, false},
+	"msg_emoteonly":              {ErrEmoteOnly, false},
+}
+
+// NoticeError is a delivery failure reported by Twitch via NOTICE. It wraps one of the
+// errors above, so it can be identified with errors.Is.
+type NoticeError struct {
+	// Kind is the msg-id of the NOTICE, e.g. 'msg_ratelimit'
+	Kind string
+	// Text is the human-readable text of the NOTICE
+	Text string
+
+	err        error
+	retry      bool
+	retryAfter time.Duration
+}
+
+func (e *NoticeError) Error() string {
+	return fmt.Sprintf("%v (%s: %s)", e.err, e.Kind, e.Text)
+}
+
+func (e *NoticeError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter indicates whether the rejected message should be sent again, and if so,
+// how long to wait before resending it; it satisfies outbound.Retryable
+func (e *NoticeError) RetryAfter() (time.Duration, bool) {
+	return e.retryAfter, e.retry
+}
+
+// slowModeDelayRegex matches the number of seconds Twitch tells us to wait in a
+// msg_slowmode NOTICE, e.g. 'You will be able to talk again in 3 seconds.'
+var slowModeDelayRegex = regexp.MustCompile(`(\d+) seconds?`)
+
+// noticeErrorFromNotice returns a NoticeError if the given NOTICE indicates that a
+// message sent by the bot was rejected, or nil otherwise
+func noticeErrorFromNotice(n *Notice) *NoticeError {
+	policy, ok := noticePolicies[n.Kind]
+	if !ok {
+		return nil
+	}
+	e := &NoticeError{
+		Kind:  n.Kind,
+		Text:  n.Text,
+		err:   policy.err,
+		retry: policy.retry,
+	}
+	switch n.Kind {
+	case "msg_ratelimit":
+		e.retryAfter = rateLimitRetryDelay
+	case "msg_slowmode":
+		e.retryAfter = time.Second
+		if match := slowModeDelayRegex.FindStringSubmatch(n.Text); match != nil {
+			if seconds, err := strconv.Atoi(match[1]); err == nil && seconds > 0 {
+				e.retryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,77 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_noticeErrorFromNotice(t *testing.T) {
+	tests := []struct {
+		name           string
+		notice         Notice
+		wantErr        error
+		wantRetry      bool
+		wantRetryAfter time.Duration
+	}{
+		{
+			"rate limit is retried",
+			Notice{Channel: "goldenvcr", Kind: "msg_ratelimit", Text: "Your message was not sent because you are sending messages too quickly."},
+			ErrRateLimited,
+			true,
+			rateLimitRetryDelay,
+		},
+		{
+			"slow mode is retried after the delay given by Twitch",
+			Notice{Channel: "goldenvcr", Kind: "msg_slowmode", Text: "This room is in slow mode and you are sending messages too quickly. You will be able to talk again in 3 seconds."},
+			ErrSlowMode,
+			true,
+			3 * time.Second,
+		},
+		{
+			"slow mode without a delay is retried after a second",
+			Notice{Channel: "goldenvcr", Kind: "msg_slowmode", Text: "This room is in slow mode."},
+			ErrSlowMode,
+			true,
+			time.Second,
+		},
+		{
+			"duplicate is dropped",
+			Notice{Channel: "goldenvcr", Kind: "msg_duplicate", Text: "Your message was not sent because it is identical to the previous one you sent, less than 30 seconds ago."},
+			ErrDuplicateMessage,
+			false,
+			0,
+		},
+		{
+			"ban is dropped",
+			Notice{Channel: "goldenvcr", Kind: "msg_banned", Text: "You are permanently banned from talking in goldenvcr."},
+			ErrBanned,
+			false,
+			0,
+		},
+		{
+			"followers-only variants are dropped",
+			Notice{Channel: "goldenvcr", Kind: "msg_followersonly_zero", Text: "This room is in followers-only mode."},
+			ErrFollowersOnly,
+			false,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := noticeErrorFromNotice(&tt.notice)
+			if assert.NotNil(t, got) {
+				assert.ErrorIs(t, got, tt.wantErr)
+				assert.Equal(t, tt.notice.Kind, got.Kind)
+				retryAfter, retry := got.RetryAfter()
+				assert.Equal(t, tt.wantRetry, retry)
+				assert.Equal(t, tt.wantRetryAfter, retryAfter)
+			}
+		})
+	}
+
+	// Informational notices are not delivery failures
+	assert.Nil(t, noticeErrorFromNotice(&Notice{Channel: "goldenvcr", Kind: "slow_on", Text: "This room is now in slow mode."}))
+	assert.Nil(t, noticeErrorFromNotice(&Notice{Channel: "*", Text: "Login authentication failed"}))
+}
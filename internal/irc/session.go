@@ -0,0 +1,169 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// SessionDirection indicates whether a recorded line was received from the server or
+// sent by the client
+type SessionDirection string
+
+const (
+	SessionDirectionRecv  SessionDirection = "recv"
+	SessionDirectionSend  SessionDirection = "send"
+	SessionDirectionError SessionDirection = "error"
+)
+
+// SessionEntry is a single timestamped line in a recorded IRC session
+type SessionEntry struct {
+	Time      time.Time        `json:"time"`
+	Direction SessionDirection `json:"direction"`
+	Line      string           `json:"line"`
+}
+
+// NewSessionRecorder returns a Logger that writes every line sent and received, as
+// well as any errors, to the given stream as a JSON-serialized SessionEntry per line.
+// Passwords are redacted from sent lines, just as with other Logger implementations.
+func NewSessionRecorder(w io.Writer) Logger {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &sessionRecorder{
+		enc: enc,
+		now: time.Now,
+	}
+}
+
+// NewMultiLogger returns a Logger that forwards each log call to all the given loggers
+func NewMultiLogger(loggers ...Logger) Logger {
+	return multiLogger(loggers)
+}
+
+// LoadSession parses a session previously written by a session recorder
+func LoadSession(r io.Reader) ([]SessionEntry, error) {
+	entries := make([]SessionEntry, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry SessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse session entry on line %d: %w", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReplayOpts is the set of options used to configure replay of a recorded session
+type ReplayOpts struct {
+	// Speed is the playback rate relative to the original recording: 1 replays lines
+	// in real time, 10 replays them ten times as fast, etc. If 0, all lines are
+	// replayed as quickly as possible.
+	Speed float64
+
+	// CloseWhenDone causes the connection to be closed from the server side once all
+	// lines have been replayed; otherwise the connection remains open until the client
+	// closes it
+	CloseWhenDone bool
+}
+
+// NewReplayDialFunc returns a DialFunc that, instead of connecting to a real server,
+// returns a connection that plays back all the lines that were received in a recorded
+// session. Any lines written by the client are discarded. Each call to the DialFunc
+// starts a new replay from the beginning of the session.
+func NewReplayDialFunc(entries []SessionEntry, opts ReplayOpts) DialFunc {
+	return func(ctx context.Context, server string) (net.Conn, error) {
+		clientConn, serverConn := net.Pipe()
+
+		// Discard everything written by the client; net.Pipe is unbuffered, so we need
+		// to keep reading in order for the client's writes to complete
+		go io.Copy(io.Discard, serverConn)
+
+		// Write all received lines to the client, reproducing the original timing
+		go func() {
+			var start time.Time
+			replayStart := time.Now()
+			for _, entry := range entries {
+				if entry.Direction != SessionDirectionRecv {
+					continue
+				}
+				if start.IsZero() {
+					start = entry.Time
+				}
+				if opts.Speed > 0 {
+					offset := time.Duration(float64(entry.Time.Sub(start)) / opts.Speed)
+					time.Sleep(time.Until(replayStart.Add(offset)))
+				}
+				if _, err := serverConn.Write([]byte(entry.Line + "\r\n")); err != nil {
+					return
+				}
+			}
+			if opts.CloseWhenDone {
+				serverConn.Close()
+			}
+		}()
+		return clientConn, nil
+	}
+}
+
+type sessionRecorder struct {
+	enc *json.Encoder
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+func (l *sessionRecorder) LogSend(s string) {
+	l.record(SessionDirectionSend, redactSend(s))
+}
+
+func (l *sessionRecorder) LogRecv(s string) {
+	l.record(SessionDirectionRecv, s)
+}
+
+func (l *sessionRecorder) LogError(err error) {
+	if err != nil {
+		l.record(SessionDirectionError, err.Error())
+	}
+}
+
+func (l *sessionRecorder) record(direction SessionDirection, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(SessionEntry{
+		Time:      l.now(),
+		Direction: direction,
+		Line:      line,
+	})
+}
+
+type multiLogger []Logger
+
+func (l multiLogger) LogSend(s string) {
+	for _, logger := range l {
+		logger.LogSend(s)
+	}
+}
+
+func (l multiLogger) LogRecv(s string) {
+	for _, logger := range l {
+		logger.LogRecv(s)
+	}
+}
+
+func (l multiLogger) LogError(err error) {
+	for _, logger := range l {
+		logger.LogError(err)
+	}
+}
@@ -0,0 +1,97 @@
+package irc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SessionRecorder(t *testing.T) {
+	t0 := time.Date(2024, 2, 6, 4, 20, 0, 0, time.UTC)
+	i := 0
+	now := func() time.Time {
+		i++
+		return t0.Add(time.Duration(i) * time.Second)
+	}
+
+	var buf bytes.Buffer
+	l := NewSessionRecorder(&buf).(*sessionRecorder)
+	l.now = now
+	l.LogSend("PASS oauth:secret")
+	l.LogRecv(":tmi.twitch.tv 001 tapeboy :Welcome, GLHF!")
+	l.LogError(fmt.Errorf("uh oh"))
+	l.LogError(nil)
+
+	assert.Equal(t, ""+
+		`{"time":"2024-02-06T04:20:01Z","direction":"send","line":"PASS oauth:<REDACTED>"}`+"\n"+
+		`{"time":"2024-02-06T04:20:02Z","direction":"recv","line":":tmi.twitch.tv 001 tapeboy :Welcome, GLHF!"}`+"\n"+
+		`{"time":"2024-02-06T04:20:03Z","direction":"error","line":"uh oh"}`+"\n",
+		buf.String())
+
+	entries, err := LoadSession(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []SessionEntry{
+		{Time: t0.Add(time.Second), Direction: SessionDirectionSend, Line: "PASS oauth:<REDACTED>"},
+		{Time: t0.Add(2 * time.Second), Direction: SessionDirectionRecv, Line: ":tmi.twitch.tv 001 tapeboy :Welcome, GLHF!"},
+		{Time: t0.Add(3 * time.Second), Direction: SessionDirectionError, Line: "uh oh"},
+	}, entries)
+}
+
+func Test_NewReplayDialFunc(t *testing.T) {
+	t0 := time.Date(2024, 2, 6, 4, 20, 0, 0, time.UTC)
+	entries := []SessionEntry{
+		{Time: t0, Direction: SessionDirectionSend, Line: "NICK tapeboy"},
+		{Time: t0, Direction: SessionDirectionRecv, Line: ":tmi.twitch.tv 001 tapeboy :Welcome, GLHF!"},
+		{Time: t0.Add(time.Second), Direction: SessionDirectionRecv, Line: ":tmi.twitch.tv CAP * ACK :twitch.tv/commands twitch.tv/tags"},
+		{Time: t0.Add(2 * time.Second), Direction: SessionDirectionError, Line: "uh oh"},
+		{Time: t0.Add(3 * time.Second), Direction: SessionDirectionRecv, Line: "PING :tmi.twitch.tv"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Replaying at 100x speed should take about 30ms
+	start := time.Now()
+	var recorded bytes.Buffer
+	c, err := NewConn(ctx, ConnOpts{
+		Dial:   NewReplayDialFunc(entries, ReplayOpts{Speed: 100, CloseWhenDone: true}),
+		Logger: NewMultiLogger(NewStreamLogger(io.Discard), NewSessionRecorder(&recorded)),
+	})
+	assert.NoError(t, err)
+	ch, err := c.Recv()
+	assert.NoError(t, err)
+	err = c.Send("NICK tapeboy")
+	assert.NoError(t, err)
+
+	lines := make([]string, 0)
+	for line := range ch {
+		lines = append(lines, line)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	assert.Equal(t, []string{
+		":tmi.twitch.tv 001 tapeboy :Welcome, GLHF!\r",
+		":tmi.twitch.tv CAP * ACK :twitch.tv/commands twitch.tv/tags\r",
+		"PING :tmi.twitch.tv\r",
+	}, lines)
+
+	// Our multi-logger should have recorded the session as it was replayed, including
+	// the EOF that resulted from the server closing the connection
+	replayed, err := LoadSession(&recorded)
+	assert.NoError(t, err)
+	directions := make([]SessionDirection, 0, len(replayed))
+	for _, entry := range replayed {
+		directions = append(directions, entry.Direction)
+	}
+	assert.Equal(t, []SessionDirection{
+		SessionDirectionSend,
+		SessionDirectionRecv,
+		SessionDirectionRecv,
+		SessionDirectionRecv,
+		SessionDirectionError,
+	}, directions)
+}
@@ -0,0 +1,627 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/roles"
+)
+
+// ErrUnexpectedMessageType is returned when a Message is decoded as a Twitch message
+// type that it isn't, e.g. when calling ParsePrivmsg on a NOTICE message
+var ErrUnexpectedMessageType = errors.New("unexpected message type")
+
+// MissingTagError is returned when a Message can't be decoded because it's missing a
+// tag that's required for its type
+type MissingTagError struct {
+	Tag string
+}
+
+func (e *MissingTagError) Error() string {
+	return fmt.Sprintf("missing extra attribute '%s'", e.Tag)
+}
+
+// InvalidTagError is returned when a Message can't be decoded because one of its tags
+// has a value that can't be parsed
+type InvalidTagError struct {
+	Tag   string
+	Value string
+	Err   error
+}
+
+func (e *InvalidTagError) Error() string {
+	return fmt.Sprintf("invalid value '%s' for extra attribute '%s': %v", e.Value, e.Tag, e.Err)
+}
+
+func (e *InvalidTagError) Unwrap() error {
+	return e.Err
+}
+
+// Sender identifies the user who sent a message, along with how they appear in chat
+type Sender struct {
+	// UserId is the user's Twitch user ID
+	UserId string
+	// Login is the user's all-lowercase Twitch username
+	Login string
+	// DisplayName is the user's name as it should be displayed in chat
+	DisplayName string
+	// Color is the hex color code chosen by the user for their name, or an empty
+	// string if they haven't chosen a color
+	Color string
+	// Badges lists the chat badges displayed alongside the user's name
+	Badges []roles.Badge
+	// BadgeInfo carries additional metadata for some badges, e.g. the exact number of
+	// months the user has been subscribed
+	BadgeInfo []roles.Badge
+}
+
+// Roles resolves the user's roles in the channel from their badges
+func (s *Sender) Roles() roles.Set {
+	return roles.FromBadges(s.Badges, s.BadgeInfo)
+}
+
+// ReplyParent identifies the message that a PRIVMSG was sent in reply to
+type ReplyParent struct {
+	MessageId   string
+	UserId      string
+	Login       string
+	DisplayName string
+	Text        string
+}
+
+// Privmsg is a chat message sent by a user to a channel
+type Privmsg struct {
+	Sender
+
+	// Channel is the name of the channel, without a leading '#'
+	Channel string
+	// RoomId is the Twitch user ID of the broadcaster who owns the channel
+	RoomId string
+	// MessageId uniquely identifies the message
+	MessageId string
+	// Text is the body of the message
+	Text string
+	// Emotes is the raw value of the 'emotes' tag, indicating where emotes appear in
+	// the text
+	Emotes string
+	// Bits is the number of bits cheered with the message, if any
+	Bits int
+	// SentAt is the time at which Twitch received the message
+	SentAt time.Time
+	// FirstMessage is true if this is the user's first ever message in the channel
+	FirstMessage bool
+	// ReturningChatter is true if Twitch considers the user to be a returning chatter
+	ReturningChatter bool
+	// Reply is set if the message was sent as a reply to another message
+	Reply *ReplyParent
+}
+
+// Usernotice is a message that Twitch sends on a user's behalf when they subscribe,
+// gift subs, raid the channel, post an announcement, etc.
+type Usernotice struct {
+	Sender
+
+	// Channel is the name of the channel, without a leading '#'
+	Channel string
+	// RoomId is the Twitch user ID of the broadcaster who owns the channel
+	RoomId string
+	// MessageId uniquely identifies the message
+	MessageId string
+	// Kind is the value of the 'msg-id' tag, indicating what sort of event occurred:
+	// e.g. 'sub', 'resub', 'subgift', 'submysterygift', 'raid', 'announcement'
+	Kind string
+	// SystemMessage is the text that Twitch displays to describe the event
+	SystemMessage string
+	// Text is the message that the user attached to the event, if any
+	Text string
+	// Emotes is the raw value of the 'emotes' tag, indicating where emotes appear in
+	// the text
+	Emotes string
+	// SentAt is the time at which Twitch received the message
+	SentAt time.Time
+	// Params contains all 'msg-param-*' tags, keyed by their names with that prefix
+	// removed: e.g. 'msg-param-cumulative-months' is stored as 'cumulative-months'
+	Params map[string]string
+}
+
+// Clearmsg indicates that a moderator has deleted a single message
+type Clearmsg struct {
+	// Channel is the name of the channel, without a leading '#'
+	Channel string
+	// Login is the username of the user who sent the deleted message
+	Login string
+	// TargetMessageId is the ID of the message that was deleted
+	TargetMessageId string
+	// Text is the body of the deleted message
+	Text string
+	// SentAt is the time at which the message was deleted
+	SentAt time.Time
+}
+
+// Clearchat indicates that either all messages in the channel have been cleared, or
+// that all messages from a single user have been removed because they were banned or
+// timed out
+type Clearchat struct {
+	// Channel is the name of the channel, without a leading '#'
+	Channel string
+	// RoomId is the Twitch user ID of the broadcaster who owns the channel
+	RoomId string
+	// TargetUserId is the ID of the user whose messages were removed, or an empty
+	// string if the entire chat was cleared
+	TargetUserId string
+	// TargetLogin is the username of the user whose messages were removed, if any
+	TargetLogin string
+	// BanDuration is the length of the user's timeout, or 0 if the user was banned
+	// permanently (or if the entire chat was cleared)
+	BanDuration time.Duration
+	// SentAt is the time at which the messages were cleared
+	SentAt time.Time
+}
+
+// Roomstate describes the chat settings for a channel. Twitch sends a complete
+// ROOMSTATE upon joining a channel, then a partial ROOMSTATE whenever a setting
+// changes: any setting that's not included in the message is nil.
+type Roomstate struct {
+	// Channel is the name of the channel, without a leading '#'
+	Channel string
+	// RoomId is the Twitch user ID of the broadcaster who owns the channel
+	RoomId string
+	// EmoteOnly indicates whether users may only send messages consisting of emotes
+	EmoteOnly *bool
+	// FollowersOnly is the number of minutes a user must have followed the channel in
+	// order to chat, or -1 if followers-only mode is off
+	FollowersOnly *int
+	// R9K indicates whether unique-chat mode is enabled
+	R9K *bool
+	// SlowMode is the minimum amount of time users must wait between messages, or 0
+	// if slow mode is off
+	SlowMode *time.Duration
+	// SubsOnly indicates whether only subscribers may chat
+	SubsOnly *bool
+}
+
+// Userstate describes the bot's own user state in a channel, sent upon joining the
+// channel and after the bot sends a message
+type Userstate struct {
+	// Channel is the name of the channel, without a leading '#'
+	Channel string
+	// DisplayName is the bot's name as it's displayed in chat
+	DisplayName string
+	// Color is the hex color code used for the bot's name
+	Color string
+	// Badges lists the chat badges displayed alongside the bot's name
+	Badges []roles.Badge
+	// BadgeInfo carries additional metadata for some badges
+	BadgeInfo []roles.Badge
+	// EmoteSets lists the IDs of the emote sets that the bot may use
+	EmoteSets []string
+	// IsModerator is true if the bot is a moderator in the channel
+	IsModerator bool
+}
+
+// GlobalUserstate describes the bot's own user state upon logging in
+type GlobalUserstate struct {
+	// UserId is the bot's Twitch user ID
+	UserId string
+	// DisplayName is the bot's name as it's displayed in chat
+	DisplayName string
+	// Color is the hex color code used for the bot's name
+	Color string
+	// Badges lists the global chat badges displayed alongside the bot's name
+	Badges []roles.Badge
+	// BadgeInfo carries additional metadata for some badges
+	BadgeInfo []roles.Badge
+	// EmoteSets lists the IDs of the emote sets that the bot may use
+	EmoteSets []string
+}
+
+// Notice is a message from the server indicating the outcome of some action, or
+// indicating some error condition
+type Notice struct {
+	// Channel is the name of the channel, without a leading '#', or '*' if the notice
+	// isn't specific to a channel
+	Channel string
+	// Kind is the value of the 'msg-id' tag identifying the notice, e.g. 'msg_ratelimit';
+	// some notices (such as login failures) have no msg-id
+	Kind string
+	// Text is the human-readable text of the notice
+	Text string
+}
+
+// Whisper is a private message sent directly to the bot
+type Whisper struct {
+	Sender
+
+	// MessageId uniquely identifies the message
+	MessageId string
+	// ThreadId identifies the conversation between the two users
+	ThreadId string
+	// Recipient is the username of the user the whisper was sent to
+	Recipient string
+	// Text is the body of the message
+	Text string
+	// Emotes is the raw value of the 'emotes' tag, indicating where emotes appear in
+	// the text
+	Emotes string
+}
+
+// ParsePrivmsg decodes a PRIVMSG message
+func ParsePrivmsg(m *Message) (*Privmsg, error) {
+	if err := requireType(m, "PRIVMSG"); err != nil {
+		return nil, err
+	}
+	messageId, err := requireTag(m, "id")
+	if err != nil {
+		return nil, err
+	}
+	sender, err := parseSender(m, loginFromPrefix(m.Prefix))
+	if err != nil {
+		return nil, err
+	}
+	bits, err := parseIntTag(m, "bits")
+	if err != nil {
+		return nil, err
+	}
+	sentAt, err := parseTimestampTag(m, "tmi-sent-ts")
+	if err != nil {
+		return nil, err
+	}
+
+	var reply *ReplyParent
+	if parentMessageId := m.Extra["reply-parent-msg-id"]; parentMessageId != "" {
+		reply = &ReplyParent{
+			MessageId:   parentMessageId,
+			UserId:      m.Extra["reply-parent-user-id"],
+			Login:       m.Extra["reply-parent-user-login"],
+			DisplayName: m.Extra["reply-parent-display-name"],
+			Text:        m.Extra["reply-parent-msg-body"],
+		}
+	}
+
+	return &Privmsg{
+		Sender:           *sender,
+		Channel:          channelFromParams(m.Params),
+		RoomId:           m.Extra["room-id"],
+		MessageId:        messageId,
+		Text:             m.Body,
+		Emotes:           m.Extra["emotes"],
+		Bits:             bits,
+		SentAt:           sentAt,
+		FirstMessage:     m.Extra["first-msg"] == "1",
+		ReturningChatter: m.Extra["returning-chatter"] == "1",
+		Reply:            reply,
+	}, nil
+}
+
+// ParseUsernotice decodes a USERNOTICE message
+func ParseUsernotice(m *Message) (*Usernotice, error) {
+	if err := requireType(m, "USERNOTICE"); err != nil {
+		return nil, err
+	}
+	messageId, err := requireTag(m, "id")
+	if err != nil {
+		return nil, err
+	}
+	kind, err := requireTag(m, "msg-id")
+	if err != nil {
+		return nil, err
+	}
+	sender, err := parseSender(m, m.Extra["login"])
+	if err != nil {
+		return nil, err
+	}
+	sentAt, err := parseTimestampTag(m, "tmi-sent-ts")
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string)
+	for key, value := range m.Extra {
+		if name, ok := strings.CutPrefix(key, "msg-param-"); ok {
+			params[name] = value
+		}
+	}
+
+	return &Usernotice{
+		Sender:        *sender,
+		Channel:       channelFromParams(m.Params),
+		RoomId:        m.Extra["room-id"],
+		MessageId:     messageId,
+		Kind:          kind,
+		SystemMessage: m.Extra["system-msg"],
+		Text:          m.Body,
+		Emotes:        m.Extra["emotes"],
+		SentAt:        sentAt,
+		Params:        params,
+	}, nil
+}
+
+// ParseClearmsg decodes a CLEARMSG message
+func ParseClearmsg(m *Message) (*Clearmsg, error) {
+	if err := requireType(m, "CLEARMSG"); err != nil {
+		return nil, err
+	}
+	targetMessageId, err := requireTag(m, "target-msg-id")
+	if err != nil {
+		return nil, err
+	}
+	sentAt, err := parseTimestampTag(m, "tmi-sent-ts")
+	if err != nil {
+		return nil, err
+	}
+	return &Clearmsg{
+		Channel:         channelFromParams(m.Params),
+		Login:           m.Extra["login"],
+		TargetMessageId: targetMessageId,
+		Text:            m.Body,
+		SentAt:          sentAt,
+	}, nil
+}
+
+// ParseClearchat decodes a CLEARCHAT message
+func ParseClearchat(m *Message) (*Clearchat, error) {
+	if err := requireType(m, "CLEARCHAT"); err != nil {
+		return nil, err
+	}
+	banDurationSeconds, err := parseIntTag(m, "ban-duration")
+	if err != nil {
+		return nil, err
+	}
+	sentAt, err := parseTimestampTag(m, "tmi-sent-ts")
+	if err != nil {
+		return nil, err
+	}
+	return &Clearchat{
+		Channel:      channelFromParams(m.Params),
+		RoomId:       m.Extra["room-id"],
+		TargetUserId: m.Extra["target-user-id"],
+		TargetLogin:  m.Body,
+		BanDuration:  time.Duration(banDurationSeconds) * time.Second,
+		SentAt:       sentAt,
+	}, nil
+}
+
+// ParseRoomstate decodes a ROOMSTATE message
+func ParseRoomstate(m *Message) (*Roomstate, error) {
+	if err := requireType(m, "ROOMSTATE"); err != nil {
+		return nil, err
+	}
+	rs := &Roomstate{
+		Channel: channelFromParams(m.Params),
+		RoomId:  m.Extra["room-id"],
+	}
+	if value, ok := m.Extra["emote-only"]; ok {
+		emoteOnly := value == "1"
+		rs.EmoteOnly = &emoteOnly
+	}
+	if _, ok := m.Extra["followers-only"]; ok {
+		followersOnly, err := parseIntTag(m, "followers-only")
+		if err != nil {
+			return nil, err
+		}
+		rs.FollowersOnly = &followersOnly
+	}
+	if value, ok := m.Extra["r9k"]; ok {
+		r9k := value == "1"
+		rs.R9K = &r9k
+	}
+	if _, ok := m.Extra["slow"]; ok {
+		seconds, err := parseIntTag(m, "slow")
+		if err != nil {
+			return nil, err
+		}
+		slowMode := time.Duration(seconds) * time.Second
+		rs.SlowMode = &slowMode
+	}
+	if value, ok := m.Extra["subs-only"]; ok {
+		subsOnly := value == "1"
+		rs.SubsOnly = &subsOnly
+	}
+	return rs, nil
+}
+
+// ParseUserstate decodes a USERSTATE message
+func ParseUserstate(m *Message) (*Userstate, error) {
+	if err := requireType(m, "USERSTATE"); err != nil {
+		return nil, err
+	}
+	badges, err := parseBadgesTag(m, "badges")
+	if err != nil {
+		return nil, err
+	}
+	badgeInfo, err := parseBadgesTag(m, "badge-info")
+	if err != nil {
+		return nil, err
+	}
+	return &Userstate{
+		Channel:     channelFromParams(m.Params),
+		DisplayName: m.Extra["display-name"],
+		Color:       m.Extra["color"],
+		Badges:      badges,
+		BadgeInfo:   badgeInfo,
+		EmoteSets:   splitList(m.Extra["emote-sets"]),
+		IsModerator: m.Extra["mod"] == "1",
+	}, nil
+}
+
+// ParseGlobalUserstate decodes a GLOBALUSERSTATE message
+func ParseGlobalUserstate(m *Message) (*GlobalUserstate, error) {
+	if err := requireType(m, "GLOBALUSERSTATE"); err != nil {
+		return nil, err
+	}
+	badges, err := parseBadgesTag(m, "badges")
+	if err != nil {
+		return nil, err
+	}
+	badgeInfo, err := parseBadgesTag(m, "badge-info")
+	if err != nil {
+		return nil, err
+	}
+	return &GlobalUserstate{
+		UserId:      m.Extra["user-id"],
+		DisplayName: m.Extra["display-name"],
+		Color:       m.Extra["color"],
+		Badges:      badges,
+		BadgeInfo:   badgeInfo,
+		EmoteSets:   splitList(m.Extra["emote-sets"]),
+	}, nil
+}
+
+// ParseNotice decodes a NOTICE message
+func ParseNotice(m *Message) (*Notice, error) {
+	if err := requireType(m, "NOTICE"); err != nil {
+		return nil, err
+	}
+	channel := "*"
+	if len(m.Params) > 0 && m.Params[0] != "*" {
+		channel = channelFromParams(m.Params)
+	}
+	return &Notice{
+		Channel: channel,
+		Kind:    m.Extra["msg-id"],
+		Text:    m.Body,
+	}, nil
+}
+
+// ParseWhisper decodes a WHISPER message
+func ParseWhisper(m *Message) (*Whisper, error) {
+	if err := requireType(m, "WHISPER"); err != nil {
+		return nil, err
+	}
+	messageId, err := requireTag(m, "message-id")
+	if err != nil {
+		return nil, err
+	}
+	sender, err := parseSender(m, loginFromPrefix(m.Prefix))
+	if err != nil {
+		return nil, err
+	}
+	recipient := ""
+	if len(m.Params) > 0 {
+		recipient = m.Params[0]
+	}
+	return &Whisper{
+		Sender:    *sender,
+		MessageId: messageId,
+		ThreadId:  m.Extra["thread-id"],
+		Recipient: recipient,
+		Text:      m.Body,
+		Emotes:    m.Extra["emotes"],
+	}, nil
+}
+
+func requireType(m *Message, messageType string) error {
+	if m.Type != messageType {
+		return fmt.Errorf("%w: expected %s; got %s", ErrUnexpectedMessageType, messageType, m.Type)
+	}
+	return nil
+}
+
+func requireTag(m *Message, key string) (string, error) {
+	value := m.Extra[key]
+	if value == "" {
+		return "", &MissingTagError{Tag: key}
+	}
+	return value, nil
+}
+
+func parseSender(m *Message, login string) (*Sender, error) {
+	userId, err := requireTag(m, "user-id")
+	if err != nil {
+		return nil, err
+	}
+	displayName, err := requireTag(m, "display-name")
+	if err != nil {
+		return nil, err
+	}
+	badges, err := parseBadgesTag(m, "badges")
+	if err != nil {
+		return nil, err
+	}
+	badgeInfo, err := parseBadgesTag(m, "badge-info")
+	if err != nil {
+		return nil, err
+	}
+	return &Sender{
+		UserId:      userId,
+		Login:       login,
+		DisplayName: displayName,
+		Color:       m.Extra["color"],
+		Badges:      badges,
+		BadgeInfo:   badgeInfo,
+	}, nil
+}
+
+// parseIntTag parses the value of an integer-valued tag, returning 0 if the tag is
+// absent or empty
+func parseIntTag(m *Message, key string) (int, error) {
+	value := m.Extra[key]
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &InvalidTagError{Tag: key, Value: value, Err: err}
+	}
+	return n, nil
+}
+
+// parseTimestampTag parses the value of a tag that holds a Unix timestamp in
+// milliseconds, returning the zero time if the tag is absent or empty
+func parseTimestampTag(m *Message, key string) (time.Time, error) {
+	value := m.Extra[key]
+	if value == "" {
+		return time.Time{}, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, &InvalidTagError{Tag: key, Value: value, Err: err}
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// parseBadgesTag parses a comma-separated list of 'name/version' badges, e.g.
+// 'moderator/1,subscriber/12'
+func parseBadgesTag(m *Message, key string) ([]roles.Badge, error) {
+	badges := make([]roles.Badge, 0)
+	for _, token := range splitList(m.Extra[key]) {
+		name, version, ok := strings.Cut(token, "/")
+		if !ok || name == "" {
+			return nil, &InvalidTagError{Tag: key, Value: m.Extra[key], Err: fmt.Errorf("badge '%s' is not of the form 'name/version'", token)}
+		}
+		badges = append(badges, roles.Badge{Name: name, Version: version})
+	}
+	return badges, nil
+}
+
+// splitList splits a comma-separated tag value, returning nil if the value is empty
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// loginFromPrefix extracts the username from a prefix of the form
+// 'login!login@login.tmi.twitch.tv'
+func loginFromPrefix(prefix string) string {
+	login, _, _ := strings.Cut(prefix, "!")
+	if strings.ContainsRune(login, '.') {
+		return ""
+	}
+	return login
+}
+
+// channelFromParams returns the name of the channel (sans '#') targeted by a message,
+// i.e. from the first '#'-prefixed parameter
+func channelFromParams(params []string) string {
+	for _, param := range params {
+		if strings.HasPrefix(param, "#") {
+			return param[1:]
+		}
+	}
+	return ""
+}
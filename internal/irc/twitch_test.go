@@ -0,0 +1,275 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot/internal/roles"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseMessage(t *testing.T, s string) *Message {
+	m, err := parseMessage(s)
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	return m
+}
+
+func boolPtr(b bool) *bool                       { return &b }
+func intPtr(n int) *int                          { return &n }
+func durationPtr(d time.Duration) *time.Duration { return &d }
+
+func Test_ParsePrivmsg(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    *Privmsg
+		wantErr string
+	}{
+		{
+			"basic message",
+			"@badge-info=subscriber/14;badges=moderator/1,subscriber/12;color=#00FF7F;display-name=wasabimilkshake;emotes=;first-msg=1;flags=;id=ad6d1481-1471-4538-900a-493704fc60c5;mod=1;returning-chatter=0;room-id=953753877;subscriber=1;tmi-sent-ts=1707193714879;turbo=0;user-id=90790024;user-type=mod :wasabimilkshake!wasabimilkshake@wasabimilkshake.tmi.twitch.tv PRIVMSG #goldenvcr :hello world",
+			&Privmsg{
+				Sender: Sender{
+					UserId:      "90790024",
+					Login:       "wasabimilkshake",
+					DisplayName: "wasabimilkshake",
+					Color:       "#00FF7F",
+					Badges:      []roles.Badge{{Name: "moderator", Version: "1"}, {Name: "subscriber", Version: "12"}},
+					BadgeInfo:   []roles.Badge{{Name: "subscriber", Version: "14"}},
+				},
+				Channel:      "goldenvcr",
+				RoomId:       "953753877",
+				MessageId:    "ad6d1481-1471-4538-900a-493704fc60c5",
+				Text:         "hello world",
+				SentAt:       time.UnixMilli(1707193714879).UTC(),
+				FirstMessage: true,
+			},
+			"",
+		},
+		{
+			"cheer in reply to another message",
+			"@badge-info=;badges=bits/100;bits=200;color=;display-name=Someone;emotes=;id=1;reply-parent-display-name=TapeBoy;reply-parent-msg-body=hi\\sthere;reply-parent-msg-id=0;reply-parent-user-id=1001686376;reply-parent-user-login=tapeboy;room-id=953753877;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :@TapeBoy Cheer200 ghost of a VCR",
+			&Privmsg{
+				Sender: Sender{
+					UserId:      "42",
+					Login:       "someone",
+					DisplayName: "Someone",
+					Badges:      []roles.Badge{{Name: "bits", Version: "100"}},
+					BadgeInfo:   []roles.Badge{},
+				},
+				Channel:   "goldenvcr",
+				RoomId:    "953753877",
+				MessageId: "1",
+				Text:      "@TapeBoy Cheer200 ghost of a VCR",
+				Bits:      200,
+				Reply: &ReplyParent{
+					MessageId:   "0",
+					UserId:      "1001686376",
+					Login:       "tapeboy",
+					DisplayName: "TapeBoy",
+					Text:        "hi there",
+				},
+			},
+			"",
+		},
+		{
+			"missing id",
+			"@display-name=Someone;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :hi",
+			nil,
+			"missing extra attribute 'id'",
+		},
+		{
+			"missing user-id",
+			"@display-name=Someone;id=1 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :hi",
+			nil,
+			"missing extra attribute 'user-id'",
+		},
+		{
+			"invalid bits",
+			"@bits=lots;display-name=Someone;id=1;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :hi",
+			nil,
+			"invalid value 'lots' for extra attribute 'bits': strconv.Atoi: parsing \"lots\": invalid syntax",
+		},
+		{
+			"invalid badges",
+			"@badges=broadcaster;display-name=Someone;id=1;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :hi",
+			nil,
+			"invalid value 'broadcaster' for extra attribute 'badges': badge 'broadcaster' is not of the form 'name/version'",
+		},
+		{
+			"wrong message type",
+			"@display-name=Someone;id=1;user-id=42 :someone!someone@someone.tmi.twitch.tv WHISPER tapeboy :hi",
+			nil,
+			"unexpected message type: expected PRIVMSG; got WHISPER",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePrivmsg(mustParseMessage(t, tt.s))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_ParseUsernotice(t *testing.T) {
+	m := mustParseMessage(t, "@badge-info=subscriber/7;badges=subscriber/6;color=#FF0000;display-name=Someone;emotes=;id=1;login=someone;msg-id=resub;msg-param-cumulative-months=7;msg-param-sub-plan=1000;room-id=953753877;system-msg=Someone\\ssubscribed\\sat\\sTier\\s1.;tmi-sent-ts=1707193714879;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr :great stream")
+	got, err := ParseUsernotice(m)
+	assert.NoError(t, err)
+	assert.Equal(t, &Usernotice{
+		Sender: Sender{
+			UserId:      "42",
+			Login:       "someone",
+			DisplayName: "Someone",
+			Color:       "#FF0000",
+			Badges:      []roles.Badge{{Name: "subscriber", Version: "6"}},
+			BadgeInfo:   []roles.Badge{{Name: "subscriber", Version: "7"}},
+		},
+		Channel:       "goldenvcr",
+		RoomId:        "953753877",
+		MessageId:     "1",
+		Kind:          "resub",
+		SystemMessage: "Someone subscribed at Tier 1.",
+		Text:          "great stream",
+		SentAt:        time.UnixMilli(1707193714879).UTC(),
+		Params: map[string]string{
+			"cumulative-months": "7",
+			"sub-plan":          "1000",
+		},
+	}, got)
+
+	_, err = ParseUsernotice(mustParseMessage(t, "@display-name=Someone;id=1;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr"))
+	assert.EqualError(t, err, "missing extra attribute 'msg-id'")
+}
+
+func Test_ParseClearmsg(t *testing.T) {
+	got, err := ParseClearmsg(mustParseMessage(t, "@login=wasabimilkshake;room-id=;target-msg-id=8921f142;tmi-sent-ts=1707193714879 :tmi.twitch.tv CLEARMSG #goldenvcr :oops"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Clearmsg{
+		Channel:         "goldenvcr",
+		Login:           "wasabimilkshake",
+		TargetMessageId: "8921f142",
+		Text:            "oops",
+		SentAt:          time.UnixMilli(1707193714879).UTC(),
+	}, got)
+
+	_, err = ParseClearmsg(mustParseMessage(t, "@login=wasabimilkshake :tmi.twitch.tv CLEARMSG #goldenvcr :oops"))
+	assert.EqualError(t, err, "missing extra attribute 'target-msg-id'")
+}
+
+func Test_ParseClearchat(t *testing.T) {
+	got, err := ParseClearchat(mustParseMessage(t, "@ban-duration=600;room-id=953753877;target-user-id=90790024;tmi-sent-ts=1707193714879 :tmi.twitch.tv CLEARCHAT #goldenvcr :wasabimilkshake"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Clearchat{
+		Channel:      "goldenvcr",
+		RoomId:       "953753877",
+		TargetUserId: "90790024",
+		TargetLogin:  "wasabimilkshake",
+		BanDuration:  10 * time.Minute,
+		SentAt:       time.UnixMilli(1707193714879).UTC(),
+	}, got)
+
+	got, err = ParseClearchat(mustParseMessage(t, "@room-id=953753877 :tmi.twitch.tv CLEARCHAT #goldenvcr"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Clearchat{
+		Channel: "goldenvcr",
+		RoomId:  "953753877",
+	}, got)
+}
+
+func Test_ParseRoomstate(t *testing.T) {
+	got, err := ParseRoomstate(mustParseMessage(t, "@emote-only=0;followers-only=-1;r9k=0;room-id=953753877;slow=30;subs-only=1 :tmi.twitch.tv ROOMSTATE #goldenvcr"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Roomstate{
+		Channel:       "goldenvcr",
+		RoomId:        "953753877",
+		EmoteOnly:     boolPtr(false),
+		FollowersOnly: intPtr(-1),
+		R9K:           boolPtr(false),
+		SlowMode:      durationPtr(30 * time.Second),
+		SubsOnly:      boolPtr(true),
+	}, got)
+
+	// Partial updates should leave unchanged settings unset
+	got, err = ParseRoomstate(mustParseMessage(t, "@room-id=953753877;slow=0 :tmi.twitch.tv ROOMSTATE #goldenvcr"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Roomstate{
+		Channel:  "goldenvcr",
+		RoomId:   "953753877",
+		SlowMode: durationPtr(0),
+	}, got)
+}
+
+func Test_ParseUserstate(t *testing.T) {
+	got, err := ParseUserstate(mustParseMessage(t, "@badge-info=;badges=moderator/1;color=;display-name=TapeBoy;emote-sets=0,300374282;mod=1;subscriber=0;user-type=mod :tmi.twitch.tv USERSTATE #goldenvcr"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Userstate{
+		Channel:     "goldenvcr",
+		DisplayName: "TapeBoy",
+		Badges:      []roles.Badge{{Name: "moderator", Version: "1"}},
+		BadgeInfo:   []roles.Badge{},
+		EmoteSets:   []string{"0", "300374282"},
+		IsModerator: true,
+	}, got)
+}
+
+func Test_ParseGlobalUserstate(t *testing.T) {
+	got, err := ParseGlobalUserstate(mustParseMessage(t, "@badge-info=;badges=;color=#1E90FF;display-name=TapeBoy;emote-sets=0;user-id=1001686376;user-type= :tmi.twitch.tv GLOBALUSERSTATE"))
+	assert.NoError(t, err)
+	assert.Equal(t, &GlobalUserstate{
+		UserId:      "1001686376",
+		DisplayName: "TapeBoy",
+		Color:       "#1E90FF",
+		Badges:      []roles.Badge{},
+		BadgeInfo:   []roles.Badge{},
+		EmoteSets:   []string{"0"},
+	}, got)
+}
+
+func Test_ParseNotice(t *testing.T) {
+	got, err := ParseNotice(mustParseMessage(t, "@msg-id=msg_ratelimit :tmi.twitch.tv NOTICE #goldenvcr :Your message was not sent because you are sending messages too quickly."))
+	assert.NoError(t, err)
+	assert.Equal(t, &Notice{
+		Channel: "goldenvcr",
+		Kind:    "msg_ratelimit",
+		Text:    "Your message was not sent because you are sending messages too quickly.",
+	}, got)
+
+	got, err = ParseNotice(mustParseMessage(t, ":tmi.twitch.tv NOTICE * :Login authentication failed"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Notice{
+		Channel: "*",
+		Text:    "Login authentication failed",
+	}, got)
+}
+
+func Test_ParseWhisper(t *testing.T) {
+	got, err := ParseWhisper(mustParseMessage(t, "@badges=;color=;display-name=Someone;emotes=;message-id=3;thread-id=42_1001686376;turbo=0;user-id=42;user-type= :someone!someone@someone.tmi.twitch.tv WHISPER tapeboy :psst"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Whisper{
+		Sender: Sender{
+			UserId:      "42",
+			Login:       "someone",
+			DisplayName: "Someone",
+			Badges:      []roles.Badge{},
+			BadgeInfo:   []roles.Badge{},
+		},
+		MessageId: "3",
+		ThreadId:  "42_1001686376",
+		Recipient: "tapeboy",
+		Text:      "psst",
+	}, got)
+}
+
+func Test_Sender_Roles(t *testing.T) {
+	pm, err := ParsePrivmsg(mustParseMessage(t, "@badge-info=subscriber/14;badges=moderator/1,subscriber/12;display-name=Someone;id=1;user-id=42 :someone!someone@someone.tmi.twitch.tv PRIVMSG #goldenvcr :hi"))
+	assert.NoError(t, err)
+	assert.Equal(t, roles.Set{Moderator: true, Subscriber: true, SubscriberMonths: 14}, pm.Roles())
+}
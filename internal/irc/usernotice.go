@@ -0,0 +1,169 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/golden-vcr/schemas/core"
+	etwitch "github.com/golden-vcr/schemas/twitch-events"
+)
+
+// anonymousGifterLogin is the username that Twitch attributes gift subs to when the
+// gifter has chosen to remain anonymous
+const anonymousGifterLogin = "ananonymousgifter"
+
+// twitchEventsFromUsernotice converts a USERNOTICE into the events that should be
+// published to the twitch-events queue in response, if any
+func twitchEventsFromUsernotice(un *Usernotice) ([]*etwitch.Event, error) {
+	viewer := &core.Viewer{
+		TwitchUserId:      un.UserId,
+		TwitchDisplayName: un.DisplayName,
+	}
+
+	switch un.Kind {
+	case "sub":
+		creditMultiplier, err := creditMultiplierFromSubPlan(un.Params["sub-plan"])
+		if err != nil {
+			return nil, err
+		}
+		return []*etwitch.Event{{
+			Type:   etwitch.EventTypeViewerSubscribed,
+			Viewer: viewer,
+			Payload: &etwitch.Payload{
+				ViewerSubscribed: &etwitch.PayloadViewerSubscribed{
+					CreditMultiplier: creditMultiplier,
+				},
+			},
+		}}, nil
+	case "resub":
+		creditMultiplier, err := creditMultiplierFromSubPlan(un.Params["sub-plan"])
+		if err != nil {
+			return nil, err
+		}
+		numCumulativeMonths, err := requireIntParam(un, "cumulative-months")
+		if err != nil {
+			return nil, err
+		}
+		return []*etwitch.Event{{
+			Type:   etwitch.EventTypeViewerResubscribed,
+			Viewer: viewer,
+			Payload: &etwitch.Payload{
+				ViewerResubscribed: &etwitch.PayloadViewerResubscribed{
+					CreditMultiplier:    creditMultiplier,
+					NumCumulativeMonths: numCumulativeMonths,
+					Message:             un.Text,
+				},
+			},
+		}}, nil
+	case "subgift":
+		creditMultiplier, err := creditMultiplierFromSubPlan(un.Params["sub-plan"])
+		if err != nil {
+			return nil, err
+		}
+		recipientId := un.Params["recipient-id"]
+		if recipientId == "" {
+			return nil, &MissingTagError{Tag: "msg-param-recipient-id"}
+		}
+		events := []*etwitch.Event{{
+			Type: etwitch.EventTypeViewerReceivedGiftSub,
+			Viewer: &core.Viewer{
+				TwitchUserId:      recipientId,
+				TwitchDisplayName: un.Params["recipient-display-name"],
+			},
+			Payload: &etwitch.Payload{
+				ViewerReceivedGiftSub: &etwitch.PayloadViewerReceivedGiftSub{
+					CreditMultiplier: creditMultiplier,
+				},
+			},
+		}}
+
+		// If this gift is part of a batch of gifts to random viewers, the gifter is
+		// credited via the preceding 'submysterygift'; otherwise it's a single gift
+		if un.Params["community-gift-id"] == "" {
+			events = append(events, &etwitch.Event{
+				Type:   etwitch.EventTypeViewerGiftedSubs,
+				Viewer: gifterViewer(un),
+				Payload: &etwitch.Payload{
+					ViewerGiftedSubs: &etwitch.PayloadViewerGiftedSubs{
+						CreditMultiplier: creditMultiplier,
+						NumSubscriptions: 1,
+					},
+				},
+			})
+		}
+		return events, nil
+	case "submysterygift":
+		creditMultiplier, err := creditMultiplierFromSubPlan(un.Params["sub-plan"])
+		if err != nil {
+			return nil, err
+		}
+		numSubscriptions, err := requireIntParam(un, "mass-gift-count")
+		if err != nil {
+			return nil, err
+		}
+		return []*etwitch.Event{{
+			Type:   etwitch.EventTypeViewerGiftedSubs,
+			Viewer: gifterViewer(un),
+			Payload: &etwitch.Payload{
+				ViewerGiftedSubs: &etwitch.PayloadViewerGiftedSubs{
+					CreditMultiplier: creditMultiplier,
+					NumSubscriptions: numSubscriptions,
+				},
+			},
+		}}, nil
+	case "raid":
+		numRaiders, err := requireIntParam(un, "viewerCount")
+		if err != nil {
+			return nil, err
+		}
+		return []*etwitch.Event{{
+			Type:   etwitch.EventTypeViewerRaided,
+			Viewer: viewer,
+			Payload: &etwitch.Payload{
+				ViewerRaided: &etwitch.PayloadViewerRaided{
+					NumRaiders: numRaiders,
+				},
+			},
+		}}, nil
+	}
+	return nil, nil
+}
+
+// gifterViewer identifies the user who gifted subs, or returns nil if the gifter is
+// anonymous
+func gifterViewer(un *Usernotice) *core.Viewer {
+	if un.Login == anonymousGifterLogin {
+		return nil
+	}
+	return &core.Viewer{
+		TwitchUserId:      un.UserId,
+		TwitchDisplayName: un.DisplayName,
+	}
+}
+
+// creditMultiplierFromSubPlan determines how many times the usual number of fun
+// points should be credited for a subscription at the given tier, consistent with the
+// EventSub-based handling of the same events
+func creditMultiplierFromSubPlan(subPlan string) (int, error) {
+	switch subPlan {
+	case "Prime", "1000":
+		return 1, nil
+	case "2000":
+		return 2, nil
+	case "3000":
+		return 5, nil
+	}
+	return 0, &InvalidTagError{Tag: "msg-param-sub-plan", Value: subPlan, Err: fmt.Errorf("unrecognized sub plan")}
+}
+
+func requireIntParam(un *Usernotice, name string) (int, error) {
+	value := un.Params[name]
+	if value == "" {
+		return 0, &MissingTagError{Tag: "msg-param-" + name}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &InvalidTagError{Tag: "msg-param-" + name, Value: value, Err: err}
+	}
+	return n, nil
+}
@@ -0,0 +1,134 @@
+package irc
+
+import (
+	"testing"
+
+	"github.com/golden-vcr/schemas/core"
+	etwitch "github.com/golden-vcr/schemas/twitch-events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_twitchEventsFromUsernotice(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []*etwitch.Event
+		wantErr string
+	}{
+		{
+			"sub",
+			"@display-name=Someone;id=1;login=someone;msg-id=sub;msg-param-sub-plan=Prime;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			[]*etwitch.Event{{
+				Type:   etwitch.EventTypeViewerSubscribed,
+				Viewer: &core.Viewer{TwitchUserId: "42", TwitchDisplayName: "Someone"},
+				Payload: &etwitch.Payload{
+					ViewerSubscribed: &etwitch.PayloadViewerSubscribed{CreditMultiplier: 1},
+				},
+			}},
+			"",
+		},
+		{
+			"resub",
+			"@display-name=Someone;id=1;login=someone;msg-id=resub;msg-param-cumulative-months=7;msg-param-sub-plan=2000;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr :still here",
+			[]*etwitch.Event{{
+				Type:   etwitch.EventTypeViewerResubscribed,
+				Viewer: &core.Viewer{TwitchUserId: "42", TwitchDisplayName: "Someone"},
+				Payload: &etwitch.Payload{
+					ViewerResubscribed: &etwitch.PayloadViewerResubscribed{
+						CreditMultiplier:    2,
+						NumCumulativeMonths: 7,
+						Message:             "still here",
+					},
+				},
+			}},
+			"",
+		},
+		{
+			"single gift sub",
+			"@display-name=Someone;id=1;login=someone;msg-id=subgift;msg-param-recipient-display-name=Lucky;msg-param-recipient-id=43;msg-param-sub-plan=3000;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			[]*etwitch.Event{
+				{
+					Type:   etwitch.EventTypeViewerReceivedGiftSub,
+					Viewer: &core.Viewer{TwitchUserId: "43", TwitchDisplayName: "Lucky"},
+					Payload: &etwitch.Payload{
+						ViewerReceivedGiftSub: &etwitch.PayloadViewerReceivedGiftSub{CreditMultiplier: 5},
+					},
+				},
+				{
+					Type:   etwitch.EventTypeViewerGiftedSubs,
+					Viewer: &core.Viewer{TwitchUserId: "42", TwitchDisplayName: "Someone"},
+					Payload: &etwitch.Payload{
+						ViewerGiftedSubs: &etwitch.PayloadViewerGiftedSubs{CreditMultiplier: 5, NumSubscriptions: 1},
+					},
+				},
+			},
+			"",
+		},
+		{
+			"gift sub as part of a gift bomb",
+			"@display-name=Someone;id=1;login=someone;msg-id=subgift;msg-param-community-gift-id=123;msg-param-recipient-display-name=Lucky;msg-param-recipient-id=43;msg-param-sub-plan=1000;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			[]*etwitch.Event{{
+				Type:   etwitch.EventTypeViewerReceivedGiftSub,
+				Viewer: &core.Viewer{TwitchUserId: "43", TwitchDisplayName: "Lucky"},
+				Payload: &etwitch.Payload{
+					ViewerReceivedGiftSub: &etwitch.PayloadViewerReceivedGiftSub{CreditMultiplier: 1},
+				},
+			}},
+			"",
+		},
+		{
+			"anonymous gift bomb",
+			"@display-name=AnAnonymousGifter;id=1;login=ananonymousgifter;msg-id=submysterygift;msg-param-mass-gift-count=5;msg-param-sub-plan=1000;user-id=274598607 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			[]*etwitch.Event{{
+				Type: etwitch.EventTypeViewerGiftedSubs,
+				Payload: &etwitch.Payload{
+					ViewerGiftedSubs: &etwitch.PayloadViewerGiftedSubs{CreditMultiplier: 1, NumSubscriptions: 5},
+				},
+			}},
+			"",
+		},
+		{
+			"raid",
+			"@display-name=SomeStreamer;id=1;login=somestreamer;msg-id=raid;msg-param-viewerCount=15;user-id=123456 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			[]*etwitch.Event{{
+				Type:   etwitch.EventTypeViewerRaided,
+				Viewer: &core.Viewer{TwitchUserId: "123456", TwitchDisplayName: "SomeStreamer"},
+				Payload: &etwitch.Payload{
+					ViewerRaided: &etwitch.PayloadViewerRaided{NumRaiders: 15},
+				},
+			}},
+			"",
+		},
+		{
+			"announcement produces no events",
+			"@display-name=Someone;id=1;login=someone;msg-id=announcement;msg-param-color=PRIMARY;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr :hello everyone",
+			nil,
+			"",
+		},
+		{
+			"unrecognized sub plan",
+			"@display-name=Someone;id=1;login=someone;msg-id=sub;msg-param-sub-plan=9000;user-id=42 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			nil,
+			"invalid value '9000' for extra attribute 'msg-param-sub-plan': unrecognized sub plan",
+		},
+		{
+			"raid with no viewer count",
+			"@display-name=SomeStreamer;id=1;login=somestreamer;msg-id=raid;user-id=123456 :tmi.twitch.tv USERNOTICE #goldenvcr",
+			nil,
+			"missing extra attribute 'msg-param-viewerCount'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			un, err := ParseUsernotice(mustParseMessage(t, tt.s))
+			assert.NoError(t, err)
+			got, err := twitchEventsFromUsernotice(un)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package wsline
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout is how long we'll wait to send a close frame when closing the
+// connection, before closing the underlying connection regardless
+const closeTimeout = time.Second
+
+// NewConn wraps the given WebSocket connection in a net.Conn that reads and writes
+// '\n'-terminated lines of text
+func NewConn(ws *websocket.Conn) net.Conn {
+	return &conn{ws: ws}
+}
+
+type conn struct {
+	ws *websocket.Conn
+
+	pending []byte
+	readMu  sync.Mutex
+
+	writeMu sync.Mutex
+	closed  atomic.Bool
+}
+
+// Read reads from the current text frame, receiving the next frame once the current
+// one has been consumed. If a frame doesn't end in a newline, a newline is added, so
+// that frames never run together into a single line.
+func (c *conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.pending) == 0 {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if c.closed.Load() {
+				return 0, net.ErrClosed
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		c.pending = data
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends each line in p (including its terminating newline, if any) as a
+// separate text frame
+func (c *conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+	written := 0
+	for written < len(p) {
+		line := p[written:]
+		if newlinePos := bytes.IndexByte(line, '\n'); newlinePos >= 0 {
+			line = line[:newlinePos+1]
+		}
+		if err := c.ws.WriteMessage(websocket.TextMessage, line); err != nil {
+			return written, err
+		}
+		written += len(line)
+	}
+	return written, nil
+}
+
+// Close makes a best-effort attempt to send a close frame, then closes the underlying
+// connection. Any blocked or subsequent reads and writes will fail with net.ErrClosed.
+func (c *conn) Close() error {
+	if c.closed.Swap(true) {
+		return net.ErrClosed
+	}
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+
+	err := c.ws.Close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
@@ -0,0 +1,69 @@
+package wsline
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Conn(t *testing.T) {
+	// Run a WebSocket server that greets each client with a frame containing two
+	// lines and a frame with no trailing newline, then echoes every frame it receives
+	// along with a count of the frames received so far
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.WriteMessage(websocket.TextMessage, []byte("first\r\nsecond\r\n"))
+		ws.WriteMessage(websocket.TextMessage, []byte("third"))
+		numFrames := 0
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			numFrames++
+			echo := strings.TrimRight(string(data), "\r\n") + " " + strings.Repeat("+", numFrames)
+			ws.WriteMessage(websocket.TextMessage, []byte(echo))
+		}
+	}))
+	defer srv.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	assert.NoError(t, err)
+	c := NewConn(ws)
+	reader := bufio.NewReader(c)
+	readLine := func() string {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		return line
+	}
+
+	// Each received frame should be read as a series of complete lines
+	assert.Equal(t, "first\r\n", readLine())
+	assert.Equal(t, "second\r\n", readLine())
+	assert.Equal(t, "third\n", readLine())
+
+	// Each line written should be sent as its own frame
+	n, err := c.Write([]byte("PING\nPONG\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, "PING +\n", readLine())
+	assert.Equal(t, "PONG ++\n", readLine())
+
+	// Once closed, the connection should report that it's closed
+	assert.NoError(t, c.Close())
+	_, err = c.Write([]byte("PING\n"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
@@ -0,0 +1,5 @@
+// Package wsline adapts a WebSocket connection that carries line-oriented text, such
+// as Twitch's IRC-over-WebSocket endpoint, so that it can be used as a net.Conn: each
+// text frame received is read as one or more '\n'-terminated lines, and each line
+// written is sent as its own text frame.
+package wsline
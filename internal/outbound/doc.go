@@ -0,0 +1,4 @@
+// Package outbound implements the queue through which the bot sends its own chat
+// messages, ensuring that we stay within Twitch's rate limits and that important
+// messages are sent before unimportant ones
+package outbound
@@ -0,0 +1,71 @@
+package outbound
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// duplicateWindow is the period during which Twitch will reject a message that's
+// identical to the previous message sent by the same user
+const duplicateWindow = 30 * time.Second
+
+// variationSuffix is appended to a message to make it distinct from an otherwise
+// identical message: Twitch accepts it, and chat clients don't render it
+const variationSuffix = " \U000E0000"
+
+// DuplicatePolicy determines what the queue does with a message whose text is
+// identical to the last message the bot sent to the channel, which Twitch would
+// reject if it were sent again within 30 seconds
+type DuplicatePolicy int
+
+const (
+	// DuplicatesVary sends the message with an invisible suffix, so that Twitch
+	// accepts it as a distinct message
+	DuplicatesVary DuplicatePolicy = iota
+	// DuplicatesCoalesce doesn't send the message at all: if an identical message is
+	// already queued, the two are sent as one, and if an identical message was just
+	// sent, that message is taken to serve for both. Messages are only identical if
+	// they reply to the same chat message (if any): otherwise one of the parent
+	// messages would go unanswered, so the message is varied instead.
+	DuplicatesCoalesce
+	// DuplicatesAllow sends the message unmodified, even if Twitch will reject it
+	DuplicatesAllow
+)
+
+// lastSent records the last message delivered to the channel
+type lastSent struct {
+	wireText string
+	text     string
+	replyTo  string
+	at       time.Time
+}
+
+// isDuplicate returns true if the given wire text would be rejected by Twitch as a
+// repeat of the last message
+func (l *lastSent) isDuplicate(wireText string, now time.Time) bool {
+	return l.wireText == wireText && now.Sub(l.at) < duplicateWindow
+}
+
+// resolveDuplicate applies the message's DuplicatePolicy in light of the last message
+// sent to the channel. It returns false if the message should not be sent, having been
+// coalesced with the last message; otherwise it updates the message (varying it if
+// needed) and returns true.
+func (l *lastSent) resolveDuplicate(m *Message, now time.Time) bool {
+	m.varied = false
+	switch m.Duplicates {
+	case DuplicatesCoalesce:
+		if l.text == m.Text && l.replyTo == m.replyTo() && now.Sub(l.at) < duplicateWindow {
+			return false
+		}
+		fallthrough
+	case DuplicatesVary:
+		// Messages at the length limit can't be varied, so they're sent as-is
+		if l.isDuplicate(m.WireText(), now) {
+			m.varied = true
+			if utf8.RuneCountInString(m.WireText()) > MaxMessageLength {
+				m.varied = false
+			}
+		}
+	}
+	return true
+}
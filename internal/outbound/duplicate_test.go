@@ -0,0 +1,191 @@
+package outbound
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lastSent_resolveDuplicate(t *testing.T) {
+	now := time.Now()
+	long := strings.Repeat("x", MaxMessageLength)
+	tests := []struct {
+		name     string
+		last     lastSent
+		message  Message
+		wantSend bool
+		wantWire string
+	}{
+		{
+			"new message is sent as-is",
+			lastSent{wireText: "hello", text: "hello", at: now},
+			Message{Text: "goodbye"},
+			true,
+			"goodbye",
+		},
+		{
+			"duplicate is varied",
+			lastSent{wireText: "hello", text: "hello", at: now},
+			Message{Text: "hello"},
+			true,
+			"hello" + variationSuffix,
+		},
+		{
+			"duplicate of a varied message is sent as-is",
+			lastSent{wireText: "hello" + variationSuffix, text: "hello", at: now},
+			Message{Text: "hello"},
+			true,
+			"hello",
+		},
+		{
+			"duplicate outside the window is sent as-is",
+			lastSent{wireText: "hello", text: "hello", at: now.Add(-duplicateWindow)},
+			Message{Text: "hello"},
+			true,
+			"hello",
+		},
+		{
+			"duplicate at the length limit is sent as-is",
+			lastSent{wireText: long, text: long, at: now},
+			Message{Text: long},
+			true,
+			long,
+		},
+		{
+			"duplicate is coalesced",
+			lastSent{wireText: "hello" + variationSuffix, text: "hello", at: now},
+			Message{Text: "hello", Duplicates: DuplicatesCoalesce},
+			false,
+			"hello",
+		},
+		{
+			"duplicate in reply to the same message is coalesced",
+			lastSent{wireText: "hello", text: "hello", replyTo: "1", at: now},
+			Message{Text: "hello", Duplicates: DuplicatesCoalesce, ReplyParent: &ReplyParent{MessageId: "1"}},
+			false,
+			"hello",
+		},
+		{
+			"duplicate in reply to a different message is varied",
+			lastSent{wireText: "hello", text: "hello", replyTo: "1", at: now},
+			Message{Text: "hello", Duplicates: DuplicatesCoalesce, ReplyParent: &ReplyParent{MessageId: "2"}},
+			true,
+			"hello" + variationSuffix,
+		},
+		{
+			"duplicate outside the window is not coalesced",
+			lastSent{wireText: "hello", text: "hello", at: now.Add(-duplicateWindow)},
+			Message{Text: "hello", Duplicates: DuplicatesCoalesce},
+			true,
+			"hello",
+		},
+		{
+			"duplicate is allowed",
+			lastSent{wireText: "hello", text: "hello", at: now},
+			Message{Text: "hello", Duplicates: DuplicatesAllow},
+			true,
+			"hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.message
+			assert.Equal(t, tt.wantSend, tt.last.resolveDuplicate(&m, now))
+			assert.Equal(t, tt.wantWire, m.WireText())
+			assert.Equal(t, tt.message.Text, m.Text)
+		})
+	}
+}
+
+func Test_Queue_duplicates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newBlockingSender()
+	var wireTexts []string
+	var mu sync.Mutex
+	q := NewQueue(ctx, func(m Message) error {
+		mu.Lock()
+		wireTexts = append(wireTexts, m.WireText())
+		mu.Unlock()
+		return s.send(m)
+	}, 8).(*queue)
+
+	var wg sync.WaitGroup
+	sendAsync := func(m Message, numPending int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, q.Send(ctx, PriorityNormal, m))
+		}()
+		waitForPending(t, q, numPending)
+	}
+
+	// While the first message is in flight, an identical message that can be coalesced
+	// is queued, followed by another identical message that's coalesced with it
+	sendAsync(Message{Text: "static", Duplicates: DuplicatesCoalesce}, 0)
+	<-s.started
+	sendAsync(Message{Text: "static", Duplicates: DuplicatesCoalesce}, 1)
+	sendAsync(Message{Text: "static", Duplicates: DuplicatesCoalesce}, 1)
+
+	// Messages that should be varied are sent even if they repeat the last message
+	sendAsync(Message{Text: "dynamic"}, 2)
+	sendAsync(Message{Text: "dynamic"}, 3)
+	close(s.release)
+	wg.Wait()
+
+	// The queued 'static' messages should be resolved without being sent, since an
+	// identical message was just delivered
+	assert.Equal(t, []string{"static", "dynamic", "dynamic"}, s.getSent())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"static", "dynamic", "dynamic" + variationSuffix}, wireTexts)
+}
+
+func Test_Queue_duplicateReplies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newBlockingSender()
+	var replyTos []string
+	var mu sync.Mutex
+	q := NewQueue(ctx, func(m Message) error {
+		mu.Lock()
+		replyTos = append(replyTos, m.ReplyParent.MessageId)
+		mu.Unlock()
+		return s.send(m)
+	}, 8).(*queue)
+
+	var wg sync.WaitGroup
+	sendAsync := func(m Message, numPending int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, q.Send(ctx, PriorityNormal, m))
+		}()
+		waitForPending(t, q, numPending)
+	}
+	reply := func(messageId string) Message {
+		return Message{Text: "static", Duplicates: DuplicatesCoalesce, ReplyParent: &ReplyParent{MessageId: messageId}}
+	}
+
+	// While a reply to one user is in flight, identical replies to two other users are
+	// queued: each of them should get its own reply, but a repeated reply to the same
+	// message is still coalesced
+	sendAsync(reply("1"), 0)
+	<-s.started
+	sendAsync(reply("2"), 1)
+	sendAsync(reply("3"), 2)
+	sendAsync(reply("3"), 2)
+	close(s.release)
+	wg.Wait()
+
+	assert.Equal(t, []string{"static", "static", "static"}, s.getSent())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"1", "2", "3"}, replyTos)
+}
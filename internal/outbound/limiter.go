@@ -0,0 +1,104 @@
+package outbound
+
+import "time"
+
+// rateLimitWindow is the period over which Twitch enforces its message rate limits
+const rateLimitWindow = 30 * time.Second
+
+// Twitch allows a regular user to send 20 messages per 30 seconds, and allows a user
+// to send 100 messages per 30 seconds in any channel where they're a moderator (or the
+// broadcaster)
+const (
+	messageLimitUser      = 20
+	messageLimitModerator = 100
+)
+
+// limiter is a token bucket that tells us when it's safe to send another message. A
+// token bucket that's allowed to burst up to its full limit could send almost twice
+// that many messages within a single window, so we only allow a quarter of the limit
+// to be used in a burst, and we refill at a rate that ensures that the burst plus the
+// refill can never exceed the limit in any given window.
+//
+// limiter also enforces slow mode, which requires non-moderators to wait a set
+// interval between messages. limiter is not safe for concurrent use.
+type limiter struct {
+	isModerator bool
+	slowMode    time.Duration
+
+	tokens     float64
+	lastRefill time.Time
+	lastTake   time.Time
+}
+
+// newLimiter returns a limiter for a non-moderator, with a full bucket
+func newLimiter() *limiter {
+	l := &limiter{}
+	l.tokens = l.burst()
+	return l
+}
+
+// burst returns the maximum number of tokens the bucket can hold
+func (l *limiter) burst() float64 {
+	return float64(l.limit()) / 4
+}
+
+// rate returns the number of tokens that are added to the bucket per second
+func (l *limiter) rate() float64 {
+	return (float64(l.limit()) - l.burst()) / rateLimitWindow.Seconds()
+}
+
+// limit returns the number of messages we may send per rateLimitWindow
+func (l *limiter) limit() int {
+	if l.isModerator {
+		return messageLimitModerator
+	}
+	return messageLimitUser
+}
+
+// setModerator updates the limiter to reflect whether we have moderator privileges in
+// the channel, which grants us a higher rate limit and exempts us from slow mode
+func (l *limiter) setModerator(isModerator bool, now time.Time) {
+	l.refill(now)
+	l.isModerator = isModerator
+	l.tokens = min(l.tokens, l.burst())
+}
+
+// setSlowMode updates the minimum interval that we must wait between messages as a
+// non-moderator; 0 indicates that slow mode is disabled
+func (l *limiter) setSlowMode(d time.Duration) {
+	l.slowMode = d
+}
+
+// refill adds tokens to the bucket based on the time elapsed since the last refill
+func (l *limiter) refill(now time.Time) {
+	if !l.lastRefill.IsZero() && now.After(l.lastRefill) {
+		elapsed := now.Sub(l.lastRefill).Seconds()
+		l.tokens = min(l.tokens+elapsed*l.rate(), l.burst())
+	}
+	l.lastRefill = now
+}
+
+// wait returns how long we need to wait, as of now, before we may send a message
+func (l *limiter) wait(now time.Time) time.Duration {
+	l.refill(now)
+
+	// If we don't have a full token available, compute how long until we will
+	d := time.Duration(0)
+	if l.tokens < 1 {
+		d = time.Duration((1 - l.tokens) / l.rate() * float64(time.Second))
+	}
+
+	// If slow mode applies to us, we also need to wait until the slow mode interval
+	// has elapsed since our last message
+	if !l.isModerator && l.slowMode > 0 && !l.lastTake.IsZero() {
+		d = max(d, l.lastTake.Add(l.slowMode).Sub(now))
+	}
+	return d
+}
+
+// take consumes a token to account for a message being sent at the given time
+func (l *limiter) take(now time.Time) {
+	l.refill(now)
+	l.tokens--
+	l.lastTake = now
+}
@@ -0,0 +1,73 @@
+package outbound
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_limiter(t *testing.T) {
+	t0 := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	// A fresh limiter should allow a burst of 5 messages with no waiting
+	l := newLimiter()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, time.Duration(0), l.wait(t0))
+		l.take(t0)
+	}
+
+	// After that, we refill at 15 messages per 30 seconds, i.e. 1 message every 2
+	// seconds
+	assert.Equal(t, 2*time.Second, l.wait(t0))
+	assert.Equal(t, time.Second, l.wait(t0.Add(time.Second)))
+	assert.Equal(t, time.Duration(0), l.wait(t0.Add(2*time.Second)))
+	l.take(t0.Add(2 * time.Second))
+
+	// In slow mode, we need to wait the slow interval after our last message
+	l.setSlowMode(10 * time.Second)
+	assert.Equal(t, 10*time.Second, l.wait(t0.Add(2*time.Second)))
+	assert.Equal(t, 5*time.Second, l.wait(t0.Add(7*time.Second)))
+
+	// Moderators are exempt from slow mode, but the bucket is not refilled just by
+	// becoming a moderator
+	l.setModerator(true, t0.Add(7*time.Second))
+	assert.Equal(t, time.Duration(0), l.wait(t0.Add(7*time.Second)))
+	l.take(t0.Add(7 * time.Second))
+	l.take(t0.Add(7 * time.Second))
+	assert.Greater(t, l.wait(t0.Add(7*time.Second)), time.Duration(0))
+
+	// As moderators, we refill at 75 messages per 30 seconds and can burst up to 25
+	assert.Equal(t, time.Duration(0), l.wait(t0.Add(37*time.Second)))
+	assert.Equal(t, 25.0, l.tokens)
+
+	// Losing moderator status caps our bucket at the lower burst size
+	l.setModerator(false, t0.Add(37*time.Second))
+	assert.Equal(t, 5.0, l.tokens)
+}
+
+func Test_limiter_neverExceedsLimit(t *testing.T) {
+	for _, isModerator := range []bool{false, true} {
+		l := newLimiter()
+		l.setModerator(isModerator, time.Time{})
+		l.tokens = l.burst()
+
+		// Send messages as fast as the limiter allows for several windows, then count
+		// how many messages fall within each sliding window
+		now := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+		end := now.Add(5 * rateLimitWindow)
+		sent := make([]time.Time, 0)
+		for now.Before(end) {
+			now = now.Add(l.wait(now))
+			l.take(now)
+			sent = append(sent, now)
+		}
+		for i := range sent {
+			numInWindow := 0
+			for j := i; j < len(sent) && sent[j].Sub(sent[i]) < rateLimitWindow; j++ {
+				numInWindow++
+			}
+			assert.LessOrEqual(t, numInWindow, l.limit())
+		}
+	}
+}
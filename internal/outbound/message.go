@@ -0,0 +1,87 @@
+package outbound
+
+// Kind identifies how a message is presented in chat
+type Kind int
+
+const (
+	// KindMessage is an ordinary chat message
+	KindMessage Kind = iota
+	// KindAction is an action message, as sent with '/me', which Twitch renders in the
+	// bot's color
+	KindAction
+	// KindAnnouncement is an announcement, which Twitch highlights at the top of chat;
+	// announcements are sent via the Twitch API rather than IRC
+	KindAnnouncement
+)
+
+// Message is a single chat message to be sent by the bot
+type Message struct {
+	// Text is the body of the message
+	Text string
+
+	// Kind determines how the message is sent and presented in chat
+	Kind Kind
+
+	// Color, for announcements, is the accent color used to highlight the
+	// announcement ('blue', 'green', 'orange', or 'purple'); if empty, the channel's
+	// accent color is used
+	Color string
+
+	// ReplyParent, if set, identifies the chat message that this message is in reply
+	// to, so that Twitch will render it as a threaded reply
+	ReplyParent *ReplyParent
+
+	// Duplicates determines what happens if the message is identical to the last
+	// message the bot sent to the channel
+	Duplicates DuplicatePolicy
+
+	// varied is set by the queue if the message must be altered (invisibly) in order
+	// for Twitch to accept it
+	varied bool
+}
+
+// replyTo returns the ID of the chat message that this message is in reply to, or an
+// empty string if it's not a reply
+func (m Message) replyTo() string {
+	if m.ReplyParent == nil {
+		return ""
+	}
+	return m.ReplyParent.MessageId
+}
+
+// ReplyParent describes a chat message that the bot is replying to
+type ReplyParent struct {
+	// MessageId is the Twitch-assigned ID of the parent message; it's sent to Twitch as
+	// the 'reply-parent-msg-id' tag
+	MessageId string
+
+	// UserId is the Twitch user ID of the user who sent the parent message
+	UserId string
+
+	// Username is the display name of the user who sent the parent message
+	Username string
+
+	// Text is the body of the parent message
+	Text string
+}
+
+// actionPrefix and actionSuffix enclose the text of an action message, which is sent
+// to Twitch as a CTCP ACTION
+const (
+	actionPrefix = "\x01ACTION "
+	actionSuffix = "\x01"
+)
+
+// WireText returns the text that should actually be sent to Twitch for the message,
+// which may differ from Text if the message is an action, or if it's been varied to
+// avoid being rejected as a duplicate
+func (m Message) WireText() string {
+	text := m.Text
+	if m.varied {
+		text += variationSuffix
+	}
+	if m.Kind == KindAction {
+		text = actionPrefix + text + actionSuffix
+	}
+	return text
+}
@@ -0,0 +1,336 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned when a message can't be queued because the queue is
+// already full of messages with equal or higher priority
+var ErrQueueFull = errors.New("outbound message queue is full")
+
+// ErrDropped is returned when a queued message is evicted from the queue in order to
+// make room for a message with higher priority
+var ErrDropped = errors.New("outbound message was dropped in favor of a higher-priority message")
+
+// ErrClosed is returned when a message can't be sent because the queue has been shut
+// down
+var ErrClosed = errors.New("outbound message queue is closed")
+
+// ErrDeliveryUnconfirmed is returned from a SendFunc when a message was sent, but the
+// server never confirmed (or rejected) it: the message was most likely delivered, so
+// it's not retried, but callers can't be certain that it appeared in chat
+var ErrDeliveryUnconfirmed = errors.New("outbound message was sent, but its delivery was not confirmed")
+
+// Retryable is implemented by errors returned from a SendFunc that indicate whether
+// the message might be delivered if it's sent again after a delay. Messages that fail
+// with any other error are not retried.
+type Retryable interface {
+	RetryAfter() (time.Duration, bool)
+}
+
+// maxDeliveryAttempts is the number of times the queue will try to send a message
+// that fails with a retryable error before giving up on it
+const maxDeliveryAttempts = 3
+
+// Priority determines the order in which queued messages are sent: all queued
+// messages of a higher priority are sent before any message of lower priority
+type Priority int
+
+const (
+	// PriorityLow is for messages that are nice to have but unimportant, such as
+	// replies to purely informational or joke commands
+	PriorityLow Priority = iota
+	// PriorityNormal is for typical replies to commands
+	PriorityNormal
+	// PriorityHigh is for error messages and moderation-related messages
+	PriorityHigh
+)
+
+// SendFunc is the function that the Queue calls to actually deliver a message, once
+// rate limits permit it to be sent
+type SendFunc func(m Message) error
+
+// Queue accepts outbound chat messages and delivers them as quickly as rate limits
+// allow, in priority order
+type Queue interface {
+	// Send queues a message, then blocks until the message has been delivered, it's
+	// been dropped from the queue, or ctx is canceled. The returned error indicates the
+	// outcome of the delivery. If ctx is canceled, the message may still be delivered.
+	Send(ctx context.Context, priority Priority, m Message) error
+
+	// SetModerator updates the queue's rate limits to reflect whether the bot has
+	// moderator privileges in the channel, per the USERSTATE message
+	SetModerator(isModerator bool)
+
+	// SetSlowMode updates the queue's rate limits to reflect whether the channel is in
+	// slow mode, per the ROOMSTATE message: 0 indicates that slow mode is off
+	SetSlowMode(d time.Duration)
+}
+
+// NewQueue initializes a Queue that will deliver messages via the given SendFunc, and
+// that will hold up to capacity messages at once. Once ctx is canceled, the queue
+// stops sending and all pending messages fail with ErrClosed.
+func NewQueue(ctx context.Context, send SendFunc, capacity int) Queue {
+	if capacity < 1 {
+		panic("outbound.Queue capacity must be >= 1")
+	}
+	q := &queue{
+		send:     send,
+		capacity: capacity,
+		limiter:  newLimiter(),
+		notify:   make(chan struct{}, 1),
+	}
+	go q.run(ctx)
+	return q
+}
+
+// item is a single message awaiting delivery
+type item struct {
+	priority Priority
+	message  Message
+	result   chan error
+	attempts int
+
+	// coalesced holds identical messages that will be answered by this one
+	coalesced []*item
+}
+
+// resolve reports the outcome of delivering the item, and of any items coalesced with
+// it
+func (it *item) resolve(err error) {
+	it.result <- err
+	for _, other := range it.coalesced {
+		other.resolve(err)
+	}
+}
+
+type queue struct {
+	send     SendFunc
+	capacity int
+
+	limiter   *limiter
+	pending   []*item
+	holdUntil time.Time
+	last      lastSent
+	closed    bool
+	mu        sync.Mutex
+
+	notify chan struct{}
+}
+
+func (q *queue) Send(ctx context.Context, priority Priority, m Message) error {
+	it := &item{
+		priority: priority,
+		message:  m,
+		result:   make(chan error, 1),
+	}
+	if err := q.enqueue(it); err != nil {
+		return err
+	}
+	select {
+	case err := <-it.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *queue) SetModerator(isModerator bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limiter.setModerator(isModerator, time.Now())
+	q.wake()
+}
+
+func (q *queue) SetSlowMode(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limiter.setSlowMode(d)
+	q.wake()
+}
+
+// enqueue adds an item to the queue, evicting a lower-priority item if the queue is
+// full
+func (q *queue) enqueue(it *item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	// If an identical message is already queued and the new message may be coalesced,
+	// it will be delivered along with that message (at the higher of the two
+	// priorities)
+	if it.message.Duplicates == DuplicatesCoalesce {
+		for _, other := range q.pending {
+			if other.message.Text == it.message.Text && other.message.replyTo() == it.message.replyTo() {
+				other.coalesced = append(other.coalesced, it)
+				other.priority = max(other.priority, it.priority)
+				return nil
+			}
+		}
+	}
+
+	// If the queue is full, make room by dropping the oldest message with the lowest
+	// priority, provided that it's lower-priority than the new message
+	if len(q.pending) >= q.capacity {
+		victimIndex := -1
+		for i, other := range q.pending {
+			if other.priority < it.priority && (victimIndex < 0 || other.priority < q.pending[victimIndex].priority) {
+				victimIndex = i
+			}
+		}
+		if victimIndex < 0 {
+			return ErrQueueFull
+		}
+		q.pending[victimIndex].resolve(ErrDropped)
+		q.pending = append(q.pending[:victimIndex], q.pending[victimIndex+1:]...)
+	}
+
+	q.pending = append(q.pending, it)
+	q.wake()
+	return nil
+}
+
+// wake signals the run loop that it should reevaluate the state of the queue
+func (q *queue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next removes and returns the oldest of the highest-priority items in the queue, if
+// the queue is nonempty and the rate limit permits a message to be sent now.
+// Otherwise, it returns nil along with the amount of time to wait before checking
+// again, which is 0 if the queue is empty. Items that duplicate the last message sent
+// are handled per their DuplicatePolicy: coalesced items are resolved without being
+// sent.
+func (q *queue) next(now time.Time) (*item, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if len(q.pending) == 0 {
+			return nil, 0
+		}
+		if now.Before(q.holdUntil) {
+			return nil, q.holdUntil.Sub(now)
+		}
+
+		bestIndex := 0
+		for i, other := range q.pending {
+			if other.priority > q.pending[bestIndex].priority {
+				bestIndex = i
+			}
+		}
+		it := q.pending[bestIndex]
+		if !q.last.resolveDuplicate(&it.message, now) {
+			q.pending = append(q.pending[:bestIndex], q.pending[bestIndex+1:]...)
+			it.resolve(nil)
+			continue
+		}
+
+		if wait := q.limiter.wait(now); wait > 0 {
+			return nil, wait
+		}
+		q.pending = append(q.pending[:bestIndex], q.pending[bestIndex+1:]...)
+		q.limiter.take(now)
+		return it, 0
+	}
+}
+
+// recordSent notes that the given message was delivered, so that subsequent
+// duplicates can be detected
+func (q *queue) recordSent(m Message, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.last = lastSent{
+		wireText: m.WireText(),
+		text:     m.Text,
+		replyTo:  m.replyTo(),
+		at:       now,
+	}
+}
+
+// run delivers queued messages until ctx is canceled
+func (q *queue) run(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			q.close()
+			return
+		}
+
+		it, wait := q.next(time.Now())
+		if it != nil {
+			it.attempts++
+			err := q.send(it.message)
+			if err != nil && q.retry(it, err, time.Now()) {
+				continue
+			}
+			if err == nil || errors.Is(err, ErrDeliveryUnconfirmed) {
+				q.recordSent(it.message, time.Now())
+			}
+			it.resolve(err)
+			continue
+		}
+
+		// Nothing can be sent yet: sleep until we're woken up by a change to the
+		// queue, the rate limit will allow us to send again, or we're shut down
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timeout = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			q.close()
+			return
+		case <-q.notify:
+		case <-timeout:
+		}
+	}
+}
+
+// retry returns the given item to the front of the queue if it failed with a
+// retryable error and has attempts remaining, holding all messages until the retry
+// delay has elapsed, since Twitch's limits apply to the whole channel. It returns
+// false if the item should not be retried.
+func (q *queue) retry(it *item, err error, now time.Time) bool {
+	var retryable Retryable
+	if !errors.As(err, &retryable) || it.attempts >= maxDeliveryAttempts {
+		return false
+	}
+	delay, ok := retryable.RetryAfter()
+	if !ok {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	q.pending = append([]*item{it}, q.pending...)
+	q.holdUntil = now.Add(delay)
+	return true
+}
+
+// close fails all pending items and prevents any new items from being queued
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	for _, it := range q.pending {
+		it.resolve(ErrClosed)
+	}
+	q.pending = nil
+}
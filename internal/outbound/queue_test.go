@@ -0,0 +1,231 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingSender records the text of each message sent, and blocks on each send until
+// released
+type blockingSender struct {
+	sent    []string
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+}
+
+func newBlockingSender() *blockingSender {
+	return &blockingSender{
+		started: make(chan struct{}, 64),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *blockingSender) send(m Message) error {
+	s.started <- struct{}{}
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m.Text)
+	return nil
+}
+
+func (s *blockingSender) getSent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.sent...)
+}
+
+func waitForPending(t *testing.T, q *queue, n int) {
+	assert.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.pending) == n
+	}, time.Second, time.Millisecond)
+}
+
+func Test_Queue_priority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newBlockingSender()
+	q := NewQueue(ctx, s.send, 8).(*queue)
+
+	var wg sync.WaitGroup
+	sendAsync := func(priority Priority, text string, numPending int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := q.Send(ctx, priority, Message{Text: text})
+			assert.NoError(t, err)
+		}()
+		waitForPending(t, q, numPending)
+	}
+
+	// The first message is picked up immediately, and blocks in send; the rest wait
+	sendAsync(PriorityLow, "first", 0)
+	<-s.started
+	sendAsync(PriorityLow, "low", 1)
+	sendAsync(PriorityNormal, "normal", 2)
+	sendAsync(PriorityHigh, "high", 3)
+	sendAsync(PriorityNormal, "normal again", 4)
+	close(s.release)
+	wg.Wait()
+
+	assert.Equal(t, []string{"first", "high", "normal", "normal again", "low"}, s.getSent())
+}
+
+func Test_Queue_full(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newBlockingSender()
+	q := NewQueue(ctx, s.send, 2).(*queue)
+
+	results := make(map[string]error)
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	sendAsync := func(priority Priority, text string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := q.Send(ctx, priority, Message{Text: text})
+			resultsMu.Lock()
+			results[text] = err
+			resultsMu.Unlock()
+		}()
+	}
+
+	sendAsync(PriorityNormal, "in flight")
+	<-s.started
+	sendAsync(PriorityLow, "low 1")
+	waitForPending(t, q, 1)
+	sendAsync(PriorityLow, "low 2")
+	waitForPending(t, q, 2)
+
+	// A low-priority message can't displace anything when the queue is full
+	err := q.Send(ctx, PriorityLow, Message{Text: "low 3"})
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	// A higher-priority message displaces the oldest lowest-priority message
+	sendAsync(PriorityHigh, "high")
+	assert.Eventually(t, func() bool {
+		resultsMu.Lock()
+		defer resultsMu.Unlock()
+		return results["low 1"] != nil
+	}, time.Second, time.Millisecond)
+
+	close(s.release)
+	wg.Wait()
+	assert.Equal(t, map[string]error{
+		"in flight": nil,
+		"low 1":     ErrDropped,
+		"low 2":     nil,
+		"high":      nil,
+	}, results)
+	assert.Equal(t, []string{"in flight", "high", "low 2"}, s.getSent())
+}
+
+func Test_Queue_closed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := newBlockingSender()
+	q := NewQueue(ctx, s.send, 4).(*queue)
+
+	inFlightErr := make(chan error, 1)
+	go func() {
+		inFlightErr <- q.Send(context.Background(), PriorityNormal, Message{Text: "in flight"})
+	}()
+	<-s.started
+	pendingErr := make(chan error, 1)
+	go func() {
+		pendingErr <- q.Send(context.Background(), PriorityNormal, Message{Text: "pending"})
+	}()
+	waitForPending(t, q, 1)
+
+	// Once the queue is shut down, pending messages fail and new messages are rejected
+	cancel()
+	close(s.release)
+	assert.NoError(t, <-inFlightErr)
+	assert.ErrorIs(t, <-pendingErr, ErrClosed)
+	assert.Eventually(t, func() bool {
+		return q.Send(context.Background(), PriorityHigh, Message{Text: "too late"}) == ErrClosed
+	}, time.Second, time.Millisecond)
+}
+
+// retryableError is a delivery error that the queue may retry after the given delay
+type retryableError struct {
+	retry bool
+	delay time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return "delivery failed"
+}
+
+func (e *retryableError) RetryAfter() (time.Duration, bool) {
+	return e.delay, e.retry
+}
+
+func Test_Queue_retry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Each message fails with the given errors before it's delivered successfully
+	failures := map[string][]error{
+		"flaky":     {&retryableError{retry: true, delay: 20 * time.Millisecond}},
+		"fatal":     {&retryableError{retry: false}},
+		"permanent": {errors.New("no"), errors.New("no")},
+		"stubborn": {
+			&retryableError{retry: true},
+			&retryableError{retry: true},
+			&retryableError{retry: true},
+		},
+	}
+	var attempts []string
+	var mu sync.Mutex
+	q := NewQueue(ctx, func(m Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, m.Text)
+		if remaining := failures[m.Text]; len(remaining) > 0 {
+			failures[m.Text] = remaining[1:]
+			return remaining[0]
+		}
+		return nil
+	}, 8)
+	q.SetModerator(true)
+
+	// A retryable failure should be retried after the requested delay, and other
+	// messages should be held until then
+	start := time.Now()
+	flakyErr := make(chan error, 1)
+	go func() {
+		flakyErr <- q.Send(ctx, PriorityNormal, Message{Text: "flaky"})
+	}()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(attempts) == 1
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, q.Send(ctx, PriorityNormal, Message{Text: "next"}))
+	assert.NoError(t, <-flakyErr)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// Messages that fail with non-retryable errors should not be retried, and messages
+	// that keep failing should eventually be given up on
+	assert.Error(t, q.Send(ctx, PriorityNormal, Message{Text: "fatal"}))
+	assert.Error(t, q.Send(ctx, PriorityNormal, Message{Text: "permanent"}))
+	err := q.Send(ctx, PriorityNormal, Message{Text: "stubborn"})
+	var retryable *retryableError
+	assert.ErrorAs(t, err, &retryable)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"flaky", "flaky", "next", "fatal", "permanent", "stubborn", "stubborn", "stubborn"}, attempts)
+}
@@ -0,0 +1,99 @@
+package outbound
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxMessageLength is the maximum number of characters that Twitch will accept in a
+// single chat message: longer messages are silently dropped
+const MaxMessageLength = 500
+
+// Split breaks text into one or more chunks of no more than maxLength characters
+// each, so that each chunk can be sent as its own chat message. Text is only ever
+// split on whitespace, so words, emote names, and URLs are never broken up - unless
+// a single word is itself longer than maxLength, in which case it can't be sent intact
+// and is split between characters. Whitespace within each chunk is kept as-is, while
+// whitespace at the points where the text is split is dropped. Text that already fits
+// in a single message is returned unmodified.
+func Split(text string, maxLength int) []string {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return []string{text}
+	}
+
+	chunks := make([]string, 0)
+	var current strings.Builder
+	currentLength := 0
+	flush := func() {
+		if currentLength > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentLength = 0
+		}
+	}
+
+	for {
+		// Take the next word, along with the whitespace that separates it from the
+		// previous word
+		word := strings.TrimLeftFunc(text, unicode.IsSpace)
+		separator := text[:len(text)-len(word)]
+		if word == "" {
+			break
+		}
+		text = ""
+		if end := strings.IndexFunc(word, unicode.IsSpace); end >= 0 {
+			word, text = word[:end], word[end:]
+		}
+		wordLength := utf8.RuneCountInString(word)
+		separatorLength := utf8.RuneCountInString(separator)
+
+		// If the word fits on the current chunk, append it there
+		if currentLength > 0 && currentLength+separatorLength+wordLength <= maxLength {
+			current.WriteString(separator)
+			current.WriteString(word)
+			currentLength += separatorLength + wordLength
+			continue
+		}
+
+		// Otherwise, it needs to start a new chunk
+		flush()
+		for wordLength > maxLength {
+			head, tail := splitRunes(word, maxLength)
+			chunks = append(chunks, head)
+			word = tail
+			wordLength -= maxLength
+		}
+		current.WriteString(word)
+		currentLength = wordLength
+	}
+	flush()
+	return chunks
+}
+
+// SplitMessage breaks a message into one or more parts (per Split) whose text will
+// fit within MaxMessageLength once formatted for the wire
+func SplitMessage(m Message) []Message {
+	maxLength := MaxMessageLength
+	if m.Kind == KindAction {
+		maxLength -= utf8.RuneCountInString(actionPrefix + actionSuffix)
+	}
+	chunks := Split(m.Text, maxLength)
+	parts := make([]Message, 0, len(chunks))
+	for _, chunk := range chunks {
+		part := m
+		part.Text = chunk
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// splitRunes splits s after the first n runes
+func splitRunes(s string, n int) (string, string) {
+	offset := 0
+	for i := 0; i < n && offset < len(s); i++ {
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	return s[:offset], s[offset:]
+}
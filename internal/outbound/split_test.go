@@ -0,0 +1,107 @@
+package outbound
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Split(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		want      []string
+	}{
+		{
+			"short text is returned as-is",
+			"  hello  world ",
+			20,
+			[]string{"  hello  world "},
+		},
+		{
+			"empty text is returned as-is",
+			"",
+			20,
+			[]string{""},
+		},
+		{
+			"text at exactly the max length is not split",
+			"aaaa bbbb",
+			9,
+			[]string{"aaaa bbbb"},
+		},
+		{
+			"long text is split on word boundaries",
+			"the quick brown fox jumps over the lazy dog",
+			15,
+			[]string{"the quick brown", "fox jumps over", "the lazy dog"},
+		},
+		{
+			"whitespace between words is kept, except where the text is split",
+			"  the  quick\tbrown   fox\n",
+			12,
+			[]string{"the  quick", "brown   fox"},
+		},
+		{
+			"other kinds of whitespace are not rewritten",
+			"a\nb\u3000c dddd",
+			8,
+			[]string{"a\nb\u3000c", "dddd"},
+		},
+		{
+			"length is measured in characters, not bytes",
+			"ćwierć łódź żółw",
+			11,
+			[]string{"ćwierć łódź", "żółw"},
+		},
+		{
+			"emotes and urls are kept intact",
+			"watch https://goldenvcr.com/tapes/42 now prayerbear",
+			32,
+			[]string{"watch", "https://goldenvcr.com/tapes/42", "now prayerbear"},
+		},
+		{
+			"words longer than the max length are split between characters",
+			"a ééééééééé b",
+			4,
+			[]string{"a", "éééé", "éééé", "é b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.maxLength)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Split_maxMessageLength(t *testing.T) {
+	text := strings.Repeat("municipality ", 100)
+	chunks := Split(text, MaxMessageLength)
+	assert.Len(t, chunks, 3)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len([]rune(chunk)), MaxMessageLength)
+		assert.Equal(t, "municipality", strings.Fields(chunk)[0])
+	}
+	assert.Equal(t, strings.TrimSpace(text), strings.Join(chunks, " "))
+}
+
+func Test_SplitMessage(t *testing.T) {
+	// Each part of an action must leave room for the CTCP ACTION markers, and each
+	// part should retain the properties of the original message
+	m := Message{
+		Text:        strings.Repeat("municipality ", 100),
+		Kind:        KindAction,
+		ReplyParent: &ReplyParent{MessageId: "1"},
+	}
+	parts := SplitMessage(m)
+	assert.Len(t, parts, 3)
+	for _, part := range parts {
+		assert.LessOrEqual(t, len([]rune(part.WireText())), MaxMessageLength)
+		assert.True(t, strings.HasPrefix(part.WireText(), "\x01ACTION municipality"))
+		assert.Equal(t, KindAction, part.Kind)
+		assert.Equal(t, m.ReplyParent, part.ReplyParent)
+	}
+}
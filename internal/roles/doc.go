@@ -0,0 +1,4 @@
+// Package roles describes the roles that a Twitch chat user can hold in a channel
+// (broadcaster, moderator, VIP, subscriber, etc.), as derived from the chat badges
+// that Twitch attaches to their messages
+package roles
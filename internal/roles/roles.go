@@ -0,0 +1,159 @@
+package roles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Badge is a single chat badge, as listed in the 'badges' or 'badge-info' tag: e.g.
+// 'subscriber/12' is parsed as {Name: "subscriber", Version: "12"}
+type Badge struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HasBadge returns true if the given list of badges includes a badge with the given
+// name, regardless of version
+func HasBadge(badges []Badge, name string) bool {
+	_, ok := findBadge(badges, name)
+	return ok
+}
+
+// Role identifies a class of chat user
+type Role string
+
+const (
+	// RoleEveryone is held by all users
+	RoleEveryone Role = "everyone"
+	// RoleSubscriber is held by users who are subscribed to the channel, including
+	// founders
+	RoleSubscriber Role = "subscriber"
+	// RoleFounder is held by users who were among the channel's first subscribers
+	RoleFounder Role = "founder"
+	// RoleVIP is held by users whom the broadcaster has made a VIP
+	RoleVIP Role = "vip"
+	// RoleModerator is held by the channel's moderators
+	RoleModerator Role = "moderator"
+	// RoleBroadcaster is held only by the owner of the channel
+	RoleBroadcaster Role = "broadcaster"
+)
+
+// ParseRole parses the name of a role (e.g. 'moderator'), case-insensitively; an empty
+// string is parsed as RoleEveryone
+func ParseRole(s string) (Role, error) {
+	switch role := Role(strings.ToLower(strings.TrimSpace(s))); role {
+	case "":
+		return RoleEveryone, nil
+	case RoleEveryone, RoleSubscriber, RoleFounder, RoleVIP, RoleModerator, RoleBroadcaster:
+		return role, nil
+	}
+	return "", fmt.Errorf("unrecognized role '%s'", s)
+}
+
+// rank orders the roles that may be required in order to use a feature, such that a
+// user who holds a higher-ranked role is also permitted to do anything that requires
+// a lower-ranked role
+func (r Role) rank() int {
+	switch r {
+	case RoleSubscriber, RoleFounder:
+		return 1
+	case RoleVIP:
+		return 2
+	case RoleModerator:
+		return 3
+	case RoleBroadcaster:
+		return 4
+	}
+	return 0
+}
+
+// Set describes all the roles held by a single user in a channel
+type Set struct {
+	Broadcaster bool `json:"broadcaster,omitempty"`
+	Moderator   bool `json:"moderator,omitempty"`
+	VIP         bool `json:"vip,omitempty"`
+	Subscriber  bool `json:"subscriber,omitempty"`
+	Founder     bool `json:"founder,omitempty"`
+
+	// SubscriberMonths is the total number of months the user has been subscribed, if
+	// known; 0 if the user is not subscribed
+	SubscriberMonths int `json:"subscriberMonths,omitempty"`
+}
+
+// FromBadges resolves a user's roles from the 'badges' and 'badge-info' tags attached
+// to their messages
+func FromBadges(badges, badgeInfo []Badge) Set {
+	s := Set{
+		Broadcaster: HasBadge(badges, "broadcaster"),
+		Moderator:   HasBadge(badges, "moderator"),
+		VIP:         HasBadge(badges, "vip"),
+		Founder:     HasBadge(badges, "founder"),
+	}
+	s.Subscriber = s.Founder || HasBadge(badges, "subscriber")
+
+	// The badge version indicates the tier of badge displayed, whereas 'badge-info'
+	// carries the exact number of months; founders' months are listed under 'founder'
+	// rather than 'subscriber'
+	if s.Subscriber {
+		for _, name := range []string{"subscriber", "founder"} {
+			if info, ok := findBadge(badgeInfo, name); ok {
+				if months, err := strconv.Atoi(info.Version); err == nil {
+					s.SubscriberMonths = months
+					break
+				}
+			}
+		}
+	}
+	return s
+}
+
+// Has returns true if the set includes the given role
+func (s Set) Has(role Role) bool {
+	switch role {
+	case RoleEveryone:
+		return true
+	case RoleSubscriber:
+		return s.Subscriber
+	case RoleFounder:
+		return s.Founder
+	case RoleVIP:
+		return s.VIP
+	case RoleModerator:
+		return s.Moderator
+	case RoleBroadcaster:
+		return s.Broadcaster
+	}
+	return false
+}
+
+// AtLeast returns true if the set includes the given role or any role that outranks
+// it, in the order: everyone, subscriber, VIP, moderator, broadcaster. Founders are
+// subscribers, but RoleFounder is only satisfied by founders (or VIPs and above).
+func (s Set) AtLeast(role Role) bool {
+	if s.Has(role) {
+		return true
+	}
+	rank := 0
+	for _, held := range []Role{RoleSubscriber, RoleVIP, RoleModerator, RoleBroadcaster} {
+		if s.Has(held) {
+			rank = held.rank()
+		}
+	}
+	return rank > role.rank()
+}
+
+// CanModerate returns true if the user is able to perform moderator actions in the
+// channel, i.e. if they're a moderator or the broadcaster
+func (s Set) CanModerate() bool {
+	return s.Moderator || s.Broadcaster
+}
+
+func findBadge(badges []Badge, name string) (Badge, bool) {
+	for _, badge := range badges {
+		if badge.Name == name {
+			return badge, true
+		}
+	}
+	return Badge{}, false
+}
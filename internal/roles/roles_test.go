@@ -0,0 +1,115 @@
+package roles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FromBadges(t *testing.T) {
+	tests := []struct {
+		name      string
+		badges    []Badge
+		badgeInfo []Badge
+		want      Set
+	}{
+		{
+			"no badges",
+			nil,
+			nil,
+			Set{},
+		},
+		{
+			"broadcaster",
+			[]Badge{{"broadcaster", "1"}, {"subscriber", "3000"}},
+			[]Badge{{"subscriber", "26"}},
+			Set{Broadcaster: true, Subscriber: true, SubscriberMonths: 26},
+		},
+		{
+			"moderator subscribed for more months than the badge tier",
+			[]Badge{{"moderator", "1"}, {"subscriber", "12"}, {"bits", "100"}},
+			[]Badge{{"subscriber", "14"}},
+			Set{Moderator: true, Subscriber: true, SubscriberMonths: 14},
+		},
+		{
+			"vip with no subscription",
+			[]Badge{{"vip", "1"}, {"bits", "1000"}},
+			[]Badge{},
+			Set{VIP: true},
+		},
+		{
+			"founder",
+			[]Badge{{"founder", "0"}},
+			[]Badge{{"founder", "5"}},
+			Set{Subscriber: true, Founder: true, SubscriberMonths: 5},
+		},
+		{
+			"subscriber with missing badge info",
+			[]Badge{{"subscriber", "0"}},
+			nil,
+			Set{Subscriber: true},
+		},
+		{
+			"badge info for a lapsed subscription is ignored",
+			[]Badge{},
+			[]Badge{{"subscriber", "8"}},
+			Set{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromBadges(tt.badges, tt.badgeInfo)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Set_Has(t *testing.T) {
+	s := Set{Moderator: true, Subscriber: true, SubscriberMonths: 3}
+	assert.True(t, s.Has(RoleEveryone))
+	assert.True(t, s.Has(RoleSubscriber))
+	assert.True(t, s.Has(RoleModerator))
+	assert.False(t, s.Has(RoleFounder))
+	assert.False(t, s.Has(RoleVIP))
+	assert.False(t, s.Has(RoleBroadcaster))
+	assert.False(t, s.Has(Role("admin")))
+	assert.True(t, s.CanModerate())
+	assert.False(t, Set{VIP: true}.CanModerate())
+}
+
+func Test_Set_AtLeast(t *testing.T) {
+	tests := []struct {
+		name string
+		set  Set
+		want []Role
+	}{
+		{"everyone", Set{}, []Role{RoleEveryone}},
+		{"subscriber", Set{Subscriber: true}, []Role{RoleEveryone, RoleSubscriber}},
+		{"founder", Set{Subscriber: true, Founder: true}, []Role{RoleEveryone, RoleSubscriber, RoleFounder}},
+		{"vip", Set{VIP: true}, []Role{RoleEveryone, RoleSubscriber, RoleFounder, RoleVIP}},
+		{"moderator", Set{Moderator: true}, []Role{RoleEveryone, RoleSubscriber, RoleFounder, RoleVIP, RoleModerator}},
+		{"broadcaster", Set{Broadcaster: true}, []Role{RoleEveryone, RoleSubscriber, RoleFounder, RoleVIP, RoleModerator, RoleBroadcaster}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []Role{}
+			for _, role := range []Role{RoleEveryone, RoleSubscriber, RoleFounder, RoleVIP, RoleModerator, RoleBroadcaster} {
+				if tt.set.AtLeast(role) {
+					got = append(got, role)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ParseRole(t *testing.T) {
+	role, err := ParseRole("")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleEveryone, role)
+	role, err = ParseRole(" VIP ")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleVIP, role)
+	_, err = ParseRole("admin")
+	assert.EqualError(t, err, "unrecognized role 'admin'")
+}
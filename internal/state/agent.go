@@ -9,118 +9,484 @@ import (
 
 	"github.com/golden-vcr/auth"
 	"github.com/golden-vcr/chatbot"
+	"github.com/golden-vcr/chatbot/internal/commands"
 	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/tokens"
 	"github.com/golden-vcr/server-common/rmq"
+	"github.com/nicklaw5/helix/v2"
 	"golang.org/x/exp/slog"
 )
 
 type Agent interface {
+	// Disconnect gracefully shuts down the current bot (if any), waiting a short time
+	// for in-progress commands to finish, and closes its connection
 	Disconnect()
-	Reinitialize(userAccessToken string, timeout time.Duration) error
+	// Shutdown gracefully shuts down the current bot (if any), waiting until ctx is
+	// done for in-progress commands to finish, and closes its connection; the agent
+	// will not reconnect thereafter
+	Shutdown(ctx context.Context) error
+	Reinitialize(credentials *helix.AccessCredentials, timeout time.Duration) error
 	GetStatus() chatbot.Status
+	GetStatusDetails() chatbot.StatusDetails
+	// Say sends a message as the bot to the given channel (or to the bot's home
+	// channel, if empty), blocking until the message has been delivered or has failed
+	Say(ctx context.Context, channel string, m outbound.Message) error
 }
 
-func NewAgent(ctx context.Context, logger *slog.Logger, channelName, botUsername string, messagesChan chan<- *irc.Message, emitBotMessage func(string), authServiceClient auth.ServiceClient, twitchEventsProducer rmq.Producer) Agent {
+// ErrNotConnected is returned from Agent.Say if the bot isn't currently connected
+var ErrNotConnected = errors.New("chat bot is not connected")
+
+// ErrRefreshTokenRejected indicates that Twitch permanently rejected the bot's refresh
+// token (e.g. because access was revoked), so the bot can't reconnect until it's
+// authorized again
+var ErrRefreshTokenRejected = errors.New("refresh token was rejected")
+
+// CredentialsRefresher is the subset of Twitch API functionality that the agent needs
+// in order to obtain a fresh User Access Token when reconnecting the bot on its own: if
+// the refresh token is no longer valid, it should return an error that wraps
+// ErrRefreshTokenRejected
+type CredentialsRefresher interface {
+	RefreshCredentials(ctx context.Context, credentials *helix.AccessCredentials) (*helix.AccessCredentials, error)
+}
+
+// Announcer is the subset of Twitch API functionality that the bot needs in order to
+// send announcements, which aren't supported via IRC
+type Announcer interface {
+	SendAnnouncement(userAccessToken, broadcasterId, moderatorId, text, color string) error
+}
+
+// disconnectTimeout is how long Disconnect will wait for the bot to finish handling
+// any in-progress commands
+const disconnectTimeout = 5 * time.Second
+
+// tokenRefreshMargin is how long before our access token expires that we'll refresh
+// it in order to make API requests on the bot's behalf
+const tokenRefreshMargin = 5 * time.Minute
+
+func NewAgent(ctx context.Context, logger *slog.Logger, connOpts irc.ConnOpts, channels []irc.Channel, botUsername string, messagesChan chan<- *irc.Message, emitBotMessage func(channel string, m outbound.Message), authServiceClient auth.ServiceClient, twitchEventsProducer rmq.Producer, tokenStore tokens.Store, credentialsRefresher CredentialsRefresher, announcer Announcer, commandOpts commands.HandlerOpts) Agent {
+	// Every bot that the agent creates shares the same cooldowns, so that command
+	// cooldowns still apply after the bot is reinitialized
+	if commandOpts.Cooldowns == nil {
+		commandOpts.Cooldowns = commands.NewCooldowns(commands.CooldownConfig{})
+	}
 	return &agent{
 		rootCtx:              ctx,
+		connCtx:              context.WithoutCancel(ctx),
 		logger:               logger,
-		channelName:          channelName,
+		connOpts:             connOpts,
+		channels:             channels,
 		botUsername:          botUsername,
 		messagesChan:         messagesChan,
 		emitBotMessage:       emitBotMessage,
 		authServiceClient:    authServiceClient,
 		twitchEventsProducer: twitchEventsProducer,
+		tokenStore:           tokenStore,
+		credentialsRefresher: credentialsRefresher,
+		announcer:            announcer,
+		commandOpts:          commandOpts,
+		backoff:              defaultBackoff,
 	}
 }
 
 type agent struct {
 	rootCtx              context.Context
+	connCtx              context.Context
 	logger               *slog.Logger
-	channelName          string
+	connOpts             irc.ConnOpts
+	channels             []irc.Channel
 	botUsername          string
 	messagesChan         chan<- *irc.Message
-	emitBotMessage       func(string)
+	emitBotMessage       func(channel string, m outbound.Message)
 	authServiceClient    auth.ServiceClient
 	twitchEventsProducer rmq.Producer
+	tokenStore           tokens.Store
+	credentialsRefresher CredentialsRefresher
+	announcer            Announcer
+	backoff              backoff
+	commandOpts          commands.HandlerOpts
 
-	conn irc.Conn
-	bot  irc.Bot
-	mu   sync.RWMutex
+	// reinitializeMu ensures that only one call to Reinitialize can replace the
+	// current bot at a time
+	reinitializeMu sync.Mutex
+	// tokenMu ensures that only one API request at a time can refresh our credentials
+	tokenMu sync.Mutex
+
+	conn             irc.Conn
+	bot              irc.Bot
+	readyTimeout     time.Duration
+	stopSupervisor   context.CancelFunc
+	reconnectAttempt int
+	numReconnects    int
+	lastError        *chatbot.ErrorDetails
+	tokenExpiresAt   time.Time
+	mu               sync.RWMutex
 }
 
 func (a *agent) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		a.logger.Warn("Bot did not shut down cleanly", "error", err)
+	}
+}
+
+func (a *agent) Shutdown(ctx context.Context) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
 
-	if a.conn != nil {
-		a.conn.Close()
-		a.conn = nil
-		a.bot = nil
+	// Stop any supervisor goroutine first, so that closing the connection isn't
+	// mistaken for a failure that we need to recover from
+	if a.stopSupervisor != nil {
+		a.stopSupervisor()
+		a.stopSupervisor = nil
 	}
+	a.reconnectAttempt = 0
+
+	// Detach the current bot and connection, so that we don't hold the lock while
+	// waiting for the bot to shut down
+	conn, b := a.conn, a.bot
+	a.conn = nil
+	a.bot = nil
+	a.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	var err error
+	if b != nil {
+		err = b.Shutdown(ctx)
+	}
+	conn.Close()
+	return err
 }
 
-func (a *agent) Reinitialize(userAccessToken string, timeout time.Duration) error {
+func (a *agent) Reinitialize(credentials *helix.AccessCredentials, timeout time.Duration) error {
+	// Concurrent calls must not both install a bot, or the one installed first would be
+	// orphaned along with its supervisor
+	a.reinitializeMu.Lock()
+	defer a.reinitializeMu.Unlock()
+
 	a.Disconnect()
 
-	conn, err := irc.NewConn(a.rootCtx, irc.ConnOpts{
-		Logger: irc.NewStructuredLogger(a.logger),
-	})
+	conn, b, err := a.connect(a.rootCtx, credentials.AccessToken, timeout)
 	if err != nil {
+		a.recordError(err)
 		return err
 	}
-	b, err := irc.NewBot(a.rootCtx, conn, a.channelName, a.botUsername, userAccessToken, a.messagesChan, a.emitBotMessage, a.authServiceClient, a.twitchEventsProducer)
+
+	// If our bot successfully became ready, install it as the agent's new bot, and
+	// start supervising it so that we can recover if it fails
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.conn = conn
+	a.bot = b
+	a.readyTimeout = timeout
+	a.numReconnects = 0
+	a.setTokenExpiry(credentials)
+	supervisorCtx, stopSupervisor := context.WithCancel(a.rootCtx)
+	a.stopSupervisor = stopSupervisor
+	go a.supervise(supervisorCtx, b)
+	return nil
+}
+
+func (a *agent) GetStatus() chatbot.Status {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.reconnectAttempt > 0 {
+		return chatbot.StatusReconnecting
+	}
+	if a.bot == nil {
+		return chatbot.StatusDisconnected
+	}
+	return a.bot.GetStatus()
+}
+
+func (a *agent) Say(ctx context.Context, channel string, m outbound.Message) error {
+	if channel == "" {
+		channel = a.channels[0].Name
+	}
+	a.mu.RLock()
+	b := a.bot
+	a.mu.RUnlock()
+	if b == nil || b.GetStatus() != chatbot.StatusConnected {
+		return ErrNotConnected
+	}
+	return b.Say(ctx, channel, m)
+}
+
+func (a *agent) GetStatusDetails() chatbot.StatusDetails {
+	status := a.GetStatus()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	details := chatbot.StatusDetails{
+		Status:           status,
+		BotUsername:      a.botUsername,
+		LastError:        a.lastError,
+		ReconnectAttempt: a.reconnectAttempt,
+		NumReconnects:    a.numReconnects,
+		TokenExpiresAt:   optionalTime(a.tokenExpiresAt),
+	}
+	if a.bot != nil {
+		details.BotUserId = a.bot.GetUserId()
+		details.Channels = a.bot.GetChannelStatuses()
+		details.ConnectedSince = optionalTime(a.bot.GetConnectedSince())
+		details.LastPingTime = optionalTime(a.bot.GetLastPingTime())
+		details.LastPongTime = optionalTime(a.bot.GetLastPongTime())
+		details.LatencyMilliseconds = a.bot.GetLatency().Milliseconds()
+	} else {
+		details.Channels = make([]chatbot.ChannelStatus, 0, len(a.channels))
+		for _, channel := range a.channels {
+			details.Channels = append(details.Channels, chatbot.ChannelStatus{Name: channel.Name})
+		}
+	}
+	return details
+}
+
+// recordError notes the most recent error that caused the bot to fail or prevented it
+// from connecting, so that it can be reported in the bot's status
+func (a *agent) recordError(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastError = &chatbot.ErrorDetails{
+		Message: err.Error(),
+		Time:    time.Now(),
+	}
+}
+
+// setTokenExpiry notes when the given credentials will expire, if known; a.mu must be
+// held
+func (a *agent) setTokenExpiry(credentials *helix.AccessCredentials) {
+	a.tokenExpiresAt = time.Time{}
+	if credentials.ExpiresIn > 0 {
+		a.tokenExpiresAt = time.Now().Add(time.Duration(credentials.ExpiresIn) * time.Second)
+	}
+}
+
+// optionalTime returns a pointer to t, or nil if t is the zero time
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// connect opens a new IRC connection and initializes a bot on it, blocking (with a
+// timeout) until that bot is ready. If ctx is canceled during that time, the
+// connection is abandoned. Once ready, the connection outlives the agent's root
+// context, so that it can be shut down gracefully.
+func (a *agent) connect(ctx context.Context, userAccessToken string, timeout time.Duration) (irc.Conn, irc.Bot, error) {
+	conn, err := irc.NewConn(a.connCtx, a.connOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := irc.BotOpts{Logger: a.connOpts.Logger, Commands: a.commandOpts}
+	if a.announcer != nil {
+		// The connection may outlive the access token it was opened with, so each
+		// announcement uses our current credentials
+		opts.Announce = func(broadcasterId, moderatorId, text, color string) error {
+			accessToken, err := a.currentAccessToken(a.rootCtx)
+			if err != nil {
+				return err
+			}
+			return a.announcer.SendAnnouncement(accessToken, broadcasterId, moderatorId, text, color)
+		}
+	}
+	b, err := irc.NewBot(a.connCtx, conn, opts, a.channels, a.botUsername, userAccessToken, a.messagesChan, a.emitBotMessage, a.authServiceClient, a.twitchEventsProducer)
 	if err != nil {
 		conn.Close()
-		return err
+		return nil, nil, err
 	}
 
 	// Block (with a timeout) until the bot has successfully connected to the IRC
 	// server, authenticated, and joined the channel
-	ctx, cancel := context.WithTimeout(a.rootCtx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	ready := false
-	for !ready {
+	for {
 		select {
 		case <-ctx.Done():
 			// If our context is done, kill the connection (abandoning the bot) and
 			// return an error
 			conn.Close()
 			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-				return fmt.Errorf("bot failed to become ready after %0.2f seconds", timeout.Seconds())
+				return nil, nil, fmt.Errorf("bot failed to become ready after %0.2f seconds", timeout.Seconds())
 			}
-			return ctx.Err()
+			return nil, nil, ctx.Err()
+		case <-b.Done():
+			// If the bot has encountered an error, kill the connection (abandoning the
+			// bot) and abort with that error
+			conn.Close()
+			return nil, nil, b.GetLastError()
 		case <-time.After(10 * time.Millisecond):
-			// Periodically check the status of the bot: if it's encountered an error,
-			// kill the connection (abandoning the bot) and abort with that error
-			if err := b.GetLastError(); err != nil {
-				return err
-			}
-
-			// If the bot is ready now, break out of the loop and finish initializing
+			// Periodically check the status of the bot: if it's ready now, we're done
 			if b.GetStatus() == chatbot.StatusConnected {
-				ready = true
+				return conn, b, nil
 			}
 
 			// Otherwise, keep trying until we're ready, we hit an error, or the context
 			// is canceled
 		}
 	}
+}
 
-	// If our bot successfully became ready, install it as the agent's new bot and
-	// finish successfully
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	a.conn = conn
-	a.bot = b
-	return nil
+// supervise waits for the given bot to fail, then attempts to replace it with a new
+// bot on a fresh connection, retrying with exponential backoff until it succeeds or
+// ctx is canceled. A new bot installed in this way will be supervised in turn.
+func (a *agent) supervise(ctx context.Context, b irc.Bot) {
+	for {
+		// Block until the bot fails or we're told to stop supervising it
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.Done():
+		}
+		cause := b.GetLastError()
+		a.logger.Warn("IRC bot failed; attempting to reconnect", "error", cause)
+		a.recordError(cause)
+
+		// Tear down the old connection, and note that we're reconnecting
+		a.mu.Lock()
+		if ctx.Err() != nil {
+			a.mu.Unlock()
+			return
+		}
+		if a.conn != nil {
+			a.conn.Close()
+		}
+		a.conn = nil
+		a.bot = nil
+		a.reconnectAttempt = 1
+		timeout := a.readyTimeout
+		a.mu.Unlock()
+
+		// Keep trying to reconnect until we succeed
+		conn, newBot, err := a.reconnect(ctx, cause, timeout)
+		if err != nil {
+			a.logger.Error("Giving up on reconnecting IRC bot", "error", err)
+			a.mu.Lock()
+			if ctx.Err() == nil {
+				a.reconnectAttempt = 0
+				a.lastError = &chatbot.ErrorDetails{
+					Message: err.Error(),
+					Time:    time.Now(),
+				}
+			}
+			a.mu.Unlock()
+			return
+		}
+
+		// Install our new bot, then resume supervising it
+		a.mu.Lock()
+		if ctx.Err() != nil {
+			a.mu.Unlock()
+			conn.Close()
+			return
+		}
+		a.logger.Info("Reconnected IRC bot", "numAttempts", a.reconnectAttempt)
+		a.conn = conn
+		a.bot = newBot
+		a.reconnectAttempt = 0
+		a.numReconnects++
+		a.mu.Unlock()
+		b = newBot
+	}
 }
 
-func (a *agent) GetStatus() chatbot.Status {
+// reconnect makes repeated attempts to refresh our credentials and connect a new bot,
+// waiting for an exponentially-increasing (and jittered) delay between attempts. It
+// returns an error only if ctx is canceled or if reconnecting is futile.
+func (a *agent) reconnect(ctx context.Context, cause error, timeout time.Duration) (irc.Conn, irc.Bot, error) {
+	for attempt := 1; ; attempt++ {
+		a.mu.Lock()
+		if ctx.Err() == nil {
+			a.reconnectAttempt = attempt
+		}
+		a.mu.Unlock()
+
+		// If Twitch explicitly asked us to reconnect, the first attempt should be
+		// immediate; otherwise we back off before every attempt
+		delay := a.backoff.delay(attempt)
+		if attempt == 1 && errors.Is(cause, irc.ErrReceivedReconnect) {
+			delay = 0
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		// Our previous access token may have expired, so always refresh before
+		// reconnecting; if we have no valid refresh token, retrying is futile
+		a.tokenMu.Lock()
+		credentials, err := a.refreshCredentials(ctx)
+		a.tokenMu.Unlock()
+		if err != nil {
+			if errors.Is(err, errNoStoredCredentials) || errors.Is(err, ErrRefreshTokenRejected) {
+				return nil, nil, err
+			}
+			a.logger.Warn("Failed to refresh credentials for reconnect", "attempt", attempt, "error", err)
+			a.recordError(err)
+			continue
+		}
+
+		conn, b, err := a.connect(ctx, credentials.AccessToken, timeout)
+		if err != nil {
+			a.logger.Warn("Failed to reconnect IRC bot", "attempt", attempt, "error", err)
+			a.recordError(err)
+			continue
+		}
+		return conn, b, nil
+	}
+}
+
+// currentAccessToken returns a User Access Token with which to make API requests on the
+// bot's behalf: our stored token is used until it's about to expire, at which point
+// it's refreshed
+func (a *agent) currentAccessToken(ctx context.Context) (string, error) {
+	a.tokenMu.Lock()
+	defer a.tokenMu.Unlock()
+
 	a.mu.RLock()
-	defer a.mu.RUnlock()
+	expiresAt := a.tokenExpiresAt
+	a.mu.RUnlock()
+	if expiresAt.IsZero() || time.Until(expiresAt) > tokenRefreshMargin {
+		credentials, err := a.tokenStore.Load()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errNoStoredCredentials, err)
+		}
+		return credentials.AccessToken, nil
+	}
 
-	if a.bot == nil {
-		return chatbot.StatusDisconnected
+	credentials, err := a.refreshCredentials(ctx)
+	if err != nil {
+		return "", err
 	}
-	return a.bot.GetStatus()
+	return credentials.AccessToken, nil
+}
+
+// errNoStoredCredentials indicates that we have no refresh token with which to obtain
+// a new access token, e.g. because the bot has been logged out
+var errNoStoredCredentials = errors.New("no stored credentials")
+
+// refreshCredentials loads the bot's stored credentials, uses the refresh token to
+// obtain a new User Access Token, and stores the result for future use; a.tokenMu must
+// be held, since Twitch only accepts each refresh token once
+func (a *agent) refreshCredentials(ctx context.Context) (*helix.AccessCredentials, error) {
+	credentials, err := a.tokenStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoStoredCredentials, err)
+	}
+	credentials, err = a.credentialsRefresher.RefreshCredentials(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.tokenStore.Save(credentials); err != nil {
+		a.logger.Warn("Failed to store refreshed credentials", "error", err)
+	}
+	a.mu.Lock()
+	a.setTokenExpiry(credentials)
+	a.mu.Unlock()
+	return credentials, nil
 }
@@ -0,0 +1,414 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/chatbot"
+	"github.com/golden-vcr/chatbot/internal/chatlog"
+	"github.com/golden-vcr/chatbot/internal/commands"
+	"github.com/golden-vcr/chatbot/internal/irc"
+	"github.com/golden-vcr/chatbot/internal/irc/irctest"
+	"github.com/golden-vcr/chatbot/internal/outbound"
+	"github.com/golden-vcr/chatbot/internal/tokens"
+	"github.com/gorilla/mux"
+	"github.com/nicklaw5/helix/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+)
+
+func Test_Agent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Run a fake Twitch IRC server that only accepts our two known access tokens
+	srv, err := irctest.NewServer(irctest.ServerOpts{
+		AcceptToken: func(token string) bool {
+			return token == "access-1" || token == "access-2"
+		},
+	})
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	// Serve a chatlog from the messages received by the agent's bot, and start reading
+	// chatlog events over HTTP
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	messagesChan := make(chan *irc.Message)
+	chatlogServer := chatlog.NewServer(ctx, logger, []string{"goldenvcr"}, messagesChan, nil)
+	r := mux.NewRouter()
+	chatlogServer.RegisterRoutes(ctx, r)
+	httpServer := httptest.NewServer(r)
+	defer httpServer.Close()
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+	events := streamChatlog(t, streamCtx, httpServer.URL+"/chatlog")
+
+	// Initialize an agent that will connect to our fake server
+	tokenStore := tokens.NewStore(t.TempDir(), "TapeBoy")
+	err = tokenStore.Save(&helix.AccessCredentials{AccessToken: "access-1", RefreshToken: "refresh-1"})
+	assert.NoError(t, err)
+	refresher := &fakeRefresher{
+		credentials: &helix.AccessCredentials{AccessToken: "access-2", RefreshToken: "refresh-2"},
+	}
+	a := NewAgent(ctx, logger, irc.ConnOpts{Dial: srv.Dial, Logger: irc.NewStructuredLogger(logger, irc.LogPolicy{})}, []irc.Channel{{Name: "goldenvcr", Commands: []string{irc.AllCommands}}}, "TapeBoy", messagesChan, chatlogServer.EmitBotMessage, nil, nil, tokenStore, refresher, nil, commands.HandlerOpts{Cooldowns: commands.NewCooldowns(commands.CooldownConfig{Notify: true})}).(*agent)
+	assert.Equal(t, chatbot.StatusDisconnected, a.GetStatus())
+
+	// Connecting with our initial token should complete the handshake
+	err = a.Reinitialize(&helix.AccessCredentials{AccessToken: "access-1", ExpiresIn: 3600}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, chatbot.StatusConnected, a.GetStatus())
+	_, err = srv.WaitForSent(time.Second, "JOIN #goldenvcr")
+	assert.NoError(t, err)
+
+	// Our status details should describe the new connection
+	details := a.GetStatusDetails()
+	assert.Equal(t, chatbot.StatusConnected, details.Status)
+	assert.Equal(t, "1001686376", details.BotUserId)
+	assert.Equal(t, []chatbot.ChannelStatus{{Name: "goldenvcr", Joined: true}}, details.Channels)
+	assert.NotNil(t, details.ConnectedSince)
+	assert.NotNil(t, details.TokenExpiresAt)
+	assert.Equal(t, 0, details.NumReconnects)
+	assert.Nil(t, details.LastError)
+
+	// A chat message should appear in the chatlog
+	user := irctest.User{Id: "90790024", Login: "wasabimilkshake", Color: "#00FF7F"}
+	messageId := srv.SendPrivmsg("goldenvcr", user, "hello world")
+	ev := awaitChatlogEvent(t, events, func(ev *chatlog.Event) bool {
+		return ev.Type == chatlog.EventTypeAppend && ev.Payload.Append.MessageId == messageId
+	})
+	assert.Equal(t, "hello world", ev.Payload.Append.Text)
+	assert.Equal(t, "90790024", ev.Payload.Append.UserId)
+
+	// A command should elicit a threaded reply in chat, which should also appear in the
+	// chatlog along with the message it replies to
+	commandMessageId := srv.SendPrivmsg("goldenvcr", user, "!camera")
+	_, err = srv.WaitForSent(time.Second, fmt.Sprintf("@reply-parent-msg-id=%s PRIVMSG #goldenvcr :A camera is a device", commandMessageId))
+	assert.NoError(t, err)
+	ev = awaitChatlogEvent(t, events, func(ev *chatlog.Event) bool {
+		return ev.Type == chatlog.EventTypeAppend && ev.Payload.Append.UserId == "_BOT_"
+	})
+	assert.Equal(t, &chatlog.ReplyDetails{
+		MessageId: commandMessageId,
+		UserId:    "90790024",
+		Username:  "wasabimilkshake",
+		Text:      "!camera",
+	}, ev.Payload.Append.Reply)
+
+	// A moderator deleting a message should delete it from the chatlog
+	srv.SendClearmsg("goldenvcr", user.Login, messageId, "hello world")
+	awaitChatlogEvent(t, events, func(ev *chatlog.Event) bool {
+		return ev.Type == chatlog.EventTypeDelete && ev.Payload.Delete.MessageId == messageId
+	})
+
+	// If Twitch tells us to reconnect, the agent should refresh its credentials and
+	// reconnect on its own
+	srv.SendReconnect()
+	_, err = srv.WaitForSent(time.Second, "PASS oauth:access-2")
+	assert.NoError(t, err)
+	_, err = srv.WaitForSent(time.Second, "JOIN #goldenvcr")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return a.GetStatus() == chatbot.StatusConnected
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, srv.NumConnections())
+	credentials, err := tokenStore.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "access-2", credentials.AccessToken)
+	assert.Equal(t, 1, a.GetStatusDetails().NumReconnects)
+
+	// The new bot should be fully functional, and it should honor the cooldowns of
+	// commands invoked before the reconnect
+	commandMessageId = srv.SendPrivmsg("goldenvcr", user, "!camera")
+	_, err = srv.WaitForSent(time.Second, fmt.Sprintf("@reply-parent-msg-id=%s PRIVMSG #goldenvcr :!camera is on cooldown for ", commandMessageId))
+	assert.NoError(t, err)
+	commandMessageId = srv.SendPrivmsg("goldenvcr", user, "!youtube")
+	_, err = srv.WaitForSent(time.Second, fmt.Sprintf("@reply-parent-msg-id=%s PRIVMSG #goldenvcr :Watch VODs and clips on YouTube", commandMessageId))
+	assert.NoError(t, err)
+
+	// Messages sent on the broadcaster's behalf should be delivered to the home channel
+	// by default
+	err = a.Say(ctx, "", outbound.Message{Text: "hello from the broadcaster"})
+	assert.NoError(t, err)
+	_, err = srv.WaitForSent(time.Second, "PRIVMSG #goldenvcr :hello from the broadcaster")
+	assert.NoError(t, err)
+
+	// Once we explicitly disconnect, the bot should leave the channel and quit, and
+	// the agent should not try to reconnect
+	a.Disconnect()
+	assert.Equal(t, chatbot.StatusDisconnected, a.GetStatus())
+	_, err = srv.WaitForSent(time.Second, "PART #goldenvcr")
+	assert.NoError(t, err)
+	_, err = srv.WaitForSent(time.Second, "QUIT")
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, srv.NumConnections())
+	assert.ErrorIs(t, a.Say(ctx, "", outbound.Message{Text: "hello?"}), ErrNotConnected)
+}
+
+func Test_Agent_shutdownWithStalledChatlog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := irctest.NewServer(irctest.ServerOpts{})
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	// Serve a chatlog as the server does, so that events stop being streamed to clients
+	// once our root context is canceled
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	messagesChan := make(chan *irc.Message)
+	chatlogServer := chatlog.NewServer(ctx, logger, []string{"goldenvcr"}, messagesChan, nil)
+	chatlogServer.RegisterRoutes(ctx, mux.NewRouter())
+	tokenStore := tokens.NewStore(t.TempDir(), "TapeBoy")
+	a := NewAgent(ctx, logger, irc.ConnOpts{Dial: srv.Dial, Logger: irc.NewStructuredLogger(logger, irc.LogPolicy{})}, []irc.Channel{{Name: "goldenvcr"}}, "TapeBoy", messagesChan, chatlogServer.EmitBotMessage, nil, nil, tokenStore, &fakeRefresher{}, nil, commands.HandlerOpts{})
+	err = a.Reinitialize(&helix.AccessCredentials{AccessToken: "access-1"}, time.Second)
+	assert.NoError(t, err)
+
+	// Once we begin shutting down, more messages may arrive than the chatlog can hold
+	// for its clients, but that shouldn't prevent the bot from shutting down
+	cancel()
+	user := irctest.User{Id: "90790024", Login: "wasabimilkshake"}
+	for i := 0; i < 64; i++ {
+		srv.SendPrivmsg("goldenvcr", user, fmt.Sprintf("message %d", i))
+	}
+	time.Sleep(50 * time.Millisecond)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	started := time.Now()
+	assert.NoError(t, a.Shutdown(shutdownCtx))
+	assert.Less(t, time.Since(started), time.Second)
+	_, err = srv.WaitForSent(time.Second, "QUIT")
+	assert.NoError(t, err)
+}
+
+func Test_Agent_concurrentReinitialize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := irctest.NewServer(irctest.ServerOpts{})
+	assert.NoError(t, err)
+	defer srv.Close()
+	a := newTestAgent(t, ctx, srv, &fakeRefresher{
+		credentials: &helix.AccessCredentials{AccessToken: "access-2", RefreshToken: "refresh-2"},
+	})
+
+	// Two simultaneous calls to Reinitialize should each replace the previous bot, so
+	// only a single bot remains
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, a.Reinitialize(&helix.AccessCredentials{AccessToken: "access-1"}, time.Second))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, chatbot.StatusConnected, a.GetStatus())
+	assert.Equal(t, 2, srv.NumConnections())
+
+	// If Twitch then tells us to reconnect, only that bot's supervisor should
+	// reconnect
+	srv.SendReconnect()
+	assert.Eventually(t, func() bool {
+		return a.GetStatus() == chatbot.StatusConnected && a.GetStatusDetails().NumReconnects == 1
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 3, srv.NumConnections())
+	a.Disconnect()
+}
+
+func Test_Agent_refreshTokenRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := irctest.NewServer(irctest.ServerOpts{})
+	assert.NoError(t, err)
+	defer srv.Close()
+	refresher := &fakeRefresher{
+		err: fmt.Errorf("%w: request to refresh user access token failed with status 400: Invalid refresh token", ErrRefreshTokenRejected),
+	}
+	a := newTestAgent(t, ctx, srv, refresher)
+	err = a.Reinitialize(&helix.AccessCredentials{AccessToken: "access-1"}, time.Second)
+	assert.NoError(t, err)
+
+	// If our refresh token is rejected, the agent should give up on reconnecting right
+	// away, and report why in its status
+	srv.SendReconnect()
+	assert.Eventually(t, func() bool {
+		return a.GetStatus() == chatbot.StatusDisconnected
+	}, time.Second, 5*time.Millisecond)
+	details := a.GetStatusDetails()
+	assert.Equal(t, 0, details.ReconnectAttempt)
+	assert.NotNil(t, details.LastError)
+	assert.Equal(t, "refresh token was rejected: request to refresh user access token failed with status 400: Invalid refresh token", details.LastError.Message)
+	assert.Equal(t, 1, refresher.calls)
+	assert.Equal(t, 1, srv.NumConnections())
+}
+
+func Test_Agent_announcementsUseCurrentToken(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := irctest.NewServer(irctest.ServerOpts{})
+	assert.NoError(t, err)
+	defer srv.Close()
+	refresher := &fakeRefresher{
+		credentials: &helix.AccessCredentials{AccessToken: "access-2", RefreshToken: "refresh-2", ExpiresIn: 3600},
+	}
+	a := newTestAgent(t, ctx, srv, refresher)
+	announcer := &fakeAnnouncer{}
+	a.announcer = announcer
+	err = a.Reinitialize(&helix.AccessCredentials{AccessToken: "access-1", ExpiresIn: 3600}, time.Second)
+	assert.NoError(t, err)
+	defer a.Disconnect()
+
+	// While our access token is valid, announcements should use it
+	m := outbound.Message{Text: "we're live", Kind: outbound.KindAnnouncement}
+	assert.NoError(t, a.Say(ctx, "", m))
+	assert.Equal(t, []string{"access-1"}, announcer.accessTokens)
+
+	// Once it's about to expire, it should be refreshed before the announcement is
+	// sent, even though the bot remains connected
+	a.mu.Lock()
+	a.tokenExpiresAt = time.Now().Add(time.Minute)
+	a.mu.Unlock()
+	assert.NoError(t, a.Say(ctx, "", m))
+	assert.Equal(t, []string{"access-1", "access-2"}, announcer.accessTokens)
+	assert.Equal(t, 1, refresher.calls)
+	credentials, err := a.tokenStore.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "access-2", credentials.AccessToken)
+	assert.True(t, a.GetStatusDetails().TokenExpiresAt.After(time.Now().Add(time.Hour-time.Minute)))
+	assert.Equal(t, 0, a.GetStatusDetails().NumReconnects)
+}
+
+func Test_Agent_reconnectWhileRefreshingToken(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := irctest.NewServer(irctest.ServerOpts{})
+	assert.NoError(t, err)
+	defer srv.Close()
+	refresher := &fakeRefresher{
+		credentials: &helix.AccessCredentials{AccessToken: "access-2", RefreshToken: "refresh-2", ExpiresIn: 3600},
+		delay:       50 * time.Millisecond,
+	}
+	a := newTestAgent(t, ctx, srv, refresher)
+	err = a.Reinitialize(&helix.AccessCredentials{AccessToken: "access-1", ExpiresIn: 3600}, time.Second)
+	assert.NoError(t, err)
+	defer a.Disconnect()
+
+	// If our access token is refreshed for an API request while the supervisor is
+	// refreshing it in order to reconnect, the refreshes must not overlap, or they'd
+	// both spend the same refresh token
+	a.mu.Lock()
+	a.tokenExpiresAt = time.Now().Add(time.Minute)
+	a.mu.Unlock()
+	srv.SendReconnect()
+	accessToken, err := a.currentAccessToken(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-2", accessToken)
+	assert.Eventually(t, func() bool {
+		return a.GetStatus() == chatbot.StatusConnected && a.GetStatusDetails().NumReconnects == 1
+	}, time.Second, 10*time.Millisecond)
+
+	refresher.mu.Lock()
+	defer refresher.mu.Unlock()
+	assert.NotEmpty(t, refresher.refreshTokens)
+	seen := make(map[string]bool)
+	for _, refreshToken := range refresher.refreshTokens {
+		assert.False(t, seen[refreshToken], "refresh token %s was spent more than once", refreshToken)
+		seen[refreshToken] = true
+	}
+}
+
+// newTestAgent initializes an agent that connects to the given fake IRC server, with
+// stored credentials that can be refreshed by the given refresher
+func newTestAgent(t *testing.T, ctx context.Context, srv *irctest.Server, refresher *fakeRefresher) *agent {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	messagesChan := make(chan *irc.Message)
+	go func() {
+		for range messagesChan {
+		}
+	}()
+	tokenStore := tokens.NewStore(t.TempDir(), "TapeBoy")
+	err := tokenStore.Save(&helix.AccessCredentials{AccessToken: "access-1", RefreshToken: "refresh-1"})
+	assert.NoError(t, err)
+	return NewAgent(ctx, logger, irc.ConnOpts{Dial: srv.Dial, Logger: irc.NewStructuredLogger(logger, irc.LogPolicy{})}, []irc.Channel{{Name: "goldenvcr"}}, "TapeBoy", messagesChan, func(string, outbound.Message) {}, nil, nil, tokenStore, refresher, nil, commands.HandlerOpts{}).(*agent)
+}
+
+type fakeAnnouncer struct {
+	accessTokens []string
+}
+
+func (a *fakeAnnouncer) SendAnnouncement(userAccessToken, broadcasterId, moderatorId, text, color string) error {
+	a.accessTokens = append(a.accessTokens, userAccessToken)
+	return nil
+}
+
+type fakeRefresher struct {
+	credentials   *helix.AccessCredentials
+	err           error
+	delay         time.Duration
+	calls         int
+	refreshTokens []string
+	mu            sync.Mutex
+}
+
+func (r *fakeRefresher) RefreshCredentials(ctx context.Context, credentials *helix.AccessCredentials) (*helix.AccessCredentials, error) {
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	r.refreshTokens = append(r.refreshTokens, credentials.RefreshToken)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.credentials, nil
+}
+
+// streamChatlog opens an SSE connection to the chatlog server and returns a channel
+// that will receive chatlog events until ctx is canceled
+func streamChatlog(t *testing.T, ctx context.Context, url string) <-chan *chatlog.Event {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+
+	events := make(chan *chatlog.Event, 32)
+	go func() {
+		defer res.Body.Close()
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var ev chatlog.Event
+			if err := json.Unmarshal([]byte(data), &ev); err == nil {
+				events <- &ev
+			}
+		}
+	}()
+	return events
+}
+
+// awaitChatlogEvent reads chatlog events until it finds one that matches
+func awaitChatlogEvent(t *testing.T, events <-chan *chatlog.Event, match func(ev *chatlog.Event) bool) *chatlog.Event {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if match(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for chatlog event")
+			return nil
+		}
+	}
+}
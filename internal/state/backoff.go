@@ -0,0 +1,40 @@
+package state
+
+import (
+	"math/rand"
+	"time"
+)
+
+// defaultBackoff is the backoff policy used when reconnecting a failed bot: we wait
+// about a second before the first attempt, doubling up to a couple of minutes
+var defaultBackoff = backoff{
+	initial: time.Second,
+	max:     2 * time.Minute,
+	jitter:  rand.Float64,
+}
+
+// backoff describes an exponential backoff policy with jitter
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	jitter  func() float64
+}
+
+// delay returns the amount of time to wait before the given attempt (where the first
+// attempt is 1): the base delay doubles with each attempt, up to the configured
+// maximum, and the actual delay is chosen randomly from the upper half of that range
+// so that multiple clients don't all retry in lockstep
+func (b backoff) delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := b.initial
+	for i := 1; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	half := d / 2
+	return half + time.Duration(b.jitter()*float64(half))
+}
@@ -0,0 +1,35 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_backoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		jitter  float64
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt with no jitter", 0.0, 1, 500 * time.Millisecond},
+		{"first attempt with full jitter", 1.0, 1, time.Second},
+		{"third attempt with half jitter", 0.5, 3, 3 * time.Second},
+		{"attempt numbers below 1 are treated as 1", 1.0, -4, time.Second},
+		{"delay is capped at max", 1.0, 12, 10 * time.Second},
+		{"large attempt numbers do not overflow", 0.0, 1000, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := backoff{
+				initial: time.Second,
+				max:     10 * time.Second,
+				jitter:  func() float64 { return tt.jitter },
+			}
+			got := b.delay(tt.attempt)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,9 +1,95 @@
 package chatbot
 
+import "time"
+
 type Status string
 
 const (
 	StatusConnecting   Status = "connecting"
 	StatusConnected    Status = "connected"
+	StatusReconnecting Status = "reconnecting"
 	StatusDisconnected Status = "disconnected"
 )
+
+// StatusDetails describes the state of the bot's connection to Twitch IRC in detail,
+// for diagnostic purposes
+type StatusDetails struct {
+	// Status is the overall state of the connection
+	Status Status `json:"status"`
+	// BotUsername is the name of the Twitch account that the bot logs in as
+	BotUsername string `json:"botUsername"`
+	// BotUserId is the Twitch user ID of the bot, once it has logged in
+	BotUserId string `json:"botUserId,omitempty"`
+	// Channels lists the channels that the bot joins
+	Channels []ChannelStatus `json:"channels"`
+	// ConnectedSince is the time at which the current connection became ready
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	// LastPingTime is the time at which the server last sent us a PING
+	LastPingTime *time.Time `json:"lastPingTime,omitempty"`
+	// LastPongTime is the time at which the server last responded to our PING
+	LastPongTime *time.Time `json:"lastPongTime,omitempty"`
+	// LatencyMilliseconds is the round-trip time of our most recent PING
+	LatencyMilliseconds int64 `json:"latencyMs,omitempty"`
+	// LastError describes the most recent error that caused the bot to disconnect or
+	// prevented it from connecting
+	LastError *ErrorDetails `json:"lastError,omitempty"`
+	// ReconnectAttempt is the number of the current reconnect attempt, if the bot is
+	// reconnecting
+	ReconnectAttempt int `json:"reconnectAttempt,omitempty"`
+	// NumReconnects is the number of times the bot has successfully reconnected on its
+	// own since it was last initialized
+	NumReconnects int `json:"numReconnects"`
+	// TokenExpiresAt is the time at which the bot's current User Access Token expires
+	TokenExpiresAt *time.Time `json:"tokenExpiresAt,omitempty"`
+}
+
+// ChannelStatus describes the state of the bot in a single channel
+type ChannelStatus struct {
+	// Name is the name of the channel, without the leading '#'
+	Name string `json:"name"`
+	// Joined indicates whether the bot has successfully joined the channel
+	Joined bool `json:"joined"`
+	// IsModerator indicates whether the bot has moderator privileges in the channel
+	IsModerator bool `json:"isModerator"`
+	// LastDeliveryError describes the most recent message that Twitch refused to
+	// deliver to the channel (e.g. due to rate limits or a ban), if any
+	LastDeliveryError *ErrorDetails `json:"lastDeliveryError,omitempty"`
+}
+
+// ErrorDetails describes an error that occurred at a particular time
+type ErrorDetails struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// SayKind identifies how a message sent via POST /say is presented in chat
+type SayKind string
+
+const (
+	SayKindMessage      SayKind = "message"
+	SayKindAction       SayKind = "action"
+	SayKindAnnouncement SayKind = "announcement"
+)
+
+// SayRequest is the payload for POST /say, which sends a message as the bot
+type SayRequest struct {
+	// Channel is the name of the channel to send the message to, without the leading
+	// '#'; if omitted, the message is sent to the bot's home channel
+	Channel string `json:"channel,omitempty"`
+	// Kind determines whether the message is sent as a regular chat message (the
+	// default), an action (as with '/me'), or an announcement
+	Kind SayKind `json:"kind,omitempty"`
+	// Text is the body of the message
+	Text string `json:"text"`
+	// Color is the accent color of an announcement: 'primary' (the default), 'blue',
+	// 'green', 'orange', or 'purple'
+	Color string `json:"color,omitempty"`
+}
+
+// SayResponse describes the outcome of a POST /say request
+type SayResponse struct {
+	// Delivered indicates whether the message was successfully sent to chat
+	Delivered bool `json:"delivered"`
+	// Error describes why the message was not delivered, if it wasn't
+	Error string `json:"error,omitempty"`
+}